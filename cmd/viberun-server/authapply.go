@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/shayne/viberun/internal/agents"
+	"github.com/shayne/viberun/internal/authbundle"
+	"github.com/shayne/viberun/internal/server"
+)
+
+const authBackupSuffix = ".viberun-bak"
+
+// containerFiles is the file access the auth pipeline needs inside a container.
+type containerFiles interface {
+	Read(path string) ([]byte, error)
+	Write(path string, content []byte, mode os.FileMode) error
+	Remove(path string) error
+}
+
+type dockerFiles struct {
+	container string
+}
+
+func (d dockerFiles) Read(path string) ([]byte, error) {
+	return readContainerFile(d.container, path)
+}
+
+func (d dockerFiles) Write(path string, content []byte, mode os.FileMode) error {
+	return writeContainerFile(d.container, path, content, mode)
+}
+
+func (d dockerFiles) Remove(path string) error {
+	if err := containerEngine.Command("exec", d.container, "rm", "-f", path).Run(); err != nil {
+		return fmt.Errorf("failed to remove %s: %v", path, err)
+	}
+	return nil
+}
+
+// authChange is a single container file the auth pipeline will write.
+type authChange struct {
+	Path    string
+	Mode    os.FileMode
+	Existed bool
+	Before  []byte
+	After   []byte
+	// Keys lists env keys merged into the file; nil for whole-file credentials.
+	Keys       []string
+	BeforeEnv  map[string]string
+	backupPath string
+	written    bool
+}
+
+// authPlan is the full set of changes for one bundle, computed before anything is written.
+type authPlan struct {
+	Provider string
+	Changes  []authChange
+}
+
+func planAuthBundle(files containerFiles, provider agents.Provider, bundle *authbundle.Bundle) (*authPlan, error) {
+	plan := &authPlan{Provider: provider.Name}
+	for _, file := range bundle.Files {
+		if strings.TrimSpace(file.ContainerPath) == "" {
+			continue
+		}
+		before, existed, err := readExisting(files, file.ContainerPath)
+		if err != nil {
+			return nil, err
+		}
+		plan.Changes = append(plan.Changes, authChange{
+			Path:    file.ContainerPath,
+			Mode:    os.FileMode(file.Mode),
+			Existed: existed,
+			Before:  before,
+			After:   file.Data,
+		})
+	}
+	target := provider.Auth.EnvTarget
+	if len(bundle.Env) == 0 || target == nil {
+		return plan, nil
+	}
+	before, existed, err := readExisting(files, target.Path)
+	if err != nil {
+		return nil, err
+	}
+	beforeEnv, err := envValues(target.Format, before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := mergeEnvTarget(target.Format, before, bundle.Env)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(bundle.Env))
+	for key := range bundle.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	plan.Changes = append(plan.Changes, authChange{
+		Path:      target.Path,
+		Mode:      0o600,
+		Existed:   existed,
+		Before:    before,
+		After:     after,
+		Keys:      keys,
+		BeforeEnv: beforeEnv,
+	})
+	return plan, nil
+}
+
+func readExisting(files containerFiles, path string) ([]byte, bool, error) {
+	data, err := files.Read(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// Diff renders the plan without any secret values.
+func (p *authPlan) Diff(env map[string]string) string {
+	var b strings.Builder
+	for _, change := range p.Changes {
+		switch {
+		case !change.Existed:
+			fmt.Fprintf(&b, "+ %s (create, %d bytes)\n", change.Path, len(change.After))
+		case bytes.Equal(change.Before, change.After):
+			fmt.Fprintf(&b, "= %s (unchanged)\n", change.Path)
+		default:
+			fmt.Fprintf(&b, "~ %s (replace, %d -> %d bytes)\n", change.Path, len(change.Before), len(change.After))
+		}
+		for _, key := range change.Keys {
+			previous, had := change.BeforeEnv[key]
+			switch {
+			case !had || previous == "":
+				fmt.Fprintf(&b, "    + %s=<redacted>\n", key)
+			case previous == env[key]:
+				fmt.Fprintf(&b, "    = %s=<redacted>\n", key)
+			default:
+				fmt.Fprintf(&b, "    ~ %s=<redacted>\n", key)
+			}
+		}
+	}
+	if len(p.Changes) == 0 {
+		b.WriteString("no changes\n")
+	}
+	return b.String()
+}
+
+// apply backs up every file it touches, writes the changes, and restores all files if
+// any write fails. The backups are removed once every write succeeds, so old credentials
+// do not linger in the container or its snapshots.
+func (p *authPlan) apply(files containerFiles) error {
+	for i := range p.Changes {
+		change := &p.Changes[i]
+		if !change.Existed || bytes.Equal(change.Before, change.After) {
+			continue
+		}
+		backup := change.Path + authBackupSuffix
+		if err := files.Write(backup, change.Before, 0o600); err != nil {
+			p.rollback(files)
+			return fmt.Errorf("failed to back up %s: %w", change.Path, err)
+		}
+		change.backupPath = backup
+	}
+	for i := range p.Changes {
+		change := &p.Changes[i]
+		if change.Existed && bytes.Equal(change.Before, change.After) {
+			continue
+		}
+		change.written = true
+		if err := files.Write(change.Path, change.After, change.Mode); err != nil {
+			if rbErr := p.rollback(files); rbErr != nil {
+				return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+			}
+			return err
+		}
+	}
+	for i := range p.Changes {
+		change := &p.Changes[i]
+		if change.backupPath == "" {
+			continue
+		}
+		if err := files.Remove(change.backupPath); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			continue
+		}
+		change.backupPath = ""
+	}
+	return nil
+}
+
+// rollback restores written files in reverse order. A backup is kept when its file could
+// not be restored, since it is then the only good copy.
+func (p *authPlan) rollback(files containerFiles) error {
+	var errs []error
+	for i := len(p.Changes) - 1; i >= 0; i-- {
+		change := &p.Changes[i]
+		if change.written {
+			var err error
+			if change.Existed {
+				err = files.Write(change.Path, change.Before, change.Mode)
+			} else {
+				err = files.Remove(change.Path)
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			change.written = false
+		}
+		if change.backupPath != "" {
+			if err := files.Remove(change.backupPath); err != nil {
+				errs = append(errs, err)
+			}
+			change.backupPath = ""
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *authPlan) auditEntry(app string, action string, err error) server.AuthAuditEntry {
+	entry := server.AuthAuditEntry{
+		App:      app,
+		Provider: p.Provider,
+		Action:   action,
+		Result:   "applied",
+	}
+	for _, change := range p.Changes {
+		if change.Existed && bytes.Equal(change.Before, change.After) {
+			continue
+		}
+		entry.Files = append(entry.Files, change.Path)
+		entry.Keys = append(entry.Keys, change.Keys...)
+		// Only backups that could not be removed are still around to record.
+		if change.backupPath != "" {
+			entry.Backups = append(entry.Backups, change.backupPath)
+		}
+	}
+	if err != nil {
+		entry.Result = "rolled_back"
+		entry.Error = err.Error()
+	}
+	return entry
+}
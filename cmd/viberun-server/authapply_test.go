@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shayne/viberun/internal/agents"
+	"github.com/shayne/viberun/internal/authbundle"
+)
+
+type fakeFiles struct {
+	files    map[string][]byte
+	failPath string
+	written  []string
+}
+
+func (f *fakeFiles) Read(path string) ([]byte, error) {
+	data, ok := f.files[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
+func (f *fakeFiles) Write(path string, content []byte, mode os.FileMode) error {
+	if path == f.failPath {
+		f.failPath = ""
+		return fmt.Errorf("write %s: disk full", path)
+	}
+	f.files[path] = append([]byte(nil), content...)
+	f.written = append(f.written, path)
+	return nil
+}
+
+func (f *fakeFiles) Remove(path string) error {
+	delete(f.files, path)
+	return nil
+}
+
+func testClaudeProvider(t *testing.T) agents.Provider {
+	t.Helper()
+	provider, ok := agents.Builtin().Lookup("claude")
+	if !ok {
+		t.Fatalf("missing claude provider")
+	}
+	return provider
+}
+
+func TestAuthPlanDiffRedactsValues(t *testing.T) {
+	files := &fakeFiles{files: map[string][]byte{
+		"/root/.claude/settings.json": []byte(`{"env":{"ANTHROPIC_API_KEY":"old-secret"}}`),
+	}}
+	bundle := &authbundle.Bundle{
+		Provider: "claude",
+		Files:    []authbundle.File{{ContainerPath: "/root/.claude/.credentials.json", Mode: 0o600, Data: []byte(`{"token":"file-secret"}`)}},
+		Env:      map[string]string{"ANTHROPIC_API_KEY": "new-secret", "ANTHROPIC_AUTH_TOKEN": "token-secret"},
+	}
+	plan, err := planAuthBundle(files, testClaudeProvider(t), bundle)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	diff := plan.Diff(bundle.Env)
+	for _, secret := range []string{"old-secret", "new-secret", "token-secret", "file-secret"} {
+		if strings.Contains(diff, secret) {
+			t.Fatalf("diff leaked %q:\n%s", secret, diff)
+		}
+	}
+	for _, want := range []string{
+		"+ /root/.claude/.credentials.json (create",
+		"~ /root/.claude/settings.json (replace",
+		"~ ANTHROPIC_API_KEY=<redacted>",
+		"+ ANTHROPIC_AUTH_TOKEN=<redacted>",
+	} {
+		if !strings.Contains(diff, want) {
+			t.Fatalf("diff missing %q:\n%s", want, diff)
+		}
+	}
+	if len(files.files) != 1 {
+		t.Fatalf("planning should not write files: %v", files.files)
+	}
+}
+
+func TestAuthPlanApplyRemovesBackupsAfterSuccess(t *testing.T) {
+	files := &fakeFiles{files: map[string][]byte{
+		"/root/.claude/.credentials.json": []byte("old"),
+	}}
+	bundle := &authbundle.Bundle{
+		Provider: "claude",
+		Files:    []authbundle.File{{ContainerPath: "/root/.claude/.credentials.json", Mode: 0o600, Data: []byte("new")}},
+	}
+	plan, err := planAuthBundle(files, testClaudeProvider(t), bundle)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if err := plan.apply(files); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if got := string(files.files["/root/.claude/.credentials.json"]); got != "new" {
+		t.Fatalf("unexpected credentials: %q", got)
+	}
+	backup := "/root/.claude/.credentials.json" + authBackupSuffix
+	if !slices.Contains(files.written, backup) {
+		t.Fatalf("expected a backup before writing, got writes %v", files.written)
+	}
+	if _, ok := files.files[backup]; ok {
+		t.Fatalf("expected the backup to be removed after a successful apply")
+	}
+	entry := plan.auditEntry("myapp", "push", nil)
+	if entry.Result != "applied" || len(entry.Backups) != 0 {
+		t.Fatalf("unexpected audit entry: %+v", entry)
+	}
+}
+
+func TestAuthPlanApplyRollsBackOnFailure(t *testing.T) {
+	files := &fakeFiles{
+		files: map[string][]byte{
+			"/root/.claude/settings.json": []byte(`{"theme":"dark"}`),
+		},
+		failPath: "/root/.claude/settings.json",
+	}
+	bundle := &authbundle.Bundle{
+		Provider: "claude",
+		Files:    []authbundle.File{{ContainerPath: "/root/.claude/.credentials.json", Mode: 0o600, Data: []byte("new")}},
+		Env:      map[string]string{"ANTHROPIC_API_KEY": "secret"},
+	}
+	plan, err := planAuthBundle(files, testClaudeProvider(t), bundle)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	applyErr := plan.apply(files)
+	if applyErr == nil {
+		t.Fatalf("expected apply error")
+	}
+	if _, ok := files.files["/root/.claude/.credentials.json"]; ok {
+		t.Fatalf("expected new credentials file to be removed on rollback")
+	}
+	if got := string(files.files["/root/.claude/settings.json"]); got != `{"theme":"dark"}` {
+		t.Fatalf("settings changed after rollback: %q", got)
+	}
+	if _, ok := files.files["/root/.claude/settings.json"+authBackupSuffix]; ok {
+		t.Fatalf("expected backup to be cleaned up after rollback")
+	}
+	entry := plan.auditEntry("myapp", "push", applyErr)
+	if entry.Result != "rolled_back" || entry.Error == "" {
+		t.Fatalf("unexpected audit entry: %+v", entry)
+	}
+	if len(entry.Keys) != 1 || entry.Keys[0] != "ANTHROPIC_API_KEY" || strings.Contains(fmt.Sprintf("%+v", entry), "secret\"") {
+		t.Fatalf("unexpected audit keys: %+v", entry)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/shayne/viberun/internal/agents"
+	"github.com/shayne/viberun/internal/authbundle"
+	"github.com/shayne/viberun/internal/server"
+)
+
+func runAuthAction(containerName string, app string, exists bool, agentProvider string, actionArgs []string, dryRun bool) error {
+	if actionArgs[0] != "stage" {
+		if !exists {
+			return fmt.Errorf("app container does not exist")
+		}
+		if err := ensureContainerRunning(containerName); err != nil {
+			return err
+		}
+	}
+	registry, err := agents.Load()
+	if err != nil {
+		return err
+	}
+	provider := ""
+	if len(actionArgs) > 1 {
+		provider = actionArgs[1]
+	}
+	switch actionArgs[0] {
+	case "status":
+		names := registry.Names()
+		if provider != "" {
+			names = []string{provider}
+		}
+		statuses := make([]authbundle.Status, 0, len(names))
+		for _, name := range names {
+			definition, ok := registry.Lookup(name)
+			if !ok {
+				return fmt.Errorf("unsupported provider %q", name)
+			}
+			status, err := inspectAuth(containerName, definition)
+			if err != nil {
+				return err
+			}
+			statuses = append(statuses, status)
+		}
+		return json.NewEncoder(os.Stdout).Encode(statuses)
+	case "push":
+		bundle, err := authbundle.Read(os.Stdin)
+		if err != nil {
+			return err
+		}
+		if _, ok := registry.Lookup(bundle.Provider); !ok {
+			return fmt.Errorf("unsupported provider %q", bundle.Provider)
+		}
+		if err := applyAuthBundle(containerName, app, bundle, "push", dryRun); err != nil {
+			return err
+		}
+		if dryRun {
+			return nil
+		}
+		fmt.Fprintf(os.Stdout, "Updated %s auth in %s\n", bundle.Provider, app)
+		return nil
+	case "pull":
+		if provider == "" {
+			provider = agentProvider
+		}
+		definition, ok := registry.Lookup(provider)
+		if !ok {
+			return fmt.Errorf("unsupported provider %q", provider)
+		}
+		bundle, err := collectAuthFiles(containerName, definition)
+		if err != nil {
+			return err
+		}
+		return authbundle.Write(os.Stdout, bundle)
+	case "fanout":
+		bundle, err := authbundle.Read(os.Stdin)
+		if err != nil {
+			return err
+		}
+		return fanoutAuth(registry, bundle)
+	case "stage":
+		bundle, err := authbundle.Read(os.Stdin)
+		if err != nil {
+			return err
+		}
+		dir, err := server.AuthStagingDir()
+		if err != nil {
+			return err
+		}
+		token, err := authbundle.Stage(dir, bundle)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, token)
+		return nil
+	default:
+		return fmt.Errorf("unknown auth action %q", actionArgs[0])
+	}
+}
+
+func inspectAuth(container string, provider agents.Provider) (authbundle.Status, error) {
+	status := authbundle.Status{Provider: provider.Name}
+	for _, file := range provider.Auth.Files {
+		present := containerFileExists(container, file.ContainerPath)
+		status.Files = append(status.Files, authbundle.TargetStatus{
+			Path:    file.ContainerPath,
+			Present: present,
+		})
+		if present {
+			status.Configured = true
+		}
+	}
+	target := provider.Auth.EnvTarget
+	if target == nil || len(provider.Auth.Env) == 0 {
+		return status, nil
+	}
+	existing, err := readContainerFile(container, target.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return status, err
+	}
+	present, err := envKeysPresent(target.Format, existing)
+	if err != nil {
+		return status, err
+	}
+	for _, key := range provider.Auth.Env {
+		status.Env = append(status.Env, authbundle.TargetStatus{
+			Path:    target.Path,
+			Key:     key,
+			Present: present[key],
+		})
+		if present[key] {
+			status.Configured = true
+		}
+	}
+	return status, nil
+}
+
+// collectAuthFiles reads a provider's credential files out of a container.
+func collectAuthFiles(container string, provider agents.Provider) (*authbundle.Bundle, error) {
+	bundle := &authbundle.Bundle{Provider: provider.Name}
+	for _, file := range provider.Auth.Files {
+		data, err := readContainerFile(container, file.ContainerPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		bundle.Files = append(bundle.Files, authbundle.File{
+			ContainerPath: file.ContainerPath,
+			Mode:          file.Mode,
+			Data:          data,
+		})
+	}
+	return bundle, nil
+}
+
+// fanoutAuth writes bundle files into every running app container whose copy is older.
+func fanoutAuth(registry *agents.Registry, bundle *authbundle.Bundle) error {
+	provider, ok := registry.Lookup(bundle.Provider)
+	if !ok {
+		return fmt.Errorf("unsupported provider %q", bundle.Provider)
+	}
+	containers, err := listContainers()
+	if err != nil {
+		return err
+	}
+	for _, name := range containers {
+		if !strings.HasPrefix(name, "viberun-") {
+			continue
+		}
+		app := strings.TrimPrefix(name, "viberun-")
+		running, err := containerRunning(name)
+		if err != nil || !running {
+			fmt.Fprintf(os.Stdout, "%s: not running, skipped\n", app)
+			continue
+		}
+		files := dockerFiles{container: name}
+		stale := &authbundle.Bundle{Provider: bundle.Provider}
+		for _, file := range bundle.Files {
+			existing, existed, err := readExisting(files, file.ContainerPath)
+			if err != nil {
+				return err
+			}
+			if existed {
+				if newer, ok := authbundle.Compare(existing, file.Data); !ok || !newer {
+					continue
+				}
+			}
+			stale.Files = append(stale.Files, file)
+		}
+		if len(stale.Files) == 0 {
+			fmt.Fprintf(os.Stdout, "%s: up to date\n", app)
+			continue
+		}
+		plan, err := planAuthBundle(files, provider, stale)
+		if err != nil {
+			return err
+		}
+		applyErr := plan.apply(files)
+		if err := server.AppendAuthAudit(plan.auditEntry(app, "fanout", applyErr)); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to write auth audit log: %v\n", err)
+		}
+		if applyErr != nil {
+			return fmt.Errorf("%s: %w", app, applyErr)
+		}
+		fmt.Fprintf(os.Stdout, "%s: updated %d file(s)\n", app, len(stale.Files))
+	}
+	return nil
+}
+
+func containerFileExists(container string, path string) bool {
+	return containerEngine.Command("exec", container, "test", "-f", path).Run() == nil
+}
+
+func ensureContainerRunning(name string) error {
+	running, err := containerRunning(name)
+	if err != nil {
+		return fmt.Errorf("failed to check container state: %w", err)
+	}
+	if running {
+		return nil
+	}
+	if err := dockerStart(name); err != nil {
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+	running, err = containerRunning(name)
+	if err != nil {
+		return fmt.Errorf("failed to check container state: %w", err)
+	}
+	if !running {
+		explainStoppedContainer(name)
+		return fmt.Errorf("container %s is not running", name)
+	}
+	return nil
+}
@@ -2,104 +2,77 @@ package main
 
 import (
 	"bytes"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/shayne/viberun/internal/agents"
 	"github.com/shayne/viberun/internal/authbundle"
+	"github.com/shayne/viberun/internal/server"
 )
 
-const (
-	claudeSettingsPath = "/root/.claude/settings.json"
-	geminiEnvPath      = "/root/.env"
-)
-
-func loadAuthBundleFromEnv() (*authbundle.Bundle, error) {
-	raw := strings.TrimSpace(os.Getenv("VIBERUN_AUTH_BUNDLE"))
-	if raw == "" {
+func takeStagedAuthBundle() (*authbundle.Bundle, error) {
+	token := strings.TrimSpace(os.Getenv("VIBERUN_AUTH_TOKEN"))
+	if token == "" {
 		return nil, nil
 	}
-	decoded, err := base64.StdEncoding.DecodeString(raw)
+	dir, err := server.AuthStagingDir()
 	if err != nil {
-		return nil, fmt.Errorf("invalid auth bundle encoding: %w", err)
-	}
-	var bundle authbundle.Bundle
-	if err := json.Unmarshal(decoded, &bundle); err != nil {
-		return nil, fmt.Errorf("invalid auth bundle: %w", err)
+		return nil, err
 	}
-	return &bundle, nil
+	return authbundle.Take(dir, token)
 }
 
-func applyAuthBundle(container string, bundle *authbundle.Bundle) error {
+// applyAuthBundle writes a bundle into a container through the auth plan. With dryRun it
+// only prints a redacted diff. Every real apply is recorded in the host audit log.
+func applyAuthBundle(container string, app string, bundle *authbundle.Bundle, action string, dryRun bool) error {
 	if bundle == nil {
 		return nil
 	}
-	switch strings.ToLower(strings.TrimSpace(bundle.Provider)) {
-	case "", "codex":
-		return applyCodexAuth(container, bundle)
-	case "claude", "claude-code":
-		return applyClaudeAuth(container, bundle)
-	case "gemini":
-		return applyGeminiAuth(container, bundle)
-	default:
-		return nil
+	registry, err := agents.Load()
+	if err != nil {
+		return err
 	}
-}
-
-func applyCodexAuth(container string, bundle *authbundle.Bundle) error {
-	if len(bundle.Files) == 0 {
+	provider, ok := registry.Lookup(bundle.Provider)
+	if !ok {
 		return nil
 	}
-	for _, file := range bundle.Files {
-		if err := copyHostFileToContainer(container, file); err != nil {
-			return err
-		}
+	files := dockerFiles{container: container}
+	plan, err := planAuthBundle(files, provider, bundle)
+	if err != nil {
+		return err
 	}
-	return nil
-}
-
-func applyClaudeAuth(container string, bundle *authbundle.Bundle) error {
-	if len(bundle.Env) == 0 {
+	if dryRun {
+		fmt.Fprintf(os.Stdout, "Dry run: %s auth for %s\n", provider.Name, app)
+		fmt.Fprint(os.Stdout, plan.Diff(bundle.Env))
 		return nil
 	}
-	existing, err := readContainerFile(container, claudeSettingsPath)
-	if err != nil && !os.IsNotExist(err) {
-		return err
-	}
-	merged, err := mergeClaudeSettings(existing, bundle.Env)
-	if err != nil {
-		return err
+	applyErr := plan.apply(files)
+	if err := server.AppendAuthAudit(plan.auditEntry(app, action, applyErr)); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to write auth audit log: %v\n", err)
 	}
-	return writeContainerFile(container, claudeSettingsPath, merged, 0o600)
+	return applyErr
 }
 
-func applyGeminiAuth(container string, bundle *authbundle.Bundle) error {
-	for _, file := range bundle.Files {
-		if err := copyHostFileToContainer(container, file); err != nil {
-			return err
-		}
-	}
-	if len(bundle.Env) == 0 {
-		return nil
-	}
-	existing, err := readContainerFile(container, geminiEnvPath)
-	if err != nil && !os.IsNotExist(err) {
-		return err
+func mergeEnvTarget(format string, existing []byte, env map[string]string) ([]byte, error) {
+	switch format {
+	case agents.EnvFormatJSON:
+		return mergeSettingsEnv(existing, env)
+	case agents.EnvFormatDotEnv:
+		return []byte(mergeDotEnv(string(existing), env)), nil
+	default:
+		return nil, fmt.Errorf("unsupported env target format %q", format)
 	}
-	merged := mergeDotEnv(string(existing), bundle.Env)
-	return writeContainerFile(container, geminiEnvPath, []byte(merged), 0o600)
 }
 
-func mergeClaudeSettings(existing []byte, env map[string]string) ([]byte, error) {
+func mergeSettingsEnv(existing []byte, env map[string]string) ([]byte, error) {
 	doc := map[string]any{}
 	if len(bytes.TrimSpace(existing)) > 0 {
 		if err := json.Unmarshal(existing, &doc); err != nil {
-			return nil, fmt.Errorf("invalid claude settings: %w", err)
+			return nil, fmt.Errorf("invalid settings file: %w", err)
 		}
 	}
 	envMap := map[string]any{}
@@ -115,6 +88,57 @@ func mergeClaudeSettings(existing []byte, env map[string]string) ([]byte, error)
 	return json.MarshalIndent(doc, "", "  ")
 }
 
+// envKeysPresent returns the env keys that already have a value in an env target file.
+func envKeysPresent(format string, content []byte) (map[string]bool, error) {
+	values, err := envValues(format, content)
+	if err != nil {
+		return nil, err
+	}
+	present := map[string]bool{}
+	for key, value := range values {
+		if value != "" {
+			present[key] = true
+		}
+	}
+	return present, nil
+}
+
+// envValues returns the string env values in an env target file.
+func envValues(format string, content []byte) (map[string]string, error) {
+	values := map[string]string{}
+	switch format {
+	case agents.EnvFormatJSON:
+		if len(bytes.TrimSpace(content)) == 0 {
+			return values, nil
+		}
+		doc := map[string]any{}
+		if err := json.Unmarshal(content, &doc); err != nil {
+			return nil, fmt.Errorf("invalid settings file: %w", err)
+		}
+		if envMap, ok := doc["env"].(map[string]any); ok {
+			for key, value := range envMap {
+				if text, ok := value.(string); ok {
+					values[key] = text
+				}
+			}
+		}
+	case agents.EnvFormatDotEnv:
+		for _, line := range strings.Split(string(content), "\n") {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			parts := strings.SplitN(trimmed, "=", 2)
+			if len(parts) == 2 {
+				values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported env target format %q", format)
+	}
+	return values, nil
+}
+
 func mergeDotEnv(existing string, env map[string]string) string {
 	lines := strings.Split(existing, "\n")
 	updated := make(map[string]bool, len(env))
@@ -150,7 +174,7 @@ func mergeDotEnv(existing string, env map[string]string) string {
 }
 
 func readContainerFile(container string, path string) ([]byte, error) {
-	cmd := exec.Command("docker", "exec", container, "sh", "-lc", "cat "+shellQuote(path))
+	cmd := containerEngine.Command("exec", container, "sh", "-lc", "cat "+shellQuote(path))
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		if strings.Contains(string(out), "No such file") {
@@ -163,7 +187,7 @@ func readContainerFile(container string, path string) ([]byte, error) {
 
 func writeContainerFile(container string, path string, content []byte, mode os.FileMode) error {
 	dir := filepath.Dir(path)
-	cmd := exec.Command("docker", "exec", "-i", container, "sh", "-lc", "umask 077; mkdir -p "+shellQuote(dir)+"; cat > "+shellQuote(path))
+	cmd := containerEngine.Command("exec", "-i", container, "sh", "-lc", "umask 077; mkdir -p "+shellQuote(dir)+"; cat > "+shellQuote(path))
 	cmd.Stdin = bytes.NewReader(content)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -171,7 +195,7 @@ func writeContainerFile(container string, path string, content []byte, mode os.F
 		return fmt.Errorf("failed to write %s: %v", path, err)
 	}
 	if mode != 0 {
-		chmodCmd := exec.Command("docker", "exec", container, "chmod", fmt.Sprintf("%#o", mode), path)
+		chmodCmd := containerEngine.Command("exec", container, "chmod", fmt.Sprintf("%#o", mode), path)
 		if err := chmodCmd.Run(); err != nil {
 			return fmt.Errorf("failed to chmod %s: %v", path, err)
 		}
@@ -179,26 +203,6 @@ func writeContainerFile(container string, path string, content []byte, mode os.F
 	return nil
 }
 
-func copyHostFileToContainer(container string, file authbundle.File) error {
-	if strings.TrimSpace(file.HostPath) == "" || strings.TrimSpace(file.ContainerPath) == "" {
-		return nil
-	}
-	dir := filepath.Dir(file.ContainerPath)
-	if err := exec.Command("docker", "exec", container, "mkdir", "-p", dir).Run(); err != nil {
-		return fmt.Errorf("failed to create %s: %v", dir, err)
-	}
-	if err := exec.Command("docker", "cp", file.HostPath, fmt.Sprintf("%s:%s", container, file.ContainerPath)).Run(); err != nil {
-		return fmt.Errorf("failed to copy auth file: %v", err)
-	}
-	if file.Mode != 0 {
-		if err := exec.Command("docker", "exec", container, "chmod", fmt.Sprintf("%#o", file.Mode), file.ContainerPath).Run(); err != nil {
-			return fmt.Errorf("failed to chmod %s: %v", file.ContainerPath, err)
-		}
-	}
-	_ = os.Remove(file.HostPath)
-	return nil
-}
-
 func shellQuote(value string) string {
 	if value == "" {
 		return "''"
@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+
+	"github.com/shayne/viberun/internal/agents"
 )
 
-func TestMergeClaudeSettings(t *testing.T) {
+func TestMergeSettingsEnv(t *testing.T) {
 	existing := []byte(`{"theme":"dark","env":{"ANTHROPIC_API_KEY":"old"}}`)
-	merged, err := mergeClaudeSettings(existing, map[string]string{
+	merged, err := mergeSettingsEnv(existing, map[string]string{
 		"ANTHROPIC_API_KEY":    "new",
 		"ANTHROPIC_AUTH_TOKEN": "token",
 	})
@@ -47,3 +49,26 @@ func TestMergeDotEnv(t *testing.T) {
 		t.Fatalf("expected credentials appended")
 	}
 }
+
+func TestEnvKeysPresent(t *testing.T) {
+	settings := []byte(`{"env":{"ANTHROPIC_API_KEY":"set","ANTHROPIC_AUTH_TOKEN":""}}`)
+	present, err := envKeysPresent(agents.EnvFormatJSON, settings)
+	if err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if !present["ANTHROPIC_API_KEY"] || present["ANTHROPIC_AUTH_TOKEN"] {
+		t.Fatalf("unexpected json keys: %v", present)
+	}
+
+	present, err = envKeysPresent(agents.EnvFormatDotEnv, []byte("# GEMINI_API_KEY=x\nGEMINI_API_KEY=set\nGOOGLE_API_KEY=\n"))
+	if err != nil {
+		t.Fatalf("dotenv: %v", err)
+	}
+	if !present["GEMINI_API_KEY"] || present["GOOGLE_API_KEY"] {
+		t.Fatalf("unexpected dotenv keys: %v", present)
+	}
+
+	if _, err := envKeysPresent(agents.EnvFormatJSON, []byte("{")); err == nil {
+		t.Fatalf("expected invalid json error")
+	}
+}
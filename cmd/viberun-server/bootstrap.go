@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/shayne/viberun/internal/bootstrap"
+	"github.com/shayne/viberun/internal/engine"
+)
+
+// runBootstrap prepares the host and streams one JSON event per line for the client.
+// The client runs it as root (through sudo when needed) from a staged copy of this binary.
+func runBootstrap(flags serverFlags) error {
+	user := strings.TrimSpace(os.Getenv("SUDO_USER"))
+	if user == "" {
+		user = strings.TrimSpace(os.Getenv("USER"))
+	}
+	runtimeName := strings.TrimSpace(os.Getenv("VIBERUN_RUNTIME"))
+	if runtimeName != "" && !engine.Valid(runtimeName) {
+		return fmt.Errorf("unsupported container runtime %q (expected docker or podman)", runtimeName)
+	}
+	opts := bootstrap.Options{
+		Check:          flags.Check,
+		Image:          strings.TrimSpace(os.Getenv("VIBERUN_IMAGE")),
+		SkipImagePull:  strings.TrimSpace(os.Getenv("VIBERUN_SKIP_IMAGE_PULL")) != "",
+		ImageArchive:   strings.TrimSpace(os.Getenv("VIBERUN_IMAGE_ARCHIVE")),
+		Offline:        strings.TrimSpace(os.Getenv("VIBERUN_OFFLINE")) != "",
+		ExistingDocker: strings.TrimSpace(os.Getenv("VIBERUN_EXISTING_DOCKER")) != "",
+		Runtime:        runtimeName,
+		SourceBinary:   strings.TrimSpace(os.Getenv("VIBERUN_SERVER_LOCAL_PATH")),
+		User:           user,
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	return bootstrap.Run(opts, func(event bootstrap.Event) {
+		_ = encoder.Encode(event)
+	})
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/shayne/viberun/internal/bootstrap"
+	"github.com/shayne/viberun/internal/doctor"
+	"github.com/shayne/viberun/internal/engine"
+	"github.com/shayne/viberun/internal/server"
+	"github.com/shayne/viberun/internal/version"
+)
+
+const (
+	diskWarnBytes = 10 << 30
+	diskFailBytes = 2 << 30
+)
+
+// runDoctor prints host diagnostics as JSON for `viberun doctor`.
+func runDoctor() error {
+	report := doctor.Report{ServerVersion: version.String()}
+	report.Checks = append(report.Checks, checkHostOS())
+	dockerCheck := checkDocker()
+	report.Checks = append(report.Checks, dockerCheck)
+	if dockerCheck.Status == doctor.Pass && containerEngine.Name == engine.Docker && !containerEngine.Rootless() {
+		if check, ok := checkDockerGroup(); ok {
+			report.Checks = append(report.Checks, check)
+		}
+	}
+	if dockerCheck.Status == doctor.Pass {
+		report.Checks = append(report.Checks, checkImage())
+		report.Checks = append(report.Checks, checkContainerArch()...)
+		if containers, err := listContainers(); err == nil {
+			report.Checks = append(report.Checks, checkReservedApps(containers)...)
+		}
+	}
+	state, stateCheck := checkState()
+	report.Checks = append(report.Checks, stateCheck)
+	if state != nil {
+		report.Checks = append(report.Checks, checkPorts(state))
+	}
+	report.Checks = append(report.Checks, checkDisk())
+	return json.NewEncoder(os.Stdout).Encode(report)
+}
+
+func checkHostOS() doctor.Check {
+	check := doctor.Check{Name: "host os"}
+	data, err := os.ReadFile("/etc/os-release")
+	if err != nil {
+		check.Status = doctor.Fail
+		check.Detail = "missing /etc/os-release"
+		check.Hint = "viberun bootstrap supports " + bootstrap.SupportedSummary()
+		return check
+	}
+	distro := bootstrap.DetectDistro(string(data))
+	check.Detail = distro.Name
+	if reason := distro.Unsupported(); reason != "" {
+		check.Status = doctor.Warn
+		check.Detail = reason
+		check.Hint = "install docker yourself and run `viberun bootstrap --existing-docker`"
+		return check
+	}
+	check.Status = doctor.Pass
+	return check
+}
+
+// checkDocker checks the host's container engine (docker or podman) and selects it for
+// the checks that follow.
+func checkDocker() doctor.Check {
+	check := doctor.Check{Name: "docker"}
+	selected, err := engine.Select(engine.ConfigPath, exec.LookPath)
+	if err != nil {
+		check.Status = doctor.Fail
+		check.Detail = err.Error()
+		check.Hint = "run `viberun bootstrap` to install docker, or `viberun bootstrap --runtime podman`"
+		return check
+	}
+	containerEngine = selected
+	check.Name = containerEngine.Name
+	out, err := containerEngine.Command(containerEngine.VersionArgs()...).CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		check.Status = doctor.Fail
+		check.Detail = output
+		if check.Detail == "" {
+			check.Detail = err.Error()
+		}
+		if containerEngine.Name == engine.Podman {
+			check.Hint = "check `podman info` as this user"
+		} else if strings.Contains(output, "permission denied") {
+			check.Hint = "add your user to the docker group (`sudo usermod -aG docker $USER`) and reconnect"
+		} else {
+			check.Hint = "start the docker daemon (`sudo systemctl enable --now docker`)"
+		}
+		return check
+	}
+	check.Status = doctor.Pass
+	check.Detail = "server " + output
+	if containerEngine.Name == engine.Podman {
+		check.Detail = output
+	}
+	if containerEngine.Rootless() {
+		check.Detail += " (rootless)"
+	}
+	return check
+}
+
+func checkDockerGroup() (doctor.Check, bool) {
+	if os.Geteuid() == 0 {
+		return doctor.Check{}, false
+	}
+	check := doctor.Check{Name: "docker group"}
+	out, err := exec.Command("id", "-nG").Output()
+	if err != nil {
+		check.Status = doctor.Warn
+		check.Detail = err.Error()
+		return check, true
+	}
+	for _, group := range strings.Fields(string(out)) {
+		if group == "docker" {
+			check.Status = doctor.Pass
+			check.Detail = "user is in the docker group"
+			return check, true
+		}
+	}
+	check.Status = doctor.Fail
+	check.Detail = "user is not in the docker group"
+	check.Hint = "run `sudo usermod -aG docker $USER` and reconnect, or rerun `viberun bootstrap`"
+	return check, true
+}
+
+func checkImage() doctor.Check {
+	check := doctor.Check{Name: "image"}
+	imageArch, err := imageArchitecture(defaultImage)
+	if err != nil {
+		check.Status = doctor.Fail
+		check.Detail = defaultImage + " not found"
+		check.Hint = "run `viberun bootstrap` to pull the image"
+		return check
+	}
+	hostArch, err := hostArchitecture()
+	if err != nil {
+		check.Status = doctor.Warn
+		check.Detail = fmt.Sprintf("%s (%s); failed to read host architecture: %v", defaultImage, imageArch, err)
+		return check
+	}
+	if imageArch != hostArch {
+		check.Status = doctor.Fail
+		check.Detail = fmt.Sprintf("%s is %s but the host is %s", defaultImage, imageArch, hostArch)
+		check.Hint = "rerun `viberun bootstrap` to pull the image for this host"
+		return check
+	}
+	check.Status = doctor.Pass
+	check.Detail = fmt.Sprintf("%s (%s)", defaultImage, imageArch)
+	return check
+}
+
+// checkContainerArch reports app containers created from an image for another architecture.
+func checkContainerArch() []doctor.Check {
+	containers, err := listContainers()
+	if err != nil {
+		return nil
+	}
+	checks := []doctor.Check{}
+	for _, name := range containers {
+		if !strings.HasPrefix(name, "viberun-") {
+			continue
+		}
+		mismatch, imageArch, hostArch, err := containerArchMismatch(name)
+		if err != nil || !mismatch {
+			continue
+		}
+		app := strings.TrimPrefix(name, "viberun-")
+		checks = append(checks, doctor.Check{
+			Name:   "container " + app,
+			Status: doctor.Fail,
+			Detail: fmt.Sprintf("image is %s but the host is %s", imageArch, hostArch),
+			Hint:   fmt.Sprintf("run `viberun %s --delete -y` to recreate it with the correct image", app),
+		})
+	}
+	return checks
+}
+
+// checkReservedApps reports apps created before their name became a host command; the
+// server runs the command instead, so they cannot be reached by name.
+func checkReservedApps(containers []string) []doctor.Check {
+	checks := []doctor.Check{}
+	for _, name := range containers {
+		app, ok := strings.CutPrefix(name, "viberun-")
+		if !ok || !isHostCommand(app) {
+			continue
+		}
+		checks = append(checks, doctor.Check{
+			Name:   "container " + app,
+			Status: doctor.Warn,
+			Detail: fmt.Sprintf("%q is now a viberun-server command, so this app cannot be reached by name", app),
+			Hint:   fmt.Sprintf("rename it on the host with `%s rename %s viberun-%s-app`, then use `viberun %s-app`", containerEngine.Name, name, app, app),
+		})
+	}
+	return checks
+}
+
+func checkState() (*server.State, doctor.Check) {
+	check := doctor.Check{Name: "state"}
+	state, path, err := server.LoadState()
+	if err != nil {
+		check.Status = doctor.Fail
+		check.Detail = fmt.Sprintf("%s: %v", path, err)
+		check.Hint = "fix or move the state file; ports are rebuilt from running containers"
+		return nil, check
+	}
+	check.Status = doctor.Pass
+	check.Detail = fmt.Sprintf("%s (%d app(s))", path, len(state.Ports))
+	return &state, check
+}
+
+// checkPorts finds apps sharing a port and ports held by something other than the app.
+func checkPorts(state *server.State) doctor.Check {
+	check := doctor.Check{Name: "ports"}
+	byPort := map[int][]string{}
+	for app, port := range state.Ports {
+		byPort[port] = append(byPort[port], app)
+	}
+	problems := []string{}
+	for port, apps := range byPort {
+		if len(apps) > 1 {
+			sort.Strings(apps)
+			problems = append(problems, fmt.Sprintf("port %d is assigned to %s", port, strings.Join(apps, ", ")))
+			continue
+		}
+		running, err := containerRunning("viberun-" + apps[0])
+		if err == nil && running {
+			continue
+		}
+		if portInUse(port) {
+			problems = append(problems, fmt.Sprintf("port %d for %s is in use by another process", port, apps[0]))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		check.Status = doctor.Fail
+		check.Detail = strings.Join(problems, "; ")
+		check.Hint = "stop the conflicting process or remove the app's entry from the state file"
+		return check
+	}
+	check.Status = doctor.Pass
+	check.Detail = fmt.Sprintf("%d port(s) assigned, no conflicts", len(state.Ports))
+	return check
+}
+
+func portInUse(port int) bool {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return true
+	}
+	_ = listener.Close()
+	return false
+}
+
+// checkDisk reports free space where the engine keeps images and snapshots.
+func checkDisk() doctor.Check {
+	check := doctor.Check{Name: "disk"}
+	dir := "/var/lib/docker"
+	if out, err := containerEngine.Command(containerEngine.StorageRootArgs()...).Output(); err == nil {
+		if value := strings.TrimSpace(string(out)); value != "" {
+			dir = value
+		}
+	}
+	if _, err := os.Stat(dir); err != nil {
+		dir = "/"
+	}
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		check.Status = doctor.Warn
+		check.Detail = fmt.Sprintf("failed to read free space for %s: %v", dir, err)
+		return check
+	}
+	free := uint64(stat.Bavail) * uint64(stat.Bsize)
+	check.Detail = fmt.Sprintf("%s free on %s", formatBytes(free), dir)
+	switch {
+	case free < diskFailBytes:
+		check.Status = doctor.Fail
+		check.Hint = "free disk space (e.g. `docker system prune`) before taking snapshots"
+	case free < diskWarnBytes:
+		check.Status = doctor.Warn
+		check.Hint = "snapshots may fail when the disk fills up; consider `docker system prune`"
+	default:
+		check.Status = doctor.Pass
+	}
+	return check
+}
+
+func formatBytes(value uint64) string {
+	const unit = 1024
+	if value < unit {
+		return fmt.Sprintf("%d B", value)
+	}
+	div, exp := uint64(unit), 0
+	for n := value / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(value)/float64(div), "KMGTPE"[exp])
+}
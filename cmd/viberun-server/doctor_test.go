@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shayne/viberun/internal/doctor"
+	"github.com/shayne/viberun/internal/engine"
+	"github.com/shayne/viberun/internal/server"
+)
+
+func TestCheckPortsReportsDuplicates(t *testing.T) {
+	state := &server.State{Ports: map[string]int{"a": 8080, "b": 8080}}
+	check := checkPorts(state)
+	if check.Status != doctor.Fail || !strings.Contains(check.Detail, "port 8080 is assigned to a, b") {
+		t.Fatalf("unexpected ports check: %+v", check)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[uint64]string{
+		512:            "512 B",
+		2048:           "2.0 KiB",
+		5 << 30:        "5.0 GiB",
+		1536 * 1 << 20: "1.5 GiB",
+	}
+	for value, want := range cases {
+		if got := formatBytes(value); got != want {
+			t.Fatalf("formatBytes(%d) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestHostCommandsAreReserved(t *testing.T) {
+	for _, name := range []string{"doctor", "version"} {
+		if !isHostCommand(name) {
+			t.Fatalf("expected %s to be a host command", name)
+		}
+	}
+	if isHostCommand("myapp") {
+		t.Fatalf("unexpected host command myapp")
+	}
+}
+
+func TestCheckReservedApps(t *testing.T) {
+	containerEngine = engine.New(engine.Docker)
+	checks := checkReservedApps([]string{"viberun-myapp", "viberun-ls", "viberun-proxy", "other"})
+	if len(checks) != 2 {
+		t.Fatalf("expected two reserved app checks, got %+v", checks)
+	}
+	if checks[0].Name != "container ls" || checks[0].Status != doctor.Warn || !strings.Contains(checks[0].Hint, "docker rename viberun-ls viberun-ls-app") {
+		t.Fatalf("unexpected check: %+v", checks[0])
+	}
+}
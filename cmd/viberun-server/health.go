@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shayne/viberun/internal/engine"
+	"github.com/shayne/viberun/internal/server"
+)
+
+const healthProbeTimeout = 5 * time.Second
+
+// healthResult is the outcome of one health probe.
+type healthResult struct {
+	Healthy bool
+	Detail  string
+}
+
+func (r healthResult) String() string {
+	if r.Healthy {
+		return "healthy (" + r.Detail + ")"
+	}
+	return "unhealthy (" + r.Detail + ")"
+}
+
+// probeHealth runs check against the app through its published port or, when the host
+// cannot reach that port, from inside the container.
+func probeHealth(containerName string, port int, check server.HealthCheck) healthResult {
+	status, err := probeHTTP(fmt.Sprintf("http://127.0.0.1:%d%s", port, check.Path))
+	if err != nil {
+		status, err = probeExec(containerName, check.Path)
+	}
+	if err != nil {
+		return healthResult{Detail: fmt.Sprintf("no response from %s", check.Path)}
+	}
+	if status != check.Status {
+		return healthResult{Detail: fmt.Sprintf("%s returned %d, expected %d", check.Path, status, check.Status)}
+	}
+	return healthResult{Healthy: true, Detail: fmt.Sprintf("%s returned %d", check.Path, status)}
+}
+
+func probeHTTP(rawURL string) (int, error) {
+	client := &http.Client{
+		Timeout: healthProbeTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func probeExec(containerName string, path string) (int, error) {
+	timeout := strconv.Itoa(int(healthProbeTimeout / time.Second))
+	out, _ := containerEngine.Command("exec", containerName, "curl", "-s", "-o", "/dev/null", "-m", timeout, "-w", "%{http_code}", appHealthURL(path)).Output()
+	status, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil || status == 0 {
+		return 0, fmt.Errorf("no response")
+	}
+	return status, nil
+}
+
+func appHealthURL(path string) string {
+	return "http://localhost:8080" + path
+}
+
+// healthCheckArgs returns the run flags that install check as the container's
+// HEALTHCHECK. Validate keeps quotes and shell syntax out of the path.
+func healthCheckArgs(check server.HealthCheck) []string {
+	command := fmt.Sprintf(`test "$(curl -s -o /dev/null -m %d -w '%%{http_code}' '%s')" = %d`,
+		int(healthProbeTimeout/time.Second), appHealthURL(check.Path), check.Status)
+	return []string{
+		"--health-cmd", command,
+		"--health-interval", check.Interval.String(),
+		"--health-timeout", (2 * healthProbeTimeout).String(),
+		"--health-retries", "3",
+	}
+}
+
+// engineHealth returns the engine's HEALTHCHECK status for a container, or "" when it
+// has none.
+func engineHealth(containerName string) string {
+	for _, format := range engineHealthFormats(containerEngine.Name) {
+		out, err := containerEngine.Command("inspect", "-f", format, containerName).Output()
+		if err == nil {
+			return strings.TrimSpace(string(out))
+		}
+	}
+	return ""
+}
+
+// engineHealthFormats returns the inspect templates that read the HEALTHCHECK status,
+// in the order to try them. Podman before 4 names the field Healthcheck, and a template
+// naming a missing field fails, so podman tries both.
+func engineHealthFormats(name string) []string {
+	health := "{{if .State.Health}}{{.State.Health.Status}}{{end}}"
+	if name == engine.Podman {
+		return []string{health, "{{if .State.Healthcheck}}{{.State.Healthcheck.Status}}{{end}}"}
+	}
+	return []string{health}
+}
+
+// runHealthAction shows, sets or removes an app's health check.
+func runHealthAction(app string, containerName string, exists bool, port int, state *server.State, statePath string, args []string) error {
+	switch {
+	case len(args) == 0:
+		check, ok := state.HealthForApp(app)
+		if !ok {
+			fmt.Fprintf(os.Stdout, "No health check for %s\n", app)
+			return nil
+		}
+		fmt.Fprintf(os.Stdout, "Health check for %s: %s\n", app, check)
+		if check.Docker {
+			fmt.Fprintln(os.Stdout, "Installed as the container HEALTHCHECK when the container is created")
+		}
+		if exists {
+			fmt.Fprintf(os.Stdout, "Now: %s\n", probeHealth(containerName, port, check))
+		}
+		return nil
+	case args[0] == "set":
+		check, err := parseHealthCheck(args[1:])
+		if err != nil {
+			return err
+		}
+		state.SetHealth(app, check)
+		if err := server.SaveState(statePath, *state); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "Health check for %s: %s\n", app, check)
+		if check.Docker && exists {
+			fmt.Fprintf(os.Stdout, "The container HEALTHCHECK is installed when the container is next created, e.g. by: viberun %s restore latest\n", app)
+		}
+		return nil
+	case args[0] == "rm":
+		if !state.RemoveHealth(app) {
+			return fmt.Errorf("no health check for %s", app)
+		}
+		if err := server.SaveState(statePath, *state); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "Removed health check for %s\n", app)
+		return nil
+	default:
+		return fmt.Errorf("unknown health action %q", args[0])
+	}
+}
+
+// runProbeAction checks once that the app answers on its port, so `viberun <app> open`
+// can fail at once instead of waiting on a forward to an app that is not running.
+func runProbeAction(app string, containerName string, exists bool, port int) error {
+	if !exists {
+		return fmt.Errorf("app container does not exist")
+	}
+	running, err := containerRunning(containerName)
+	if err != nil {
+		return fmt.Errorf("failed to check container state: %w", err)
+	}
+	if !running {
+		return fmt.Errorf("app container is not running; start it with viberun %s", app)
+	}
+	if _, err := probeHTTP(fmt.Sprintf("http://127.0.0.1:%d/", port)); err == nil {
+		return nil
+	}
+	if _, err := probeExec(containerName, "/"); err == nil {
+		return nil
+	}
+	return fmt.Errorf("nothing is answering on port 8080 in the container; start the app and try again")
+}
+
+// parseHealthCheck parses "<path> [status] [interval] [docker]" as sent by the client.
+func parseHealthCheck(args []string) (server.HealthCheck, error) {
+	if len(args) == 0 {
+		return server.HealthCheck{}, fmt.Errorf("missing health path")
+	}
+	check := server.HealthCheck{Path: args[0], Status: server.DefaultHealthStatus, Interval: server.DefaultHealthInterval}
+	for _, arg := range args[1:] {
+		if arg == "docker" {
+			check.Docker = true
+			continue
+		}
+		if status, err := strconv.Atoi(arg); err == nil {
+			check.Status = status
+			continue
+		}
+		interval, err := time.ParseDuration(arg)
+		if err != nil {
+			return server.HealthCheck{}, fmt.Errorf("invalid health argument %q", arg)
+		}
+		check.Interval = interval
+	}
+	return check, check.Validate()
+}
+
+// runStatusAction prints the app's container state, port and health.
+func runStatusAction(app string, containerName string, exists bool, port int, state *server.State) error {
+	fmt.Fprintf(os.Stdout, "App:       %s\n", app)
+	running := false
+	if !exists {
+		fmt.Fprintln(os.Stdout, "Container: not created")
+	} else {
+		var err error
+		running, err = containerRunning(containerName)
+		if err != nil {
+			return fmt.Errorf("failed to check container state: %w", err)
+		}
+		stateText := "stopped"
+		if running {
+			stateText = "running"
+		}
+		fmt.Fprintf(os.Stdout, "Container: %s (%s)\n", stateText, containerName)
+	}
+	if exists {
+		fmt.Fprintf(os.Stdout, "Port:      %d\n", port)
+	}
+	check, ok := state.HealthForApp(app)
+	switch {
+	case !ok:
+		fmt.Fprintln(os.Stdout, "Health:    no check (set one with: viberun "+app+" health set /healthz)")
+	case !running:
+		fmt.Fprintf(os.Stdout, "Health:    not checked, container is not running (%s)\n", check)
+	default:
+		fmt.Fprintf(os.Stdout, "Health:    %s\n", probeHealth(containerName, port, check))
+	}
+	if running {
+		if status := engineHealth(containerName); status != "" {
+			fmt.Fprintf(os.Stdout, "Engine:    %s reports %s\n", containerEngine.Name, status)
+		}
+	}
+	return nil
+}
+
+// appListing is one row of `viberun-server ls`.
+type appListing struct {
+	App    string
+	Port   int
+	State  string
+	Health string
+}
+
+// runList prints every app on the host with its port, container state and health.
+func runList() error {
+	selected, err := engine.Select(engine.ConfigPath, exec.LookPath)
+	if err != nil {
+		return err
+	}
+	containerEngine = selected
+	state, _, err := server.LoadState()
+	if err != nil {
+		return fmt.Errorf("failed to load server state: %w", err)
+	}
+	out, err := containerEngine.Command("ps", "-a", "--format", "{{.Names}}\t{{.State}}").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+	states := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		name, containerState, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if app, isApp := strings.CutPrefix(name, "viberun-"); ok && isApp && app != "" {
+			states[app] = containerState
+		}
+	}
+	apps := map[string]bool{}
+	for app := range state.Ports {
+		apps[app] = true
+	}
+	for app := range states {
+		apps[app] = true
+	}
+	listings := make([]appListing, 0, len(apps))
+	for app := range apps {
+		containerState := states[app]
+		if containerState == "" {
+			containerState = "not created"
+		}
+		listings = append(listings, appListing{App: app, Port: state.Ports[app], State: containerState, Health: "-"})
+	}
+	sort.Slice(listings, func(i, j int) bool { return listings[i].App < listings[j].App })
+	if len(listings) == 0 {
+		fmt.Fprintln(os.Stdout, "No apps")
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := range listings {
+		check, ok := state.HealthForApp(listings[i].App)
+		if !ok || listings[i].State != "running" {
+			continue
+		}
+		wg.Add(1)
+		go func(listing *appListing) {
+			defer wg.Done()
+			result := probeHealth("viberun-"+listing.App, listing.Port, check)
+			listing.Health = "healthy"
+			if !result.Healthy {
+				listing.Health = "unhealthy: " + result.Detail
+			}
+		}(&listings[i])
+	}
+	wg.Wait()
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "APP\tPORT\tSTATE\tHEALTH")
+	for _, listing := range listings {
+		port := "-"
+		if listing.Port > 0 {
+			port = strconv.Itoa(listing.Port)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", listing.App, port, listing.State, listing.Health)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	for _, listing := range listings {
+		if isHostCommand(listing.App) {
+			fmt.Fprintf(os.Stdout, "warning: %q is a viberun-server command, so app %s cannot be reached by name; see viberun doctor\n", listing.App, listing.App)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shayne/viberun/internal/engine"
+	"github.com/shayne/viberun/internal/server"
+)
+
+func TestParseActionHealth(t *testing.T) {
+	cases := []struct {
+		args   []string
+		action string
+		rest   []string
+	}{
+		{[]string{"status"}, "status", nil},
+		{[]string{"probe"}, "probe", nil},
+		{[]string{"health"}, "health", nil},
+		{[]string{"health", "rm"}, "health", []string{"rm"}},
+		{[]string{"health", "set", "/healthz", "204"}, "health", []string{"set", "/healthz", "204"}},
+	}
+	for _, tc := range cases {
+		action, rest, err := parseAction(tc.args)
+		if err != nil {
+			t.Fatalf("%v: parse: %v", tc.args, err)
+		}
+		if action != tc.action || !reflect.DeepEqual(rest, tc.rest) {
+			t.Fatalf("%v: got %q %v", tc.args, action, rest)
+		}
+	}
+	if _, _, err := parseAction([]string{"health", "set"}); err == nil {
+		t.Fatalf("expected error for health set without a path")
+	}
+}
+
+func TestRunProbeActionWithoutContainer(t *testing.T) {
+	if err := runProbeAction("myapp", "viberun-myapp", false, 8080); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("expected a missing container error, got %v", err)
+	}
+}
+
+func TestEngineHealthFormats(t *testing.T) {
+	docker := engineHealthFormats(engine.Docker)
+	if len(docker) != 1 || !strings.Contains(docker[0], ".State.Health.Status") {
+		t.Fatalf("unexpected docker formats %q", docker)
+	}
+	podman := engineHealthFormats(engine.Podman)
+	if len(podman) != 2 || !strings.Contains(podman[1], ".State.Healthcheck.Status") {
+		t.Fatalf("unexpected podman formats %q", podman)
+	}
+}
+
+func TestParseHealthCheck(t *testing.T) {
+	check, err := parseHealthCheck([]string{"/healthz"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := server.HealthCheck{Path: "/healthz", Status: server.DefaultHealthStatus, Interval: server.DefaultHealthInterval}
+	if check != want {
+		t.Fatalf("expected %+v, got %+v", want, check)
+	}
+	check, err = parseHealthCheck([]string{"/ready", "204", "1m0s", "docker"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want = server.HealthCheck{Path: "/ready", Status: 204, Interval: time.Minute, Docker: true}
+	if check != want {
+		t.Fatalf("expected %+v, got %+v", want, check)
+	}
+	for _, args := range [][]string{{"healthz"}, {"/healthz", "nope"}, {"/healthz", "700"}, {"/x';rm -rf /"}} {
+		if _, err := parseHealthCheck(args); err == nil {
+			t.Fatalf("expected error for %v", args)
+		}
+	}
+}
+
+func TestDockerRunArgsHealthCheck(t *testing.T) {
+	check := server.HealthCheck{Path: "/healthz", Status: 200, Interval: 30 * time.Second, Docker: true}
+	args := dockerRunArgs("viberun-app", "app", 8080, "viberun:latest", check)
+	index := slices.Index(args, "--health-cmd")
+	if index < 0 || !strings.Contains(args[index+1], "'http://localhost:8080/healthz'") || !strings.HasSuffix(args[index+1], "= 200") {
+		t.Fatalf("expected health command in %v", args)
+	}
+	if i := slices.Index(args, "--health-interval"); i < 0 || args[i+1] != "30s" {
+		t.Fatalf("expected health interval in %v", args)
+	}
+	if slices.Index(args, "--health-cmd") > slices.Index(args, "viberun:latest") {
+		t.Fatalf("expected health flags before the image: %v", args)
+	}
+	check.Docker = false
+	if slices.Contains(dockerRunArgs("viberun-app", "app", 8080, "viberun:latest", check), "--health-cmd") {
+		t.Fatalf("expected no health command without docker")
+	}
+}
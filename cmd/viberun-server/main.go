@@ -2,8 +2,11 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"regexp"
@@ -14,20 +17,31 @@ import (
 
 	"golang.org/x/term"
 
+	"github.com/shayne/viberun/internal/agents"
+	"github.com/shayne/viberun/internal/authbundle"
+	"github.com/shayne/viberun/internal/engine"
 	"github.com/shayne/viberun/internal/server"
+	"github.com/shayne/viberun/internal/version"
 	"github.com/shayne/yargs"
 )
 
 const defaultImage = "viberun:latest"
 
+const usage = "Usage: viberun-server bootstrap [--check] | viberun-server doctor | viberun-server version | viberun-server ls | viberun-server proxy [--listen addr] [--domain domain] [--share-listen addr] | viberun-server [--agent provider] <app> [snapshot|snapshots|restore <snapshot>|shell|port|address [port]|delete|exists|auth status [provider]|auth push [--dry-run] [provider]|auth pull [provider]|secrets ls|secrets set <name>|secrets rm <name>|share [ttl]|shares|shares rm <id>|prompt|probe|status|health|health set <path> [status] [interval] [docker]|health rm]"
+
 type serverFlags struct {
-	Agent string `flag:"agent" help:"agent provider to run (codex, claude, gemini)"`
+	Agent       string `flag:"agent" help:"agent provider to run (codex, claude, gemini)"`
+	DryRun      bool   `flag:"dry-run" help:"show auth changes without applying them"`
+	Check       bool   `flag:"check" help:"with bootstrap, report drift without changing anything"`
+	Listen      string `flag:"listen" help:"with proxy, address to listen on (default 127.0.0.1:8000; pass :8000 to serve other machines)"`
+	Domain      string `flag:"domain" help:"with proxy, route <app>.<domain> to each app"`
+	ShareListen string `flag:"share-listen" help:"with proxy, address that serves share links (default :8001)"`
 }
 
 func main() {
 	args := os.Args[1:]
 	if len(args) == 0 || hasHelpFlag(args) {
-		fmt.Fprintln(os.Stderr, "Usage: viberun-server [--agent provider] <app> [snapshot|snapshots|restore <snapshot>|shell|port|delete|exists]")
+		fmt.Fprintln(os.Stderr, usage)
 		os.Exit(2)
 	}
 	result, err := yargs.ParseFlags[serverFlags](args)
@@ -36,23 +50,30 @@ func main() {
 		os.Exit(2)
 	}
 
-	if len(result.Args) < 1 || len(result.Args) > 3 {
-		fmt.Fprintln(os.Stderr, "Usage: viberun-server [--agent provider] <app> [snapshot|snapshots|restore <snapshot>|shell|port|delete|exists]")
-		os.Exit(2)
-	}
-	args = result.Args
-	app := strings.TrimSpace(args[0])
-	if app == "" {
-		fmt.Fprintln(os.Stderr, "app name is required")
-		os.Exit(2)
+	if len(result.Args) == 1 && isHostCommand(result.Args[0]) {
+		if err := runHostCommand(result.Args[0], result.Flags); err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", result.Args[0], err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	action, actionArgs, err := parseAction(args[1:])
+	app, action, actionArgs, err := parseAppArgs(result.Args)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(2)
 	}
 
+	var authBundle *authbundle.Bundle
+	if action == "" {
+		// Take the staged bundle first so it is wiped no matter how the session ends.
+		authBundle, err = takeStagedAuthBundle()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load auth bundle: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	agentProvider := strings.TrimSpace(result.Flags.Agent)
 	if agentProvider == "" {
 		agentProvider = "codex"
@@ -69,8 +90,9 @@ func main() {
 	}
 	agentArgs = tmuxSessionArgs(sessionName, agentArgs)
 
-	if _, err := exec.LookPath("docker"); err != nil {
-		fmt.Fprintln(os.Stderr, "docker is required but was not found in PATH")
+	containerEngine, err = engine.Select(engine.ConfigPath, exec.LookPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 
@@ -99,6 +121,57 @@ func main() {
 		return
 	}
 
+	if action == "address" {
+		if !exists {
+			fmt.Fprintln(os.Stderr, "app container does not exist")
+			os.Exit(1)
+		}
+		if len(actionArgs) == 1 {
+			port, _ := strconv.Atoi(actionArgs[0])
+			target, err := forwardTarget(containerName, port)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to resolve port %d: %v\n", port, err)
+				os.Exit(1)
+			}
+			fmt.Fprintln(os.Stdout, target)
+			return
+		}
+		address, err := containerAddress(containerName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read container address: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stdout, address)
+		return
+	}
+
+	if action == "auth" {
+		if err := runAuthAction(containerName, app, exists, agentProvider, actionArgs, result.Flags.DryRun); err != nil {
+			fmt.Fprintf(os.Stderr, "auth %s failed: %v\n", actionArgs[0], err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if action == "secrets" {
+		if err := runSecretsAction(containerName, app, exists, actionArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "secrets %s failed: %v\n", actionArgs[0], err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if action == "prompt" {
+		if err := runPromptAction(containerName, app, exists, agentProvider); err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				os.Exit(exitErr.ExitCode())
+			}
+			fmt.Fprintf(os.Stderr, "prompt failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if action == "snapshot" {
 		if !exists {
 			fmt.Fprintln(os.Stderr, "cannot snapshot: app container does not exist")
@@ -167,16 +240,52 @@ func main() {
 		return
 	}
 
+	if action == "status" {
+		if err := runStatusAction(app, containerName, exists, port, &state); err != nil {
+			fmt.Fprintf(os.Stderr, "status failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if action == "probe" {
+		if err := runProbeAction(app, containerName, exists, port); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if action == "health" {
+		if err := runHealthAction(app, containerName, exists, port, &state, statePath, actionArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "health failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if action == "share" || action == "shares" {
+		if err := runShareAction(action, app, exists, &state, statePath, actionArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", action, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if action == "restore" {
 		ref, err := resolveSnapshotRef(app, actionArgs[0])
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to resolve snapshot: %v\n", err)
 			os.Exit(1)
 		}
-		if err := restoreSnapshot(containerName, app, port, ref); err != nil {
+		health, _ := state.HealthForApp(app)
+		if err := restoreSnapshot(containerName, app, port, ref, health); err != nil {
 			fmt.Fprintf(os.Stderr, "failed to restore snapshot: %v\n", err)
 			os.Exit(1)
 		}
+		if err := refreshSecrets(containerName, app); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to write secrets: %v\n", err)
+		}
 		if stateDirty {
 			if err := server.SaveState(statePath, state); err != nil {
 				fmt.Fprintf(os.Stderr, "failed to save server state: %v\n", err)
@@ -195,7 +304,8 @@ func main() {
 			}
 		}
 
-		if err := dockerRun(containerName, app, port); err != nil {
+		health, _ := state.HealthForApp(app)
+		if err := dockerRun(containerName, app, port, health); err != nil {
 			fmt.Fprintf(os.Stderr, "failed to create container: %v\n", err)
 			os.Exit(1)
 		}
@@ -230,19 +340,24 @@ func main() {
 		os.Exit(1)
 	}
 
-	authBundle, err := loadAuthBundleFromEnv()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to load auth bundle: %v\n", err)
-		os.Exit(1)
+	if err := refreshSecrets(containerName, app); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to write secrets: %v\n", err)
 	}
+
 	if !exists && authBundle != nil {
-		if err := applyAuthBundle(containerName, authBundle); err != nil {
+		if err := applyAuthBundle(containerName, app, authBundle, "create", false); err != nil {
 			fmt.Fprintf(os.Stderr, "failed to apply auth bundle: %v\n", err)
 			os.Exit(1)
 		}
 	}
 
-	if err := dockerExec(containerName, agentArgs); err != nil {
+	// The client serves the session socket; it forwards ports the container opens.
+	if socketPath := strings.TrimSpace(os.Getenv("VIBERUN_XDG_OPEN_SOCKET")); socketPath != "" {
+		go watchPorts(containerName, sessionName, socketPath)
+	}
+
+	health, _ := state.HealthForApp(app)
+	if err := dockerExec(containerName, agentArgs, health); err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			os.Exit(exitErr.ExitCode())
 		}
@@ -251,6 +366,71 @@ func main() {
 	}
 }
 
+// containerEngine runs docker or podman; main selects it for the host before any app action.
+var containerEngine = engine.New(engine.Docker)
+
+// hostCommands are host-level commands; these names cannot be used as app names. It is
+// set in init because doctor and ls look names up in it to report apps they shadow.
+var hostCommands map[string]func(flags serverFlags) error
+
+func init() {
+	hostCommands = map[string]func(flags serverFlags) error{
+		"bootstrap": runBootstrap,
+		"doctor":    func(serverFlags) error { return runDoctor() },
+		"version":   func(serverFlags) error { return runVersion() },
+		"proxy":     runProxy,
+		"ls":        func(serverFlags) error { return runList() },
+	}
+}
+
+// serverCapabilities lists what this server supports, for `viberun-server version`.
+var serverCapabilities = []string{
+	version.CapabilityVersion,
+	version.CapabilityDoctor,
+	version.CapabilityBootstrap,
+	version.CapabilityAuth,
+	version.CapabilityAuthStage,
+	version.CapabilityAuthDry,
+	version.CapabilitySecrets,
+	version.CapabilityProxy,
+	version.CapabilityForward,
+	version.CapabilityShare,
+	version.CapabilityHealth,
+	version.CapabilityPrompt,
+	version.CapabilityForwardTarget,
+	version.CapabilityProbe,
+}
+
+func runVersion() error {
+	return json.NewEncoder(os.Stdout).Encode(version.Current(serverCapabilities))
+}
+
+func isHostCommand(name string) bool {
+	_, ok := hostCommands[name]
+	return ok
+}
+
+func runHostCommand(name string, flags serverFlags) error {
+	return hostCommands[name](flags)
+}
+
+// parseAppArgs splits "<app> [action args...]"; parseAction bounds the argument
+// count of each action.
+func parseAppArgs(args []string) (string, string, []string, error) {
+	if len(args) < 1 {
+		return "", "", nil, errors.New(usage)
+	}
+	app := strings.TrimSpace(args[0])
+	if app == "" {
+		return "", "", nil, errors.New("app name is required")
+	}
+	action, actionArgs, err := parseAction(args[1:])
+	if err != nil {
+		return "", "", nil, err
+	}
+	return app, action, actionArgs, nil
+}
+
 func parseAction(args []string) (string, []string, error) {
 	if len(args) == 0 {
 		return "", nil, nil
@@ -270,13 +450,69 @@ func parseAction(args []string) (string, []string, error) {
 	if len(args) == 1 && args[0] == "exists" {
 		return "exists", nil, nil
 	}
+	if len(args) == 1 && args[0] == "address" {
+		return "address", nil, nil
+	}
+	if len(args) == 2 && args[0] == "address" {
+		if port, err := strconv.Atoi(args[1]); err != nil || port <= 0 || port > 65535 {
+			return "", nil, fmt.Errorf("invalid port %q", args[1])
+		}
+		return "address", args[1:], nil
+	}
 	if len(args) == 1 && args[0] == "delete" {
 		return "delete", nil, nil
 	}
+	if len(args) <= 2 && args[0] == "share" {
+		return "share", args[1:], nil
+	}
+	if len(args) == 1 && args[0] == "prompt" {
+		return "prompt", nil, nil
+	}
+	if len(args) == 1 && args[0] == "probe" {
+		return "probe", nil, nil
+	}
+	if len(args) == 1 && args[0] == "status" {
+		return "status", nil, nil
+	}
+	if len(args) == 1 && args[0] == "health" {
+		return "health", nil, nil
+	}
+	if len(args) == 2 && args[0] == "health" && args[1] == "rm" {
+		return "health", []string{"rm"}, nil
+	}
+	if len(args) >= 3 && len(args) <= 6 && args[0] == "health" && args[1] == "set" {
+		return "health", args[1:], nil
+	}
+	if len(args) == 1 && args[0] == "shares" {
+		return "shares", nil, nil
+	}
+	if len(args) == 3 && args[0] == "shares" && args[1] == "rm" && strings.TrimSpace(args[2]) != "" {
+		return "shares", []string{"rm", strings.TrimSpace(args[2])}, nil
+	}
 	if len(args) == 2 && args[0] == "restore" && strings.TrimSpace(args[1]) != "" {
 		return "restore", []string{strings.TrimSpace(args[1])}, nil
 	}
-	return "", nil, fmt.Errorf("Usage: viberun-server [--agent provider] <app> [snapshot|snapshots|restore <snapshot>|shell|port|delete|exists]")
+	if len(args) == 2 && args[0] == "secrets" && args[1] == "ls" {
+		return "secrets", []string{"ls"}, nil
+	}
+	if len(args) == 3 && args[0] == "secrets" && (args[1] == "set" || args[1] == "rm") {
+		name := strings.TrimSpace(args[2])
+		if !server.ValidSecretName(name) {
+			return "", nil, fmt.Errorf("invalid secret name %q", args[2])
+		}
+		return "secrets", []string{args[1], name}, nil
+	}
+	if len(args) >= 2 && len(args) <= 3 && args[0] == "auth" {
+		switch args[1] {
+		case "status", "push", "pull", "fanout", "stage":
+			authArgs := []string{args[1]}
+			if len(args) == 3 && strings.TrimSpace(args[2]) != "" {
+				authArgs = append(authArgs, strings.TrimSpace(args[2]))
+			}
+			return "auth", authArgs, nil
+		}
+	}
+	return "", nil, errors.New(usage)
 }
 
 func hasHelpFlag(args []string) bool {
@@ -331,7 +567,7 @@ func promptCreateWithReader(app string, in io.Reader, out io.Writer) bool {
 }
 
 func containerExists(name string) (bool, error) {
-	cmd := exec.Command("docker", "inspect", name)
+	cmd := containerEngine.Command("container", "inspect", name)
 	if err := cmd.Run(); err != nil {
 		if _, ok := err.(*exec.ExitError); ok {
 			return false, nil
@@ -342,15 +578,48 @@ func containerExists(name string) (bool, error) {
 }
 
 func containerRunning(name string) (bool, error) {
-	out, err := exec.Command("docker", "inspect", "-f", "{{.State.Running}}", name).Output()
+	out, err := containerEngine.Command("inspect", "-f", "{{.State.Running}}", name).Output()
 	if err != nil {
 		return false, err
 	}
 	return strings.TrimSpace(string(out)) == "true", nil
 }
 
+// containerAddress returns the container's IP on its first network, which the host can
+// reach for ports the container does not publish.
+func containerAddress(name string) (string, error) {
+	out, err := containerEngine.Command("inspect", "-f", "{{range .NetworkSettings.Networks}}{{.IPAddress}} {{end}}", name).Output()
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("container has no network address; is it running?")
+	}
+	return fields[0], nil
+}
+
+// forwardTarget returns where the host reaches a container port: 127.0.0.1 and the
+// published port when it has one, otherwise the container's address. Rootless engines
+// do not route from the host to container addresses, so there only published ports work.
+func forwardTarget(name string, port int) (string, error) {
+	if out, err := containerEngine.Command("port", name, fmt.Sprintf("%d/tcp", port)).Output(); err == nil {
+		if published, ok := parsePortMapping(string(out)); ok {
+			return net.JoinHostPort("127.0.0.1", strconv.Itoa(published)), nil
+		}
+	}
+	if containerEngine.Rootless() {
+		return "", fmt.Errorf("port %d is not published, and rootless %s containers cannot be reached from the host by address", port, containerEngine.Name)
+	}
+	address, err := containerAddress(name)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(address, strconv.Itoa(port)), nil
+}
+
 func containerPort(name string) (int, bool, error) {
-	out, err := exec.Command("docker", "port", name, "8080/tcp").Output()
+	out, err := containerEngine.Command("port", name, "8080/tcp").Output()
 	if err != nil {
 		return 0, false, err
 	}
@@ -412,7 +681,7 @@ func syncPortsFromContainers(state *server.State) (bool, error) {
 }
 
 func listContainers() ([]string, error) {
-	out, err := exec.Command("docker", "ps", "-a", "--format", "{{.Names}}").Output()
+	out, err := containerEngine.Command("ps", "-a", "--format", "{{.Names}}").Output()
 	if err != nil {
 		return nil, err
 	}
@@ -428,22 +697,22 @@ func listContainers() ([]string, error) {
 	return names, nil
 }
 
-func dockerRun(name string, app string, port int) error {
-	args := dockerRunArgs(name, app, port, defaultImage)
-	cmd := exec.Command("docker", args...)
+func dockerRun(name string, app string, port int, health server.HealthCheck) error {
+	args := dockerRunArgs(name, app, port, defaultImage, health)
+	cmd := containerEngine.Command(args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
 func dockerStart(name string) error {
-	cmd := exec.Command("docker", "start", name)
+	cmd := containerEngine.Command("start", name)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
-func dockerExec(name string, agentArgs []string) error {
+func dockerExec(name string, agentArgs []string, health server.HealthCheck) error {
 	if len(agentArgs) == 0 {
 		agentArgs = []string{"/bin/bash"}
 	}
@@ -458,8 +727,18 @@ func dockerExec(name string, agentArgs []string) error {
 	if agentCheck := strings.TrimSpace(os.Getenv("VIBERUN_AGENT_CHECK")); agentCheck != "" {
 		env["VIBERUN_AGENT_CHECK"] = agentCheck
 	}
+	// The client's end of the port forward, when it differs from VIBERUN_HOST_PORT.
+	if localPort := strings.TrimSpace(os.Getenv("VIBERUN_LOCAL_PORT")); localPort != "" {
+		env["VIBERUN_LOCAL_PORT"] = localPort
+	}
+	// The tmux status line reports the app unhealthy when its health check fails.
+	if health.Path != "" {
+		env["VIBERUN_HEALTH_PATH"] = health.Path
+		env["VIBERUN_HEALTH_STATUS"] = strconv.Itoa(health.Status)
+		env["VIBERUN_HEALTH_INTERVAL"] = strconv.Itoa(int(health.Interval / time.Second))
+	}
 	args := dockerExecArgs(name, agentArgs, tty, env)
-	cmd := exec.Command("docker", args...)
+	cmd := containerEngine.Command(args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -522,7 +801,7 @@ func containerArchMismatch(name string) (bool, string, string, error) {
 }
 
 func containerImageID(name string) (string, error) {
-	out, err := exec.Command("docker", "inspect", "-f", "{{.Image}}", name).Output()
+	out, err := containerEngine.Command("inspect", "-f", "{{.Image}}", name).Output()
 	if err != nil {
 		return "", err
 	}
@@ -530,7 +809,7 @@ func containerImageID(name string) (string, error) {
 }
 
 func imageArchitecture(image string) (string, error) {
-	out, err := exec.Command("docker", "image", "inspect", "-f", "{{.Architecture}}", image).Output()
+	out, err := containerEngine.Command("image", "inspect", "-f", "{{.Architecture}}", image).Output()
 	if err != nil {
 		return "", err
 	}
@@ -557,7 +836,7 @@ func containerLogsTail(name string, lines int) (string, error) {
 	if lines < 1 {
 		lines = 1
 	}
-	out, err := exec.Command("docker", "logs", "--tail", strconv.Itoa(lines), name).CombinedOutput()
+	out, err := containerEngine.Command("logs", "--tail", strconv.Itoa(lines), name).CombinedOutput()
 	if err != nil {
 		return "", err
 	}
@@ -571,7 +850,7 @@ func snapshotRepo(app string) string {
 func deleteApp(containerName string, app string, state *server.State, exists bool) (bool, error) {
 	removed := false
 	if exists {
-		cmd := exec.Command("docker", "rm", "-f", containerName)
+		cmd := containerEngine.Command("rm", "-f", containerName)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		if err := cmd.Run(); err != nil {
@@ -586,7 +865,7 @@ func deleteApp(containerName string, app string, state *server.State, exists boo
 		repo := snapshotRepo(app)
 		for _, tag := range tags {
 			ref := fmt.Sprintf("%s:%s", repo, tag)
-			cmd := exec.Command("docker", "rmi", "-f", ref)
+			cmd := containerEngine.Command("rmi", "-f", ref)
 			cmd.Stdout = os.Stdout
 			cmd.Stderr = os.Stderr
 			if err := cmd.Run(); err != nil {
@@ -597,6 +876,11 @@ func deleteApp(containerName string, app string, state *server.State, exists boo
 	if state != nil {
 		removed = state.RemoveApp(app)
 	}
+	if secrets, err := server.LoadSecrets(); err == nil && secrets.RemoveApp(app) {
+		if err := secrets.Save(); err != nil {
+			return removed, err
+		}
+	}
 	return removed, nil
 }
 
@@ -604,7 +888,7 @@ func createSnapshot(containerName string, app string) (string, error) {
 	repo := snapshotRepo(app)
 	tag := time.Now().UTC().Format("20060102-150405")
 	ref := fmt.Sprintf("%s:%s", repo, tag)
-	cmd := exec.Command("docker", "commit", containerName, ref)
+	cmd := containerEngine.Command(containerEngine.CommitArgs(containerName, ref)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
@@ -629,7 +913,7 @@ func resolveSnapshotRef(app string, name string) (string, error) {
 
 func listSnapshots(app string) ([]string, error) {
 	repo := snapshotRepo(app)
-	out, err := exec.Command("docker", "images", "--format", "{{.Tag}}", repo).Output()
+	out, err := containerEngine.Command("images", "--format", "{{.Tag}}", repo).Output()
 	if err != nil {
 		return nil, err
 	}
@@ -647,7 +931,7 @@ func listSnapshots(app string) ([]string, error) {
 
 func latestSnapshotRef(app string) (string, error) {
 	repo := snapshotRepo(app)
-	out, err := exec.Command("docker", "images", "--format", "{{.Tag}}", repo).Output()
+	out, err := containerEngine.Command("images", "--format", "{{.Tag}}", repo).Output()
 	if err != nil {
 		return "", err
 	}
@@ -666,16 +950,18 @@ func latestSnapshotRef(app string) (string, error) {
 	return fmt.Sprintf("%s:%s", repo, tags[len(tags)-1]), nil
 }
 
-func restoreSnapshot(containerName string, app string, port int, snapshotRef string) error {
-	_ = exec.Command("docker", "rm", "-f", containerName).Run()
-	args := dockerRunArgs(containerName, app, port, snapshotRef)
-	cmd := exec.Command("docker", args...)
+func restoreSnapshot(containerName string, app string, port int, snapshotRef string, health server.HealthCheck) error {
+	_ = containerEngine.Command("rm", "-f", containerName).Run()
+	args := dockerRunArgs(containerName, app, port, snapshotRef, health)
+	cmd := containerEngine.Command(args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
-func dockerRunArgs(name string, app string, port int, image string) []string {
+// dockerRunArgs builds the run command for an app container; health is installed as
+// its HEALTHCHECK when health.Docker is set.
+func dockerRunArgs(name string, app string, port int, image string, health server.HealthCheck) []string {
 	args := []string{
 		"run",
 		"-d",
@@ -693,6 +979,8 @@ func dockerRunArgs(name string, app string, port int, image string) []string {
 		fmt.Sprintf("VIBERUN_CONTAINER=%s", name),
 		"-e",
 		fmt.Sprintf("VIBERUN_PORT=%d", port),
+		"--tmpfs",
+		secretsDir + ":mode=0700",
 	}
 	if socketPath, ok := xdgOpenSocketPath(); ok {
 		args = append(args,
@@ -702,22 +990,40 @@ func dockerRunArgs(name string, app string, port int, image string) []string {
 			fmt.Sprintf("VIBERUN_XDG_OPEN_SOCKET=%s", socketPath),
 		)
 	}
+	if health.Docker {
+		args = append(args, healthCheckArgs(health)...)
+	}
 	args = append(args, image, "/usr/bin/s6-svscan", "/etc/services.d")
 	return args
 }
 
 func agentCommand(provider string) ([]string, error) {
-	normalized := strings.ToLower(strings.TrimSpace(provider))
-	switch normalized {
-	case "", "codex":
-		return []string{"codex"}, nil
-	case "claude", "claude-code":
-		return []string{"claude"}, nil
-	case "gemini":
-		return []string{"gemini"}, nil
-	default:
-		return nil, fmt.Errorf("unsupported provider %q", provider)
+	definition, err := lookupAgent(provider)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{}, definition.Command...), nil
+}
+
+// agentExecCommand returns the provider's non-interactive command for prompt.
+func agentExecCommand(provider string, prompt string) ([]string, error) {
+	definition, err := lookupAgent(provider)
+	if err != nil {
+		return nil, err
+	}
+	return definition.ExecCommand(prompt)
+}
+
+func lookupAgent(provider string) (agents.Provider, error) {
+	registry, err := agents.Load()
+	if err != nil {
+		return agents.Provider{}, err
+	}
+	definition, ok := registry.Lookup(provider)
+	if !ok {
+		return agents.Provider{}, fmt.Errorf("unsupported provider %q (available: %s)", provider, strings.Join(registry.Names(), ", "))
 	}
+	return definition, nil
 }
 
 func tmuxSessionArgs(session string, command []string) []string {
@@ -1,6 +1,14 @@
 package main
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shayne/viberun/internal/engine"
+)
 
 func TestTmuxSessionArgsUsesDefaults(t *testing.T) {
 	args := tmuxSessionArgs("", nil)
@@ -79,3 +87,83 @@ func TestNormalizeTermValue(t *testing.T) {
 		}
 	}
 }
+
+func TestParseActionAuth(t *testing.T) {
+	action, args, err := parseAction([]string{"auth", "push", "claude"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if action != "auth" || !reflect.DeepEqual(args, []string{"push", "claude"}) {
+		t.Fatalf("unexpected auth push parse: %s %v", action, args)
+	}
+	action, args, err = parseAction([]string{"auth", "status"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if action != "auth" || !reflect.DeepEqual(args, []string{"status"}) {
+		t.Fatalf("unexpected auth status parse: %s %v", action, args)
+	}
+	if _, _, err := parseAction([]string{"auth", "wipe"}); err == nil {
+		t.Fatalf("expected error for unknown auth action")
+	}
+}
+
+func TestParseAppArgsHealthSet(t *testing.T) {
+	app, action, args, err := parseAppArgs([]string{"myapp", "health", "set", "/healthz", "200", "30s", "docker"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if app != "myapp" || action != "health" || !reflect.DeepEqual(args, []string{"set", "/healthz", "200", "30s", "docker"}) {
+		t.Fatalf("unexpected health set parse: %s %s %v", app, action, args)
+	}
+	if _, _, _, err := parseAppArgs([]string{"myapp", "health", "set", "/healthz", "200", "30s", "docker", "extra"}); err == nil {
+		t.Fatalf("expected error for too many health set arguments")
+	}
+	if _, _, _, err := parseAppArgs([]string{"myapp", "snapshot", "extra"}); err == nil {
+		t.Fatalf("expected error for extra snapshot argument")
+	}
+	if _, _, _, err := parseAppArgs([]string{" ", "shell"}); err == nil {
+		t.Fatalf("expected error for empty app name")
+	}
+}
+
+func TestParseActionAddressPort(t *testing.T) {
+	action, args, err := parseAction([]string{"address", "5173"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if action != "address" || !reflect.DeepEqual(args, []string{"5173"}) {
+		t.Fatalf("unexpected action %q %v", action, args)
+	}
+	if _, _, err := parseAction([]string{"address", "http"}); err == nil {
+		t.Fatalf("expected error for invalid port")
+	}
+}
+
+// useFakePodman puts a podman on PATH that runs rootless and answers `port` with
+// mapping, or fails when mapping is empty.
+func useFakePodman(t *testing.T, mapping string) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\n  info) echo true ;;\n  port) [ -n \"" + mapping + "\" ] || exit 1; echo \"" + mapping + "\" ;;\n  *) exit 1 ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(dir, "podman"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	previous := containerEngine
+	containerEngine = engine.New(engine.Podman)
+	t.Cleanup(func() { containerEngine = previous })
+}
+
+func TestForwardTargetRootless(t *testing.T) {
+	useFakePodman(t, "0.0.0.0:40123")
+	target, err := forwardTarget("viberun-myapp", 5173)
+	if err != nil || target != "127.0.0.1:40123" {
+		t.Fatalf("expected the published port, got %q %v", target, err)
+	}
+
+	useFakePodman(t, "")
+	if _, err := forwardTarget("viberun-myapp", 5173); err == nil || !strings.Contains(err.Error(), "rootless") {
+		t.Fatalf("expected an unpublished rootless port to fail, got %v", err)
+	}
+}
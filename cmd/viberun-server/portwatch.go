@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shayne/viberun/internal/rpc"
+)
+
+const portWatchInterval = 2 * time.Second
+
+// containerAppPort is the port every app serves on; sessions always forward it.
+const containerAppPort = 8080
+
+// watchPorts polls the container's listening TCP ports during a session and reports
+// every change to the client over the session socket, which forwards new ports and
+// replies with messages to show in the session's tmux. It stops when the client does
+// not support auto-forwarding or has it turned off.
+func watchPorts(containerName string, session string, socketPath string) {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+	var reported []rpc.ListeningPort
+	warned := false
+	for first := true; ; first = false {
+		if !first {
+			time.Sleep(portWatchInterval)
+		}
+		out, err := containerEngine.Command("exec", containerName, "cat", "/proc/net/tcp", "/proc/net/tcp6").Output()
+		if err != nil && len(out) == 0 {
+			continue
+		}
+		ports := parseListeningPorts(string(out))
+		if reported != nil && slices.Equal(ports, reported) {
+			continue
+		}
+		messages, status, err := postPorts(client, ports)
+		if status == http.StatusForbidden || status == http.StatusNotFound {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		reported = ports
+		for _, message := range messages {
+			out, err := containerEngine.Command(portMessageArgs(containerName, session, message)...).CombinedOutput()
+			// Once per session: stderr is the terminal tmux draws on.
+			if err != nil && !warned {
+				warned = true
+				fmt.Fprintf(os.Stderr, "warning: failed to show port message in tmux: %s\n", strings.TrimSpace(string(out)+" "+err.Error()))
+			}
+		}
+	}
+}
+
+// portMessageArgs shows message on the clients attached to session; without -t tmux
+// looks for a current client, which a detached exec does not have.
+func portMessageArgs(containerName string, session string, message string) []string {
+	return []string{"exec", containerName, "tmux", "display-message", "-t", session, "viberun: " + message}
+}
+
+func postPorts(client *http.Client, ports []rpc.ListeningPort) ([]string, int, error) {
+	body, err := json.Marshal(rpc.PortsUpdate{Ports: ports})
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := client.Post(fmt.Sprintf("http://localhost/v%d/ports", rpc.Version), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, fmt.Errorf("ports update failed: %s", resp.Status)
+	}
+	var result rpc.PortsResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return result.Messages, resp.StatusCode, nil
+}
+
+// parseListeningPorts reads /proc/net/tcp and /proc/net/tcp6 output and returns the
+// listening ports other than the app port, sorted. A port is loopback only when every
+// listener on it is bound to a loopback address.
+func parseListeningPorts(output string) []rpc.ListeningPort {
+	loopback := map[int]bool{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		// sl local_address rem_address st ...; 0A is TCP_LISTEN.
+		if len(fields) < 4 || fields[3] != "0A" {
+			continue
+		}
+		address, portHex, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseInt(portHex, 16, 32)
+		if err != nil || port <= 0 || port == containerAppPort {
+			continue
+		}
+		onlyLoopback, seen := loopback[int(port)]
+		loopback[int(port)] = isLoopbackHex(address) && (!seen || onlyLoopback)
+	}
+	ports := make([]rpc.ListeningPort, 0, len(loopback))
+	for port, onlyLoopback := range loopback {
+		ports = append(ports, rpc.ListeningPort{Port: port, Loopback: onlyLoopback})
+	}
+	slices.SortFunc(ports, func(a, b rpc.ListeningPort) int { return a.Port - b.Port })
+	return ports
+}
+
+// isLoopbackHex reports whether a /proc/net/tcp address (little-endian hex words) is
+// 127.0.0.0/8, ::1 or ::ffff:127.0.0.0/104.
+func isLoopbackHex(address string) bool {
+	switch len(address) {
+	case 8:
+		return strings.HasSuffix(address, "7F")
+	case 32:
+		return address == "00000000000000000000000001000000" ||
+			(strings.HasPrefix(address, "0000000000000000FFFF0000") && strings.HasSuffix(address, "7F"))
+	default:
+		return false
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shayne/viberun/internal/rpc"
+)
+
+func TestParseListeningPorts(t *testing.T) {
+	output := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1435 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2 1 0000000000000000 100 0 0 10 0
+   2: 0100007F:2405 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 3 1 0000000000000000 100 0 0 10 0
+   3: 0200AC11:1F90 0100AC11:D2A4 01 00000000:00000000 00:00000000 00000000     0        0 4 1 0000000000000000 20 4 30 10 -1
+  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:1435 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 5 1 0000000000000000 100 0 0 10 0
+   1: 00000000000000000000000000000000:2405 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 6 1 0000000000000000 100 0 0 10 0
+`
+	got := parseListeningPorts(output)
+	want := []rpc.ListeningPort{{Port: 5173, Loopback: true}, {Port: 9221}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestIsLoopbackHex(t *testing.T) {
+	cases := map[string]bool{
+		"0100007F":                         true,
+		"0000000A":                         false,
+		"00000000":                         false,
+		"00000000000000000000000001000000": true,
+		"0000000000000000FFFF00000100007F": true,
+		"00000000000000000000000000000000": false,
+	}
+	for address, want := range cases {
+		if got := isLoopbackHex(address); got != want {
+			t.Errorf("%s: expected %v, got %v", address, want, got)
+		}
+	}
+}
+
+func TestPortMessageArgsTargetSession(t *testing.T) {
+	args := portMessageArgs("viberun-myapp", "viberun-agent", "Forwarded port 5173")
+	want := []string{"exec", "viberun-myapp", "tmux", "display-message", "-t", "viberun-agent", "viberun: Forwarded port 5173"}
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("expected %q, got %q", want, args)
+	}
+}
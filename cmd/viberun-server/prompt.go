@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxPromptBytes bounds the prompt read from stdin.
+const maxPromptBytes = 1 << 20
+
+// runPromptAction runs the agent's non-interactive command in the app container with
+// the prompt read from stdin, streaming its output. The prompt travels over stdin
+// because ssh joins the remote argv with spaces.
+func runPromptAction(containerName string, app string, exists bool, agentProvider string) error {
+	if !exists {
+		return fmt.Errorf("app container does not exist")
+	}
+	running, err := containerRunning(containerName)
+	if err != nil {
+		return fmt.Errorf("failed to check container state: %w", err)
+	}
+	if !running {
+		return fmt.Errorf("app container is not running; start it with viberun %s", app)
+	}
+	prompt, err := readPrompt(os.Stdin)
+	if err != nil {
+		return err
+	}
+	command, err := agentExecCommand(agentProvider, prompt)
+	if err != nil {
+		return err
+	}
+	if err := refreshSecrets(containerName, app); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to write secrets: %v\n", err)
+	}
+	cmd := containerEngine.Command(dockerExecArgs(containerName, command, false, nil)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func readPrompt(r io.Reader) (string, error) {
+	raw, err := io.ReadAll(io.LimitReader(r, maxPromptBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if len(raw) > maxPromptBytes {
+		return "", fmt.Errorf("prompt is larger than %d bytes", maxPromptBytes)
+	}
+	prompt := strings.TrimSpace(string(raw))
+	if prompt == "" {
+		return "", fmt.Errorf("prompt is empty")
+	}
+	return prompt, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseActionPrompt(t *testing.T) {
+	action, args, err := parseAction([]string{"prompt"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if action != "prompt" || len(args) != 0 {
+		t.Fatalf("unexpected action %q %v", action, args)
+	}
+	if _, _, err := parseAction([]string{"prompt", "fix", "tests"}); err == nil {
+		t.Fatalf("expected prompt text in argv to be rejected")
+	}
+}
+
+func TestReadPrompt(t *testing.T) {
+	prompt, err := readPrompt(strings.NewReader("  fix the failing tests\n\n"))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if prompt != "fix the failing tests" {
+		t.Fatalf("unexpected prompt %q", prompt)
+	}
+	if _, err := readPrompt(strings.NewReader(" \n")); err == nil {
+		t.Fatalf("expected error for empty prompt")
+	}
+	if _, err := readPrompt(strings.NewReader(strings.Repeat("x", maxPromptBytes+1))); err == nil {
+		t.Fatalf("expected error for oversized prompt")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shayne/viberun/internal/proxy"
+	"github.com/shayne/viberun/internal/server"
+)
+
+const (
+	// defaultProxyListen keeps the unauthenticated app routes on loopback; binding them
+	// publicly takes an explicit --listen.
+	defaultProxyListen  = "127.0.0.1:8000"
+	defaultShareListen  = ":8001"
+	proxyReloadInterval = 2 * time.Second
+)
+
+// runProxy serves every app over plain HTTP until interrupted, reloading the route table
+// whenever the server state changes (apps created or deleted). Share links are served on
+// a separate listener that exposes nothing else.
+func runProxy(flags serverFlags) error {
+	listen := strings.TrimSpace(flags.Listen)
+	if listen == "" {
+		listen = defaultProxyListen
+	}
+	shareListen := strings.TrimSpace(flags.ShareListen)
+	if shareListen == "" {
+		shareListen = defaultShareListen
+	}
+	if err := recordShareListen(shareListen); err != nil {
+		return fmt.Errorf("failed to record share address: %w", err)
+	}
+	domain := strings.TrimSpace(flags.Domain)
+	if domain == "" {
+		domain = strings.TrimSpace(os.Getenv("VIBERUN_PROXY_DOMAIN"))
+	}
+	p := proxy.New(domain)
+	watcher := &stateWatcher{proxy: p}
+	if _, err := watcher.reload(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go watcher.run(ctx, proxyReloadInterval)
+
+	servers := []*http.Server{
+		{Addr: listen, Handler: p, ReadHeaderTimeout: 10 * time.Second},
+		{Addr: shareListen, Handler: http.HandlerFunc(p.ServeShare), ReadHeaderTimeout: 10 * time.Second},
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for _, srv := range servers {
+			_ = srv.Shutdown(shutdownCtx)
+		}
+	}()
+	if listensPublicly(listen) {
+		fmt.Fprintf(os.Stderr, "warning: the proxy serves every app without authentication on %s; anyone who can reach it bypasses share tokens\n", listen)
+	}
+	if domain != "" {
+		fmt.Fprintf(os.Stderr, "viberun proxy on %s: <app>.%s and /<app>/ (%d apps)\n", listen, domain, len(p.Routes()))
+	} else {
+		fmt.Fprintf(os.Stderr, "viberun proxy on %s: /<app>/ (%d apps)\n", listen, len(p.Routes()))
+	}
+	fmt.Fprintf(os.Stderr, "viberun shares on %s: %s<token>/\n", shareListen, proxy.SharePrefix)
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func() {
+			errs <- srv.ListenAndServe()
+		}()
+	}
+	for range servers {
+		if err := <-errs; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			stop()
+			return err
+		}
+	}
+	return nil
+}
+
+// recordShareListen stores the share listener's address in the server state, so `share`
+// prints links for the port the proxy actually serves.
+func recordShareListen(addr string) error {
+	state, path, err := server.LoadState()
+	if err != nil {
+		return err
+	}
+	if state.ShareListen == addr {
+		return nil
+	}
+	state.ShareListen = addr
+	return server.SaveState(path, state)
+}
+
+// stateWatcher reloads proxy routes when the state file's modification time changes.
+type stateWatcher struct {
+	proxy   *proxy.Proxy
+	modTime time.Time
+}
+
+func (w *stateWatcher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := w.reload()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to reload routes: %v\n", err)
+			} else if changed {
+				fmt.Fprintf(os.Stderr, "reloaded routes (%d apps)\n", len(w.proxy.Routes()))
+			}
+		}
+	}
+}
+
+// reload loads the state when it changed since the last load and reports whether it did.
+func (w *stateWatcher) reload() (bool, error) {
+	state, path, err := server.LoadState()
+	if err != nil {
+		return false, err
+	}
+	modTime := time.Time{}
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+	if !w.modTime.IsZero() && modTime.Equal(w.modTime) {
+		return false, nil
+	}
+	w.modTime = modTime
+	w.proxy.SetRoutes(proxy.Routes(state.Ports))
+	shares := proxy.Shares{}
+	for _, share := range state.Shares {
+		if port, ok := state.Ports[share.App]; ok {
+			shares[share.TokenHash] = proxy.Share{App: share.App, Port: port, Expires: share.Expires}
+		}
+	}
+	w.proxy.SetShares(shares)
+	return true, nil
+}
+
+// listensPublicly reports whether addr binds more than a loopback address.
+func listensPublicly(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return true
+	}
+	if host == "localhost" {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip == nil || !ip.IsLoopback()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/shayne/viberun/internal/proxy"
+	"github.com/shayne/viberun/internal/server"
+)
+
+func TestStateWatcherReloadsOnChange(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	state, path, err := server.LoadState()
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	state.SetPort("demo", 8080)
+	if _, _, err := state.AddShare("demo", time.Hour, time.Now()); err != nil {
+		t.Fatalf("add share: %v", err)
+	}
+	if err := server.SaveState(path, state); err != nil {
+		t.Fatalf("save state: %v", err)
+	}
+
+	watcher := &stateWatcher{proxy: proxy.New("")}
+	if changed, err := watcher.reload(); err != nil || !changed {
+		t.Fatalf("expected initial load, got %v %v", changed, err)
+	}
+	if len(watcher.proxy.Routes()) != 1 || watcher.proxy.Routes()["demo"] != 8080 {
+		t.Fatalf("expected demo route, got %v", watcher.proxy.Routes())
+	}
+	if changed, _ := watcher.reload(); changed {
+		t.Fatalf("expected no reload without changes")
+	}
+
+	state.SetPort("blog", 8081)
+	state.RemoveApp("demo")
+	if err := server.SaveState(path, state); err != nil {
+		t.Fatalf("save state: %v", err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if changed, err := watcher.reload(); err != nil || !changed {
+		t.Fatalf("expected reload after change, got %v %v", changed, err)
+	}
+	routes := watcher.proxy.Routes()
+	if _, ok := routes["demo"]; ok || routes["blog"] != 8081 {
+		t.Fatalf("unexpected routes after reload: %v", routes)
+	}
+}
+
+func TestListensPublicly(t *testing.T) {
+	cases := map[string]bool{
+		defaultProxyListen: false,
+		"localhost:8000":   false,
+		"[::1]:8000":       false,
+		":8000":            true,
+		"0.0.0.0:8000":     true,
+		"10.0.0.5:8000":    true,
+	}
+	for addr, want := range cases {
+		if got := listensPublicly(addr); got != want {
+			t.Errorf("%s: expected %v, got %v", addr, want, got)
+		}
+	}
+}
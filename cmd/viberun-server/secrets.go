@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/shayne/viberun/internal/server"
+)
+
+// secretsDir is a tmpfs inside each container. docker commit does not capture tmpfs
+// contents, so secrets written here never end up in snapshots.
+const (
+	secretsDir     = "/run/viberun"
+	secretsEnvPath = secretsDir + "/secrets.env"
+)
+
+func runSecretsAction(containerName string, app string, exists bool, actionArgs []string) error {
+	secrets, err := server.LoadSecrets()
+	if err != nil {
+		return err
+	}
+	switch actionArgs[0] {
+	case "ls":
+		names := secrets.Names(app)
+		if len(names) == 0 {
+			fmt.Fprintf(os.Stdout, "No secrets set for %s\n", app)
+			return nil
+		}
+		for _, name := range names {
+			fmt.Fprintln(os.Stdout, name)
+		}
+		return nil
+	case "set":
+		name := actionArgs[1]
+		value, err := readSecretValue(os.Stdin)
+		if err != nil {
+			return err
+		}
+		if err := secrets.Set(app, name, value); err != nil {
+			return err
+		}
+		if err := secrets.Save(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "Set %s for %s\n", name, app)
+	case "rm":
+		name := actionArgs[1]
+		if !secrets.Remove(app, name) {
+			return fmt.Errorf("secret %s is not set for %s", name, app)
+		}
+		if err := secrets.Save(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "Removed %s from %s\n", name, app)
+	default:
+		return fmt.Errorf("unknown secrets action %q", actionArgs[0])
+	}
+	if !exists {
+		return nil
+	}
+	running, err := containerRunning(containerName)
+	if err != nil || !running {
+		return nil
+	}
+	if err := syncSecretsFile(containerName, app, secrets); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, "Restart services (vrctl service restart <name>) to pick up the change.")
+	return nil
+}
+
+func refreshSecrets(containerName string, app string) error {
+	secrets, err := server.LoadSecrets()
+	if err != nil {
+		return err
+	}
+	return syncSecretsFile(containerName, app, secrets)
+}
+
+func readSecretValue(in io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(in, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSuffix(string(data), "\n")
+	value = strings.TrimSuffix(value, "\r")
+	if value == "" {
+		return "", fmt.Errorf("secret value is empty")
+	}
+	return value, nil
+}
+
+// syncSecretsFile writes the app's secrets to the container tmpfs so shells and
+// vrctl services can source them.
+func syncSecretsFile(containerName string, app string, secrets *server.Secrets) error {
+	env, err := secrets.Env(app)
+	if err != nil {
+		return err
+	}
+	if !secretsMountReady(containerName) {
+		if len(env) > 0 {
+			fmt.Fprintf(os.Stderr, "warning: %s has no %s tmpfs; restore a snapshot or recreate the app to enable secrets\n", containerName, secretsDir)
+		}
+		return nil
+	}
+	return writeContainerFile(containerName, secretsEnvPath, []byte(renderSecretsEnv(env)), 0o600)
+}
+
+func secretsMountReady(containerName string) bool {
+	script := "grep -qs ' " + secretsDir + " tmpfs ' /proc/mounts"
+	return containerEngine.Command("exec", containerName, "sh", "-c", script).Run() == nil
+}
+
+func renderSecretsEnv(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "export %s=%s\n", key, shellQuote(env[key]))
+	}
+	return b.String()
+}
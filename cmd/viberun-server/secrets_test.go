@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shayne/viberun/internal/server"
+)
+
+func TestParseActionSecrets(t *testing.T) {
+	action, args, err := parseAction([]string{"secrets", "set", "STRIPE_KEY"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if action != "secrets" || !reflect.DeepEqual(args, []string{"set", "STRIPE_KEY"}) {
+		t.Fatalf("unexpected parse: %s %v", action, args)
+	}
+	if _, args, err := parseAction([]string{"secrets", "ls"}); err != nil || !reflect.DeepEqual(args, []string{"ls"}) {
+		t.Fatalf("unexpected ls parse: %v %v", args, err)
+	}
+	for _, input := range [][]string{{"secrets", "set"}, {"secrets", "rm", "BAD-NAME"}, {"secrets", "dump"}} {
+		if _, _, err := parseAction(input); err == nil {
+			t.Fatalf("expected error for %v", input)
+		}
+	}
+}
+
+func TestRenderSecretsEnvQuotesValues(t *testing.T) {
+	got := renderSecretsEnv(map[string]string{
+		"B_KEY": "it's $HOME",
+		"A_KEY": "plain",
+	})
+	want := "export A_KEY='plain'\nexport B_KEY='it'\"'\"'s $HOME'\n"
+	if got != want {
+		t.Fatalf("unexpected env file:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestReadSecretValue(t *testing.T) {
+	value, err := readSecretValue(strings.NewReader("sk_test\n"))
+	if err != nil || value != "sk_test" {
+		t.Fatalf("unexpected value %q (err=%v)", value, err)
+	}
+	if _, err := readSecretValue(strings.NewReader("\n")); err == nil {
+		t.Fatalf("expected empty value error")
+	}
+}
+
+func TestDockerRunArgsMountsSecretsTmpfs(t *testing.T) {
+	args := dockerRunArgs("viberun-app", "app", 8080, "viberun:latest", server.HealthCheck{})
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "--tmpfs "+secretsDir+":mode=0700") {
+		t.Fatalf("expected secrets tmpfs mount, got %v", args)
+	}
+	if strings.Contains(joined, secretsEnvPath) {
+		t.Fatalf("secrets must not be passed as container env: %v", args)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shayne/viberun/internal/proxy"
+	"github.com/shayne/viberun/internal/server"
+)
+
+const defaultShareTTL = time.Hour
+
+// runShareAction creates, lists or revokes an app's share links. Expired shares are
+// pruned from the state on every call.
+func runShareAction(action string, app string, exists bool, state *server.State, statePath string, args []string) error {
+	now := time.Now()
+	pruned := state.PruneShares(now)
+	switch {
+	case action == "share":
+		if !exists {
+			return fmt.Errorf("app container does not exist")
+		}
+		ttl := defaultShareTTL
+		if len(args) == 1 {
+			var err error
+			ttl, err = time.ParseDuration(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid ttl %q: %v", args[0], err)
+			}
+		}
+		share, token, err := state.AddShare(app, ttl, now)
+		if err != nil {
+			return err
+		}
+		if err := server.SaveState(statePath, *state); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "Shared %s until %s:\n", app, share.Expires.Local().Format(time.DateTime+" MST"))
+		fmt.Fprintf(os.Stdout, "  %s%s%s/\n", shareBaseURL(state.ShareListen), proxy.SharePrefix, token)
+		fmt.Fprintf(os.Stdout, "Anyone with the link can use the app. Revoke it with: viberun %s shares rm %s\n", app, share.ID)
+		if !shareListenerUp(state.ShareListen) {
+			fmt.Fprintln(os.Stderr, "warning: the host proxy is not running; start `viberun-server proxy` to serve the link")
+		}
+		return nil
+	case len(args) == 2 && args[0] == "rm":
+		if !state.RemoveShare(app, args[1]) {
+			return fmt.Errorf("no share %q for %s", args[1], app)
+		}
+		if err := server.SaveState(statePath, *state); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "Revoked share %s for %s\n", args[1], app)
+		return nil
+	default:
+		if pruned {
+			if err := server.SaveState(statePath, *state); err != nil {
+				return err
+			}
+		}
+		shares := state.SharesForApp(app, now)
+		if len(shares) == 0 {
+			fmt.Fprintf(os.Stdout, "No shares for %s\n", app)
+			return nil
+		}
+		fmt.Fprintf(os.Stdout, "Shares for %s:\n", app)
+		for _, share := range shares {
+			fmt.Fprintf(os.Stdout, "  %s expires %s (in %s)\n", share.ID, share.Expires.Local().Format(time.DateTime), share.Expires.Sub(now).Round(time.Minute))
+		}
+		return nil
+	}
+}
+
+// shareBaseURL is where the proxy's share listener is reachable: VIBERUN_SHARE_URL, or
+// the listener's port on its own address when it binds one, otherwise on the address
+// this host uses for outbound traffic. listen is the address the proxy recorded.
+func shareBaseURL(listen string) string {
+	if base := strings.TrimSpace(os.Getenv("VIBERUN_SHARE_URL")); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	host, port := shareListenAddr(listen)
+	if host == "" {
+		host = "localhost"
+		// Dialing UDP sends nothing; it only picks the outbound interface.
+		if conn, err := net.Dial("udp", "1.1.1.1:53"); err == nil {
+			host = conn.LocalAddr().(*net.UDPAddr).IP.String()
+			_ = conn.Close()
+		} else if name, err := os.Hostname(); err == nil {
+			host = name
+		}
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// shareListenAddr splits the recorded share listen address, defaulting to
+// defaultShareListen. host is empty when the listener binds every interface.
+func shareListenAddr(listen string) (string, string) {
+	if strings.TrimSpace(listen) == "" {
+		listen = defaultShareListen
+	}
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		host, port, _ = net.SplitHostPort(defaultShareListen)
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = ""
+	}
+	return host, port
+}
+
+func shareListenerUp(listen string) bool {
+	host, port := shareListenAddr(listen)
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), time.Second)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/shayne/viberun/internal/server"
+)
+
+func TestRunShareActionCreatesAndRevokes(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("VIBERUN_SHARE_URL", "http://demo.example.com:8001/")
+	state, path, err := server.LoadState()
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	state.SetPort("demo", 8080)
+
+	if err := runShareAction("share", "demo", false, &state, path, nil); err == nil {
+		t.Fatalf("expected share of a missing container to fail")
+	}
+	if err := runShareAction("share", "demo", true, &state, path, []string{"soon"}); err == nil {
+		t.Fatalf("expected invalid ttl to fail")
+	}
+	if err := runShareAction("share", "demo", true, &state, path, []string{"30m"}); err != nil {
+		t.Fatalf("share: %v", err)
+	}
+	saved, _, err := server.LoadState()
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	if len(saved.Shares) != 1 || saved.Shares[0].App != "demo" {
+		t.Fatalf("expected saved share, got %+v", saved.Shares)
+	}
+
+	id := saved.Shares[0].ID
+	if err := runShareAction("shares", "demo", true, &state, path, []string{"rm", "missing"}); err == nil {
+		t.Fatalf("expected revoking an unknown share to fail")
+	}
+	if err := runShareAction("shares", "demo", true, &state, path, []string{"rm", id}); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	saved, _, err = server.LoadState()
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	if len(saved.Shares) != 0 {
+		t.Fatalf("expected share revoked, got %+v", saved.Shares)
+	}
+}
+
+func TestShareBaseURLFromEnv(t *testing.T) {
+	t.Setenv("VIBERUN_SHARE_URL", "https://share.example.com/")
+	if got := shareBaseURL(":9001"); got != "https://share.example.com" {
+		t.Fatalf("unexpected base url %q", got)
+	}
+}
+
+func TestShareBaseURLUsesRecordedListen(t *testing.T) {
+	t.Setenv("VIBERUN_SHARE_URL", "")
+	if got := shareBaseURL("192.0.2.5:9001"); got != "http://192.0.2.5:9001" {
+		t.Fatalf("unexpected base url %q", got)
+	}
+	if got := shareBaseURL(":9001"); !strings.HasSuffix(got, ":9001") {
+		t.Fatalf("expected recorded port, got %q", got)
+	}
+	if got := shareBaseURL(""); !strings.HasSuffix(got, ":8001") {
+		t.Fatalf("expected default port, got %q", got)
+	}
+}
+
+func TestShareListenerUpUsesRecordedListen(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	if !shareListenerUp(":" + port) {
+		t.Fatalf("expected listener on :%s to be up", port)
+	}
+	if !shareListenerUp(listener.Addr().String()) {
+		t.Fatalf("expected listener on %s to be up", listener.Addr())
+	}
+}
+
+func TestRecordShareListen(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if err := recordShareListen(":9001"); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	state, _, err := server.LoadState()
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	if state.ShareListen != ":9001" {
+		t.Fatalf("expected recorded share listen, got %q", state.ShareListen)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/shayne/viberun/internal/agents"
+	"github.com/shayne/viberun/internal/authbundle"
+	"github.com/shayne/viberun/internal/sshcmd"
+	"github.com/shayne/viberun/internal/target"
+)
+
+func runAuthCommand(resolved target.Resolved, agentProvider string, subcommand string, flags runFlags) error {
+	provider := strings.TrimSpace(flags.Provider)
+	switch subcommand {
+	case "status":
+		statuses, err := fetchAuthStatus(resolved, agentProvider, provider)
+		if err != nil {
+			return err
+		}
+		printAuthStatus(os.Stdout, resolved.App, statuses)
+		return nil
+	case "push":
+		if provider == "" {
+			provider = agentProvider
+		}
+		return pushAuth(resolved, agentProvider, provider, flags.Yes, flags.DryRun)
+	case "pull":
+		if provider == "" {
+			provider = agentProvider
+		}
+		return pullAuth(resolved, agentProvider, provider, flags.All)
+	default:
+		return fmt.Errorf("unknown auth action %q (expected push, pull or status)", subcommand)
+	}
+}
+
+func pushAuth(resolved target.Resolved, agentProvider string, provider string, skipPrompt bool, dryRun bool) error {
+	auth, details, err := discoverLocalAuth(provider)
+	if err != nil {
+		return fmt.Errorf("auth discovery failed: %w", err)
+	}
+	if auth == nil {
+		return fmt.Errorf("no local %s credentials found", provider)
+	}
+	sort.Strings(details)
+	for _, item := range details {
+		fmt.Fprintf(os.Stdout, "Found %s\n", item)
+	}
+	statuses, err := fetchAuthStatus(resolved, agentProvider, auth.Provider)
+	if err != nil {
+		return err
+	}
+	if overwrites := authOverwrites(auth, statuses); len(overwrites) > 0 {
+		fmt.Fprintf(os.Stdout, "This will overwrite in %s:\n", resolved.App)
+		for _, item := range overwrites {
+			fmt.Fprintf(os.Stdout, "  %s\n", item)
+		}
+	}
+	if !skipPrompt && !dryRun && !promptPushAuth(resolved.App, auth.Provider) {
+		fmt.Fprintln(os.Stdout, "auth push cancelled")
+		return nil
+	}
+	bundle, err := buildAuthBundle(auth)
+	if err != nil {
+		return fmt.Errorf("failed to read auth: %w", err)
+	}
+	actionArgs := []string{"auth", "push", auth.Provider}
+	if dryRun {
+		actionArgs = append(actionArgs, "--dry-run")
+	}
+	cmd, err := authBundleCommand(resolved, agentProvider, actionArgs, bundle)
+	if err != nil {
+		return fmt.Errorf("failed to encode auth: %w", err)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("auth push failed: %w", err)
+	}
+	return nil
+}
+
+func pullAuth(resolved target.Resolved, agentProvider string, provider string, fanout bool) error {
+	registry, err := agents.Load()
+	if err != nil {
+		return err
+	}
+	definition, ok := registry.Lookup(provider)
+	if !ok {
+		return fmt.Errorf("unsupported provider %q", provider)
+	}
+	remoteArgs := sshcmd.RemoteArgs(resolved.App, agentProvider, []string{"auth", "pull", definition.Name}, nil)
+	sshArgs := sshcmd.BuildArgs(resolved.Host, remoteArgs, false)
+	cmd := exec.Command("ssh", sshArgs...)
+	cmd.Env = normalizedSshEnv()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		trimmed := strings.TrimSpace(stderr.String())
+		if trimmed == "" {
+			trimmed = err.Error()
+		}
+		return fmt.Errorf("failed to pull auth: %s", trimmed)
+	}
+	remote, err := authbundle.Read(bytes.NewReader(output))
+	if err != nil {
+		return err
+	}
+	if len(remote.Files) == 0 {
+		return fmt.Errorf("no %s credential files found in %s", definition.Name, resolved.App)
+	}
+
+	freshest := &authbundle.Bundle{Provider: definition.Name}
+	for _, file := range remote.Files {
+		localPath := localPathForContainerFile(definition, file.ContainerPath)
+		if localPath == "" {
+			fmt.Fprintf(os.Stdout, "%s: no local path configured, skipped\n", file.ContainerPath)
+			continue
+		}
+		local, err := os.ReadFile(localPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		update, reason := shouldPullAuthFile(local, err == nil, file.Data)
+		if update {
+			if err := writeLocalAuthFile(localPath, file.Data); err != nil {
+				return err
+			}
+			local = file.Data
+		}
+		fmt.Fprintf(os.Stdout, "%s: %s\n", localPath, reason)
+		freshest.Files = append(freshest.Files, authbundle.File{
+			ContainerPath: file.ContainerPath,
+			Mode:          file.Mode,
+			Data:          local,
+		})
+	}
+	if !fanout || len(freshest.Files) == 0 {
+		return nil
+	}
+	cmd, err = authBundleCommand(resolved, agentProvider, []string{"auth", "fanout", definition.Name}, freshest)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("auth fanout failed: %w", err)
+	}
+	return nil
+}
+
+// shouldPullAuthFile decides whether the container copy of a credential file should
+// replace the local copy, and describes the decision.
+func shouldPullAuthFile(local []byte, localExists bool, remote []byte) (bool, string) {
+	if !localExists {
+		return true, "created from container copy"
+	}
+	if bytes.Equal(local, remote) {
+		return false, "already up to date"
+	}
+	newer, ok := authbundle.Compare(local, remote)
+	if !ok {
+		return false, "cannot compare token timestamps, left unchanged"
+	}
+	if newer {
+		return true, "updated from newer container copy"
+	}
+	return false, "local copy is newer, left unchanged"
+}
+
+func localPathForContainerFile(provider agents.Provider, containerPath string) string {
+	for _, file := range provider.Auth.Files {
+		if file.ContainerPath != containerPath {
+			continue
+		}
+		path, _, err := resolveAuthFilePath(file)
+		if err != nil {
+			return ""
+		}
+		return path
+	}
+	return ""
+}
+
+func writeLocalAuthFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func fetchAuthStatus(resolved target.Resolved, agentProvider string, provider string) ([]authbundle.Status, error) {
+	actionArgs := []string{"auth", "status"}
+	if provider != "" {
+		actionArgs = append(actionArgs, provider)
+	}
+	remoteArgs := sshcmd.RemoteArgs(resolved.App, agentProvider, actionArgs, nil)
+	sshArgs := sshcmd.BuildArgs(resolved.Host, remoteArgs, false)
+	cmd := exec.Command("ssh", sshArgs...)
+	cmd.Env = normalizedSshEnv()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		trimmed := strings.TrimSpace(stderr.String())
+		if trimmed == "" {
+			trimmed = err.Error()
+		}
+		return nil, fmt.Errorf("failed to read auth status: %s", trimmed)
+	}
+	var statuses []authbundle.Status
+	if err := json.Unmarshal(output, &statuses); err != nil {
+		return nil, fmt.Errorf("unexpected auth status response: %w", err)
+	}
+	return statuses, nil
+}
+
+// authOverwrites lists the container targets that a push of auth would replace.
+func authOverwrites(auth *localAuth, statuses []authbundle.Status) []string {
+	if auth == nil {
+		return nil
+	}
+	presentFiles := map[string]bool{}
+	presentEnv := map[string]string{}
+	for _, status := range statuses {
+		if status.Provider != auth.Provider {
+			continue
+		}
+		for _, file := range status.Files {
+			if file.Present {
+				presentFiles[file.Path] = true
+			}
+		}
+		for _, env := range status.Env {
+			if env.Present {
+				presentEnv[env.Key] = env.Path
+			}
+		}
+	}
+	overwrites := []string{}
+	for _, file := range auth.Files {
+		if presentFiles[file.ContainerPath] {
+			overwrites = append(overwrites, file.ContainerPath)
+		}
+	}
+	for key := range auth.Env {
+		if path, ok := presentEnv[key]; ok {
+			overwrites = append(overwrites, fmt.Sprintf("%s in %s", key, path))
+		}
+	}
+	sort.Strings(overwrites)
+	return overwrites
+}
+
+func printAuthStatus(out io.Writer, app string, statuses []authbundle.Status) {
+	fmt.Fprintf(out, "Auth in %s:\n", app)
+	for _, status := range statuses {
+		state := "not configured"
+		if status.Configured {
+			state = "configured"
+		}
+		fmt.Fprintf(out, "  %s: %s\n", status.Provider, state)
+		for _, file := range status.Files {
+			if file.Present {
+				fmt.Fprintf(out, "    %s\n", file.Path)
+			}
+		}
+		for _, env := range status.Env {
+			if env.Present {
+				fmt.Fprintf(out, "    %s (%s)\n", env.Key, env.Path)
+			}
+		}
+	}
+}
+
+func promptPushAuth(app string, provider string) bool {
+	fmt.Fprintf(os.Stdout, "Push local %s auth into %s? [Y/n]: ", provider, app)
+	reader := bufio.NewReader(os.Stdin)
+	input, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false
+	}
+	input = strings.TrimSpace(strings.ToLower(input))
+	return input == "" || input == "y" || input == "yes"
+}
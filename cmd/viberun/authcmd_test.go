@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shayne/viberun/internal/agents"
+	"github.com/shayne/viberun/internal/authbundle"
+)
+
+func TestAuthOverwrites(t *testing.T) {
+	auth := &localAuth{
+		Provider: "gemini",
+		Files: []localAuthFile{
+			{LocalPath: "/tmp/creds.json", ContainerPath: "/root/.config/gcloud/application_default_credentials.json"},
+		},
+		Env: map[string]string{
+			"GEMINI_API_KEY": "secret",
+			"GOOGLE_API_KEY": "other",
+		},
+	}
+	statuses := []authbundle.Status{
+		{
+			Provider: "codex",
+			Files:    []authbundle.TargetStatus{{Path: "/root/.codex/auth.json", Present: true}},
+		},
+		{
+			Provider: "gemini",
+			Files: []authbundle.TargetStatus{
+				{Path: "/root/.config/gcloud/application_default_credentials.json", Present: true},
+			},
+			Env: []authbundle.TargetStatus{
+				{Path: "/root/.env", Key: "GEMINI_API_KEY", Present: true},
+				{Path: "/root/.env", Key: "GOOGLE_API_KEY", Present: false},
+			},
+		},
+	}
+	got := authOverwrites(auth, statuses)
+	want := []string{
+		"/root/.config/gcloud/application_default_credentials.json",
+		"GEMINI_API_KEY in /root/.env",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestPrintAuthStatus(t *testing.T) {
+	var out bytes.Buffer
+	printAuthStatus(&out, "myapp", []authbundle.Status{
+		{
+			Provider:   "codex",
+			Configured: true,
+			Files:      []authbundle.TargetStatus{{Path: "/root/.codex/auth.json", Present: true}},
+		},
+		{
+			Provider: "claude",
+			Env:      []authbundle.TargetStatus{{Path: "/root/.claude/settings.json", Key: "ANTHROPIC_API_KEY"}},
+		},
+	})
+	text := out.String()
+	if !strings.Contains(text, "codex: configured\n    /root/.codex/auth.json") {
+		t.Fatalf("expected codex status, got %q", text)
+	}
+	if !strings.Contains(text, "claude: not configured") {
+		t.Fatalf("expected claude status, got %q", text)
+	}
+	if strings.Contains(text, "ANTHROPIC_API_KEY") {
+		t.Fatalf("expected missing keys to be omitted, got %q", text)
+	}
+}
+
+func TestShouldPullAuthFile(t *testing.T) {
+	older := []byte(`{"claudeAiOauth":{"expiresAt":1767225600000}}`)
+	newer := []byte(`{"claudeAiOauth":{"expiresAt":1767229200000}}`)
+	cases := []struct {
+		name        string
+		local       []byte
+		localExists bool
+		remote      []byte
+		want        bool
+	}{
+		{"missing local", nil, false, older, true},
+		{"identical", older, true, older, false},
+		{"container newer", older, true, newer, true},
+		{"local newer", newer, true, older, false},
+		{"no timestamps", []byte(`{"a":1}`), true, []byte(`{"a":2}`), false},
+	}
+	for _, tc := range cases {
+		got, reason := shouldPullAuthFile(tc.local, tc.localExists, tc.remote)
+		if got != tc.want {
+			t.Fatalf("%s: expected %v, got %v (%s)", tc.name, tc.want, got, reason)
+		}
+		if reason == "" {
+			t.Fatalf("%s: expected a reason", tc.name)
+		}
+	}
+}
+
+func TestLocalPathForContainerFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CODEX_HOME", dir)
+	provider, ok := agents.Builtin().Lookup("codex")
+	if !ok {
+		t.Fatalf("expected codex provider")
+	}
+	if got := localPathForContainerFile(provider, "/root/.codex/auth.json"); got != filepath.Join(dir, "auth.json") {
+		t.Fatalf("unexpected local path: %s", got)
+	}
+	if got := localPathForContainerFile(provider, "/root/other.json"); got != "" {
+		t.Fatalf("expected no local path, got %s", got)
+	}
+}
+
+func TestWriteLocalAuthFileIsPrivate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "auth.json")
+	if err := writeLocalAuthFile(path, []byte(`{}`)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected 0600, got %v", info.Mode().Perm())
+	}
+}
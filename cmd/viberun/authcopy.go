@@ -2,18 +2,20 @@ package main
 
 import (
 	"bufio"
-	"crypto/rand"
-	"encoding/base64"
-	"encoding/hex"
-	"encoding/json"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/shayne/viberun/internal/agents"
 	"github.com/shayne/viberun/internal/authbundle"
+	"github.com/shayne/viberun/internal/config"
+	"github.com/shayne/viberun/internal/sshcmd"
+	"github.com/shayne/viberun/internal/target"
 )
 
 type localAuth struct {
@@ -29,104 +31,109 @@ type localAuthFile struct {
 }
 
 func discoverLocalAuth(provider string) (*localAuth, []string, error) {
-	switch strings.ToLower(strings.TrimSpace(provider)) {
-	case "", "codex":
-		return discoverCodexAuth()
-	case "claude", "claude-code":
-		return discoverClaudeAuth()
-	case "gemini":
-		return discoverGeminiAuth()
-	default:
-		return nil, nil, nil
-	}
-}
-
-func discoverCodexAuth() (*localAuth, []string, error) {
-	codexHome := strings.TrimSpace(os.Getenv("CODEX_HOME"))
-	if codexHome == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return nil, nil, err
-		}
-		codexHome = filepath.Join(home, ".codex")
+	registry, err := agents.Load()
+	if err != nil {
+		return nil, nil, err
 	}
-	authPath := filepath.Join(codexHome, "auth.json")
-	info, err := os.Stat(authPath)
-	if err != nil || !info.Mode().IsRegular() {
+	definition, ok := registry.Lookup(provider)
+	if !ok {
 		return nil, nil, nil
 	}
-	auth := &localAuth{
-		Provider: "codex",
-		Files: []localAuthFile{
-			{
-				LocalPath:     authPath,
-				ContainerPath: "/root/.codex/auth.json",
-				Mode:          0o600,
-			},
-		},
-	}
-	details := []string{authPath}
-	return auth, details, nil
+	cfg, _, err := config.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return discoverProviderAuth(definition, providerCredentialSources(cfg, definition))
 }
 
-func discoverClaudeAuth() (*localAuth, []string, error) {
-	env := map[string]string{}
-	details := []string{}
-	if value := strings.TrimSpace(os.Getenv("ANTHROPIC_API_KEY")); value != "" {
-		env["ANTHROPIC_API_KEY"] = value
-		details = append(details, "ANTHROPIC_API_KEY (env)")
-	}
-	if value := strings.TrimSpace(os.Getenv("ANTHROPIC_AUTH_TOKEN")); value != "" {
-		env["ANTHROPIC_AUTH_TOKEN"] = value
-		details = append(details, "ANTHROPIC_AUTH_TOKEN (env)")
-	}
-	if len(env) == 0 {
-		return nil, nil, nil
-	}
-	auth := &localAuth{
-		Provider: "claude",
-		Env:      env,
+// providerCredentialSources returns the configured credential sources for a provider,
+// accepting the provider's aliases as config keys.
+func providerCredentialSources(cfg config.Config, provider agents.Provider) []config.CredentialSource {
+	if sources, ok := cfg.Credentials[provider.Name]; ok {
+		return sources
+	}
+	for _, alias := range provider.Aliases {
+		if sources, ok := cfg.Credentials[alias]; ok {
+			return sources
+		}
 	}
-	return auth, details, nil
+	return nil
 }
 
-func discoverGeminiAuth() (*localAuth, []string, error) {
-	env := map[string]string{}
-	details := []string{}
-	if value := strings.TrimSpace(os.Getenv("GEMINI_API_KEY")); value != "" {
-		env["GEMINI_API_KEY"] = value
-		details = append(details, "GEMINI_API_KEY (env)")
-	}
-	if value := strings.TrimSpace(os.Getenv("GOOGLE_API_KEY")); value != "" {
-		env["GOOGLE_API_KEY"] = value
-		details = append(details, "GOOGLE_API_KEY (env)")
+func discoverProviderAuth(provider agents.Provider, sources []config.CredentialSource) (*localAuth, []string, error) {
+	env, details, err := resolveCredentials(provider.Auth.Env, sources)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	files := []localAuthFile{}
-	if value := strings.TrimSpace(os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")); value != "" {
-		if info, err := os.Stat(value); err == nil && info.Mode().IsRegular() {
-			containerPath := "/root/.config/gcloud/application_default_credentials.json"
-			files = append(files, localAuthFile{
-				LocalPath:     value,
-				ContainerPath: containerPath,
-				Mode:          0o600,
-			})
-			env["GOOGLE_APPLICATION_CREDENTIALS"] = containerPath
-			details = append(details, "GOOGLE_APPLICATION_CREDENTIALS (file)")
+	for _, file := range provider.Auth.Files {
+		path, detail, err := resolveAuthFilePath(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		mode := os.FileMode(file.Mode)
+		if mode == 0 {
+			mode = 0o600
+		}
+		files = append(files, localAuthFile{
+			LocalPath:     path,
+			ContainerPath: file.ContainerPath,
+			Mode:          mode,
+		})
+		if file.SetEnv != "" {
+			env[file.SetEnv] = file.ContainerPath
 		}
+		details = append(details, detail)
 	}
 
 	if len(env) == 0 && len(files) == 0 {
 		return nil, nil, nil
 	}
 	auth := &localAuth{
-		Provider: "gemini",
-		Env:      env,
+		Provider: provider.Name,
 		Files:    files,
 	}
+	if len(env) > 0 {
+		auth.Env = env
+	}
 	return auth, details, nil
 }
 
+// resolveAuthFilePath returns the local path for an auth file and a description of its source.
+func resolveAuthFilePath(file agents.AuthFile) (string, string, error) {
+	if file.PathEnv != "" {
+		if value := strings.TrimSpace(os.Getenv(file.PathEnv)); value != "" {
+			return value, fmt.Sprintf("%s (file via $%s) -> %s", value, file.PathEnv, file.ContainerPath), nil
+		}
+	}
+	path := strings.TrimSpace(file.Path)
+	if path == "" {
+		return "", "", nil
+	}
+	if file.DirEnv != "" {
+		if dir := strings.TrimSpace(os.Getenv(file.DirEnv)); dir != "" {
+			path = filepath.Join(dir, filepath.Base(path))
+			return path, fmt.Sprintf("%s (file via $%s) -> %s", path, file.DirEnv, file.ContainerPath), nil
+		}
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", err
+		}
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	return path, fmt.Sprintf("%s (file) -> %s", path, file.ContainerPath), nil
+}
+
 func promptCopyAuth(app string, provider string, details []string) bool {
 	if len(details) == 0 {
 		return false
@@ -148,7 +155,8 @@ func promptCopyAuth(app string, provider string, details []string) bool {
 	return true
 }
 
-func stageAuthBundle(host string, auth *localAuth) (*authbundle.Bundle, error) {
+// buildAuthBundle reads local credential files into a bundle that is streamed to the host.
+func buildAuthBundle(auth *localAuth) (*authbundle.Bundle, error) {
 	if auth == nil {
 		return nil, nil
 	}
@@ -157,46 +165,53 @@ func stageAuthBundle(host string, auth *localAuth) (*authbundle.Bundle, error) {
 		Env:      auth.Env,
 	}
 	for _, file := range auth.Files {
-		hostPath, err := uploadAuthFile(host, file.LocalPath)
+		data, err := os.ReadFile(file.LocalPath)
 		if err != nil {
 			return nil, err
 		}
 		bundle.Files = append(bundle.Files, authbundle.File{
-			HostPath:      hostPath,
 			ContainerPath: file.ContainerPath,
 			Mode:          int(file.Mode),
+			Data:          data,
 		})
 	}
 	return bundle, nil
 }
 
-func uploadAuthFile(host string, localPath string) (string, error) {
-	token, err := randomToken()
-	if err != nil {
-		return "", err
-	}
-	remotePath := fmt.Sprintf("/tmp/viberun-auth-%s", token)
-	if err := uploadFileOverSSH(host, localPath, remotePath); err != nil {
-		return "", err
-	}
-	return remotePath, nil
+// authBundleCommand builds an ssh command that sends bundle to the server over stdin,
+// keeping secrets out of argv and the remote environment.
+func authBundleCommand(resolved target.Resolved, agentProvider string, actionArgs []string, bundle *authbundle.Bundle) (*exec.Cmd, error) {
+	var payload bytes.Buffer
+	if err := authbundle.Write(&payload, bundle); err != nil {
+		return nil, err
+	}
+	remoteArgs := sshcmd.RemoteArgs(resolved.App, agentProvider, actionArgs, nil)
+	sshArgs := sshcmd.BuildArgs(resolved.Host, remoteArgs, false)
+	cmd := exec.Command("ssh", sshArgs...)
+	cmd.Env = normalizedSshEnv()
+	cmd.Stdin = &payload
+	return cmd, nil
 }
 
-func randomToken() (string, error) {
-	buf := make([]byte, 8)
-	if _, err := rand.Read(buf); err != nil {
+// stageRemoteAuthBundle stores bundle in the host's private staging dir and returns its token.
+func stageRemoteAuthBundle(resolved target.Resolved, agentProvider string, bundle *authbundle.Bundle) (string, error) {
+	cmd, err := authBundleCommand(resolved, agentProvider, []string{"auth", "stage"}, bundle)
+	if err != nil {
 		return "", err
 	}
-	return hex.EncodeToString(buf), nil
-}
-
-func encodeAuthBundle(bundle *authbundle.Bundle) (string, error) {
-	if bundle == nil {
-		return "", nil
-	}
-	data, err := json.Marshal(bundle)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
 	if err != nil {
-		return "", err
+		trimmed := strings.TrimSpace(stderr.String())
+		if trimmed == "" {
+			trimmed = err.Error()
+		}
+		return "", fmt.Errorf("%s", trimmed)
+	}
+	token := strings.TrimSpace(string(output))
+	if token == "" {
+		return "", fmt.Errorf("server returned an empty auth token")
 	}
-	return base64.StdEncoding.EncodeToString(data), nil
+	return token, nil
 }
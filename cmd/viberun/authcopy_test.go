@@ -1,9 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/shayne/viberun/internal/authbundle"
+	"github.com/shayne/viberun/internal/sshcmd"
+	"github.com/shayne/viberun/internal/target"
 )
 
 func TestDiscoverCodexAuth(t *testing.T) {
@@ -36,6 +44,9 @@ func TestDiscoverCodexAuth(t *testing.T) {
 }
 
 func TestDiscoverClaudeAuth(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("CLAUDE_CONFIG_DIR", "")
+	t.Setenv("ANTHROPIC_AUTH_TOKEN", "")
 	t.Setenv("ANTHROPIC_API_KEY", "secret")
 
 	auth, details, err := discoverLocalAuth("claude")
@@ -59,6 +70,8 @@ func TestDiscoverGeminiAuth(t *testing.T) {
 	if err := os.WriteFile(credsPath, []byte(`{"type":"service_account"}`), 0o600); err != nil {
 		t.Fatalf("write creds: %v", err)
 	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GOOGLE_API_KEY", "")
 	t.Setenv("GEMINI_API_KEY", "gem-secret")
 	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credsPath)
 
@@ -82,3 +95,160 @@ func TestDiscoverGeminiAuth(t *testing.T) {
 		t.Fatalf("expected details for gemini auth")
 	}
 }
+
+func TestDiscoverClaudeCredentialsFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CLAUDE_CONFIG_DIR", "")
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	t.Setenv("ANTHROPIC_AUTH_TOKEN", "")
+	credsPath := filepath.Join(home, ".claude", ".credentials.json")
+	if err := os.MkdirAll(filepath.Dir(credsPath), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(credsPath, []byte(`{"claudeAiOauth":{}}`), 0o600); err != nil {
+		t.Fatalf("write creds: %v", err)
+	}
+
+	auth, details, err := discoverLocalAuth("claude")
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if auth == nil || len(auth.Files) != 1 || len(auth.Env) != 0 {
+		t.Fatalf("expected claude credentials file only, got %+v", auth)
+	}
+	if auth.Files[0].ContainerPath != "/root/.claude/.credentials.json" {
+		t.Fatalf("unexpected container path: %s", auth.Files[0].ContainerPath)
+	}
+	want := []string{credsPath + " (file) -> /root/.claude/.credentials.json"}
+	if !reflect.DeepEqual(details, want) {
+		t.Fatalf("unexpected details: %v", details)
+	}
+
+	configDir := t.TempDir()
+	override := filepath.Join(configDir, ".credentials.json")
+	if err := os.WriteFile(override, []byte(`{}`), 0o600); err != nil {
+		t.Fatalf("write override: %v", err)
+	}
+	t.Setenv("CLAUDE_CONFIG_DIR", configDir)
+	auth, details, err = discoverLocalAuth("claude")
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if auth == nil || auth.Files[0].LocalPath != override {
+		t.Fatalf("expected CLAUDE_CONFIG_DIR override, got %+v", auth)
+	}
+	if len(details) != 1 || !strings.Contains(details[0], "via $CLAUDE_CONFIG_DIR") {
+		t.Fatalf("unexpected details: %v", details)
+	}
+}
+
+func TestDiscoverGeminiOAuthFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GEMINI_API_KEY", "")
+	t.Setenv("GOOGLE_API_KEY", "")
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	t.Setenv("CLOUDSDK_CONFIG", "")
+	files := map[string]string{
+		filepath.Join(home, ".gemini", "oauth_creds.json"):                               "/root/.gemini/oauth_creds.json",
+		filepath.Join(home, ".gemini", "google_accounts.json"):                           "/root/.gemini/google_accounts.json",
+		filepath.Join(home, ".config", "gcloud", "application_default_credentials.json"): "/root/.config/gcloud/application_default_credentials.json",
+	}
+	for path := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(`{}`), 0o600); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	auth, details, err := discoverLocalAuth("gemini")
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if auth == nil || len(auth.Files) != len(files) {
+		t.Fatalf("expected %d gemini files, got %+v", len(files), auth)
+	}
+	for _, file := range auth.Files {
+		if files[file.LocalPath] != file.ContainerPath {
+			t.Fatalf("unexpected mapping %s -> %s", file.LocalPath, file.ContainerPath)
+		}
+	}
+	if auth.Env["GOOGLE_APPLICATION_CREDENTIALS"] != "/root/.config/gcloud/application_default_credentials.json" {
+		t.Fatalf("expected credentials env for default ADC file, got %v", auth.Env)
+	}
+	if len(details) != len(files) {
+		t.Fatalf("expected one detail per file, got %v", details)
+	}
+	for local, container := range files {
+		want := local + " (file) -> " + container
+		found := false
+		for _, detail := range details {
+			if detail == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("missing detail %q in %v", want, details)
+		}
+	}
+}
+
+func TestAuthBundleCommandKeepsSecretsOutOfArgv(t *testing.T) {
+	dir := t.TempDir()
+	authPath := filepath.Join(dir, "auth.json")
+	if err := os.WriteFile(authPath, []byte(`{"token":"file-secret"}`), 0o600); err != nil {
+		t.Fatalf("write auth: %v", err)
+	}
+	auth := &localAuth{
+		Provider: "claude",
+		Files:    []localAuthFile{{LocalPath: authPath, ContainerPath: "/root/.claude/.credentials.json", Mode: 0o600}},
+		Env:      map[string]string{"ANTHROPIC_API_KEY": "env-secret"},
+	}
+	bundle, err := buildAuthBundle(auth)
+	if err != nil {
+		t.Fatalf("build bundle: %v", err)
+	}
+	resolved := target.Resolved{App: "myapp", Host: "host-a"}
+	for _, actionArgs := range [][]string{{"auth", "stage"}, {"auth", "push", "claude"}} {
+		cmd, err := authBundleCommand(resolved, "claude", actionArgs, bundle)
+		if err != nil {
+			t.Fatalf("command: %v", err)
+		}
+		argv := strings.Join(cmd.Args, " ")
+		for _, secret := range []string{"file-secret", "env-secret"} {
+			if strings.Contains(argv, secret) {
+				t.Fatalf("secret %q leaked into argv: %v", secret, cmd.Args)
+			}
+		}
+		if strings.Contains(argv, "VIBERUN_AUTH_BUNDLE") {
+			t.Fatalf("unexpected auth bundle env in argv: %v", cmd.Args)
+		}
+		payload, err := io.ReadAll(cmd.Stdin)
+		if err != nil {
+			t.Fatalf("read stdin: %v", err)
+		}
+		decoded, err := authbundle.Read(bytes.NewReader(payload))
+		if err != nil {
+			t.Fatalf("decode stdin: %v", err)
+		}
+		if decoded.Env["ANTHROPIC_API_KEY"] != "env-secret" || string(decoded.Files[0].Data) != `{"token":"file-secret"}` {
+			t.Fatalf("expected secrets on stdin, got %+v", decoded)
+		}
+	}
+}
+
+func TestSessionRemoteArgsCarryOnlyAuthToken(t *testing.T) {
+	args := sshcmd.RemoteArgs("myapp", "claude", nil, map[string]string{
+		"VIBERUN_AUTH_TOKEN": "0123456789abcdef0123456789abcdef",
+	})
+	argv := strings.Join(args, " ")
+	if !strings.Contains(argv, "VIBERUN_AUTH_TOKEN=0123456789abcdef0123456789abcdef") {
+		t.Fatalf("expected auth token in remote env, got %v", args)
+	}
+	if strings.Contains(argv, "VIBERUN_AUTH_BUNDLE") {
+		t.Fatalf("unexpected auth bundle in remote env: %v", args)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shayne/viberun/internal/rpc"
+	"github.com/shayne/viberun/internal/sshcmd"
+	"github.com/shayne/viberun/internal/target"
+)
+
+// maxAutoForwards bounds how many ports one session forwards on its own.
+const maxAutoForwards = 20
+
+// autoForwarder forwards ports the container starts listening on through the session's
+// ssh control socket, and cancels the forwards when the listeners go away. The server
+// reports the ports over the session socket.
+type autoForwarder struct {
+	host        string
+	controlPath string
+	opens       *openPolicy
+	// target resolves where the host reaches a container port: its published port on
+	// 127.0.0.1, or the container's address where the engine routes to it.
+	target func(port int) (string, int, error)
+	// ssh runs ssh with args and returns its error output on failure.
+	ssh func(args []string) error
+
+	mu        sync.Mutex
+	forwarded map[int]sshcmd.LocalForward
+	// announced holds ports already reported as not forwardable.
+	announced map[int]bool
+}
+
+func newAutoForwarder(resolved target.Resolved, agentProvider string, controlPath string, opens *openPolicy) *autoForwarder {
+	ssh := func(args []string) error {
+		cmd := exec.Command("ssh", args...)
+		cmd.Env = normalizedSshEnv()
+		if out, err := cmd.CombinedOutput(); err != nil {
+			trimmed := strings.TrimSpace(string(out))
+			if trimmed == "" {
+				trimmed = err.Error()
+			}
+			return fmt.Errorf("%s", trimmed)
+		}
+		return nil
+	}
+	return &autoForwarder{
+		host:        resolved.Host,
+		controlPath: controlPath,
+		opens:       opens,
+		target: func(port int) (string, int, error) {
+			remoteArgs := sshcmd.RemoteArgs(resolved.App, agentProvider, []string{"address", strconv.Itoa(port)}, nil)
+			sshArgs := append([]string{"-S", controlPath}, sshcmd.BuildArgs(resolved.Host, remoteArgs, false)...)
+			cmd := exec.Command("ssh", sshArgs...)
+			cmd.Env = normalizedSshEnv()
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				trimmed := strings.TrimSpace(string(out))
+				if trimmed == "" {
+					trimmed = err.Error()
+				}
+				return "", 0, fmt.Errorf("%s", trimmed)
+			}
+			return parseForwardTarget(string(out))
+		},
+		ssh:       ssh,
+		forwarded: map[int]sshcmd.LocalForward{},
+		announced: map[int]bool{},
+	}
+}
+
+// Update is the rpc.Handler ports endpoint. ports is every port the container listens
+// on; the result announces each change in the session.
+func (f *autoForwarder) Update(ports []rpc.ListeningPort) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	messages := []string{}
+	listening := map[int]bool{}
+	for _, port := range ports {
+		listening[port.Port] = true
+		if _, ok := f.forwarded[port.Port]; ok {
+			continue
+		}
+		if message, ok := f.forward(port); ok || !f.announced[port.Port] {
+			messages = append(messages, message)
+			f.announced[port.Port] = !ok
+		}
+	}
+	for port, forward := range f.forwarded {
+		if listening[port] {
+			continue
+		}
+		_ = f.ssh(sshcmd.BuildControlForwardArgs(f.host, f.controlPath, "cancel", forward))
+		f.opens.revokeLocalPort(forward.LocalPort)
+		delete(f.forwarded, port)
+	}
+	for port := range f.announced {
+		if !listening[port] {
+			delete(f.announced, port)
+		}
+	}
+	return messages, nil
+}
+
+// forward adds one forward and returns the message announcing it, or why it was skipped.
+func (f *autoForwarder) forward(port rpc.ListeningPort) (string, bool) {
+	if port.Loopback {
+		return fmt.Sprintf("Port %d only listens on localhost in the container; bind it to 0.0.0.0 to forward it", port.Port), false
+	}
+	if len(f.forwarded) >= maxAutoForwards {
+		return fmt.Sprintf("Not forwarding port %d: already forwarding %d ports", port.Port, maxAutoForwards), false
+	}
+	remoteHost, remotePort, err := f.target(port.Port)
+	if err != nil {
+		return fmt.Sprintf("Not forwarding port %d: %v", port.Port, err), false
+	}
+	local, err := freeLocalPort(port.Port)
+	if err != nil {
+		return fmt.Sprintf("Not forwarding port %d: %v", port.Port, err), false
+	}
+	forward := sshcmd.LocalForward{LocalPort: local, RemoteHost: remoteHost, RemotePort: remotePort}
+	if err := f.ssh(sshcmd.BuildControlForwardArgs(f.host, f.controlPath, "forward", forward)); err != nil {
+		return fmt.Sprintf("Not forwarding port %d: %v", port.Port, err), false
+	}
+	f.forwarded[port.Port] = forward
+	f.opens.allowLocalPort(local)
+	return fmt.Sprintf("Forwarded port %d to http://localhost:%d", port.Port, local), true
+}
+
+// newControlPath returns a path for the session's ssh control socket, kept short
+// because ssh appends a suffix and socket paths are limited to about 100 bytes.
+func newControlPath() string {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return filepath.Join(os.TempDir(), fmt.Sprintf("viberun-ssh-%d", os.Getpid()))
+	}
+	return filepath.Join(os.TempDir(), "viberun-ssh-"+hex.EncodeToString(buf))
+}
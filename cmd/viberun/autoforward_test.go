@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/shayne/viberun/internal/config"
+	"github.com/shayne/viberun/internal/rpc"
+	"github.com/shayne/viberun/internal/sshcmd"
+)
+
+func TestAutoForwarderUpdate(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	busy := listener.Addr().(*net.TCPAddr).Port
+
+	calls := []string{}
+	targets := []int{}
+	forwarder := &autoForwarder{
+		host:        "host-a",
+		controlPath: "/tmp/vr.sock",
+		opens:       newOpenPolicy(config.RPCConfig{}, "myapp"),
+		target: func(port int) (string, int, error) {
+			targets = append(targets, port)
+			return "127.0.0.1", 40000, nil
+		},
+		ssh: func(args []string) error {
+			calls = append(calls, strings.Join(args[2:6], " "))
+			return nil
+		},
+		forwarded: map[int]sshcmd.LocalForward{},
+		announced: map[int]bool{},
+	}
+
+	messages, err := forwarder.Update([]rpc.ListeningPort{{Port: busy}, {Port: 9229, Loopback: true}})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if len(messages) != 2 || !strings.Contains(messages[0], "Forwarded port") || !strings.Contains(messages[1], "0.0.0.0") {
+		t.Fatalf("unexpected messages %q", messages)
+	}
+	forward := forwarder.forwarded[busy]
+	local := forward.LocalPort
+	if forward.RemoteHost != "127.0.0.1" || forward.RemotePort != 40000 {
+		t.Fatalf("expected the forward to target the published port, got %+v", forward)
+	}
+	if local == busy || local == 0 {
+		t.Fatalf("expected a remapped local port for busy %d, got %d", busy, local)
+	}
+	if !forwarder.opens.forwarded(local) {
+		t.Fatalf("expected the open policy to allow localhost:%d", local)
+	}
+
+	// Unchanged ports announce nothing new.
+	if messages, _ := forwarder.Update([]rpc.ListeningPort{{Port: busy}, {Port: 9229, Loopback: true}}); len(messages) != 0 {
+		t.Fatalf("expected no messages, got %q", messages)
+	}
+	// A listener that goes away is cancelled.
+	if _, err := forwarder.Update(nil); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if len(forwarder.forwarded) != 0 || len(calls) != 2 || !strings.HasPrefix(calls[1], "-O cancel") {
+		t.Fatalf("expected the forward to be cancelled, got %v %v", forwarder.forwarded, calls)
+	}
+	if forwarder.opens.forwarded(local) {
+		t.Fatalf("expected the open policy to stop allowing localhost:%d", local)
+	}
+	if len(targets) != 1 || targets[0] != busy {
+		t.Fatalf("expected port %d to be resolved once, got %v", busy, targets)
+	}
+}
+
+func TestAutoForwarderReportsRootlessPorts(t *testing.T) {
+	sshCalls := 0
+	forwarder := &autoForwarder{
+		opens: newOpenPolicy(config.RPCConfig{}, "myapp"),
+		target: func(port int) (string, int, error) {
+			return "", 0, errors.New("port 5173 is not published, and rootless podman containers cannot be reached from the host by address")
+		},
+		ssh: func([]string) error {
+			sshCalls++
+			return nil
+		},
+		forwarded: map[int]sshcmd.LocalForward{},
+		announced: map[int]bool{},
+	}
+	messages, _ := forwarder.Update([]rpc.ListeningPort{{Port: 5173}})
+	if len(messages) != 1 || !strings.Contains(messages[0], "rootless") || sshCalls != 0 {
+		t.Fatalf("unexpected messages %q", messages)
+	}
+	if messages, _ := forwarder.Update([]rpc.ListeningPort{{Port: 5173}}); len(messages) != 0 {
+		t.Fatalf("expected a failure to be announced once, got %q", messages)
+	}
+}
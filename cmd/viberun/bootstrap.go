@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/shayne/viberun/internal/bootstrap"
+	"github.com/shayne/viberun/internal/bundle"
+	"github.com/shayne/viberun/internal/config"
+	"github.com/shayne/viberun/internal/engine"
+	"github.com/shayne/viberun/internal/release"
+	"github.com/shayne/viberun/internal/sshcmd"
+	"github.com/shayne/viberun/internal/target"
+	"github.com/shayne/viberun/internal/tui"
+	"github.com/shayne/viberun/internal/version"
+	"github.com/shayne/yargs"
+)
+
+const defaultServerRepo = "shayne/viberun"
+
+func handleBootstrap(args []string) {
+	result, err := yargs.ParseAndHandleHelp[struct{}, bootstrapFlags, bootstrapArgs](args, helpConfig)
+	if errors.Is(err, yargs.ErrShown) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	flags := result.SubCommandFlags
+	hostArg := strings.TrimSpace(result.Args.Host)
+	runtimeName := strings.TrimSpace(flags.Runtime)
+	if runtimeName != "" && !engine.Valid(runtimeName) {
+		fmt.Fprintf(os.Stderr, "unsupported runtime %q (expected docker or podman)\n", runtimeName)
+		os.Exit(2)
+	}
+	bundlePath := strings.TrimSpace(flags.Bundle)
+	var manifest bundle.Manifest
+	if bundlePath != "" {
+		if flags.Local || flags.LocalPath != "" || flags.LocalImage {
+			fmt.Fprintln(os.Stderr, "--bundle cannot be combined with --local, --local-path or --local-image")
+			os.Exit(2)
+		}
+		manifest, err = bundle.ReadManifest(bundlePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read bundle: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	cfg, path, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	resolved, err := target.ResolveHost(hostArg, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid host: %v\n", err)
+		os.Exit(2)
+	}
+
+	if _, err := exec.LookPath("ssh"); err != nil {
+		fmt.Fprintln(os.Stderr, "ssh is required but was not found in PATH")
+		os.Exit(1)
+	}
+
+	tty := term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+	action := "bootstrap"
+	if flags.Check {
+		action = "bootstrap --check"
+	}
+	ui := tui.NewProgress(os.Stdout, tty, action, resolved.Host)
+	ui.Start()
+	defer ui.Stop()
+	staged := ""
+	stagedImage := ""
+	exit := func(code int) {
+		for _, path := range []string{staged, stagedImage} {
+			if path != "" {
+				_, _ = sshOutput(resolved.Host, []string{"rm", "-f", shellQuote(path)})
+			}
+		}
+		ui.Stop()
+		os.Exit(code)
+	}
+	fail := func(step string, err error) {
+		ui.Fail(err.Error())
+		fmt.Fprintf(os.Stderr, "failed to %s: %v\n", step, err)
+		exit(1)
+	}
+
+	repo := strings.TrimSpace(os.Getenv("VIBERUN_SERVER_REPO"))
+	if repo == "" {
+		repo = defaultServerRepo
+	}
+	targetVersion := bootstrapTargetVersion()
+	offline := bundlePath != ""
+	if offline {
+		targetVersion = manifest.Version
+	}
+	localBootstrap := flags.Local
+	localPath := strings.TrimSpace(flags.LocalPath)
+	localImage := flags.LocalImage
+	if localPath != "" {
+		localBootstrap = true
+	}
+	if isDevRun() && !offline {
+		localBootstrap = true
+		localImage = true
+	}
+
+	image := bootstrapImage(repo, targetVersion)
+	source := release.Source{
+		BaseURL: strings.TrimSpace(os.Getenv("VIBERUN_RELEASE_BASE_URL")),
+		Repo:    repo,
+		Version: targetVersion,
+	}
+	var releaseKey ed25519.PublicKey
+	if offline {
+		image = manifest.Image
+	} else if !localBootstrap || !localImage {
+		ui.Step("Verify release")
+		releaseKey, err = pinnedReleaseKey(flags.InsecureSkipSignature)
+		if err != nil {
+			fail("verify release", err)
+		}
+		if !localImage && strings.TrimSpace(os.Getenv("VIBERUN_IMAGE")) == "" {
+			image, err = fetchReleaseImage(source, releaseKey)
+			if err != nil {
+				fail("verify release", err)
+			}
+		}
+		if releaseKey == nil {
+			ui.Done(image + " (signature NOT verified: --insecure-skip-signature)")
+		} else {
+			ui.Done(image)
+		}
+	}
+	env := []string{
+		"VIBERUN_SERVER_REPO=" + repo,
+		"VIBERUN_SERVER_VERSION=" + targetVersion,
+		"VIBERUN_IMAGE=" + image,
+	}
+	if localImage {
+		env = append(env, "VIBERUN_SKIP_IMAGE_PULL=1")
+	}
+	if offline {
+		env = append(env, "VIBERUN_OFFLINE=1")
+	}
+	if flags.ExistingDocker {
+		env = append(env, "VIBERUN_EXISTING_DOCKER=1")
+	}
+	if runtimeName != "" {
+		env = append(env, "VIBERUN_RUNTIME="+runtimeName)
+	}
+
+	serverPath := ""
+	if !offline && !localBootstrap && !flags.Force {
+		ui.Step("Check server version")
+		if info, err := serverInfo(resolved.Host, true); err != nil {
+			ui.Done("not installed")
+		} else if serverAtVersion(info, targetVersion) && info.Has(version.CapabilityBootstrap) {
+			ui.Done(info.Version + ", up to date")
+			serverPath = "viberun-server"
+		} else {
+			ui.Done(fmt.Sprintf("%s -> %s", info.Version, targetVersion))
+		}
+	}
+	if serverPath == "" {
+		ui.Step("Stage server binary")
+		switch {
+		case offline:
+			staged, err = stageBundleServerBinary(resolved.Host, bundlePath, manifest)
+		case localBootstrap:
+			staged, err = stageLocalServerBinary(resolved.Host, localPath)
+		default:
+			staged, err = stageReleaseServerBinary(resolved.Host, source, releaseKey)
+		}
+		if err != nil {
+			fail("stage server binary", err)
+		}
+		ui.Done("")
+		serverPath = staged
+		env = append(env, "VIBERUN_SERVER_LOCAL_PATH="+staged)
+	}
+	if offline && !flags.Check {
+		ui.Step("Upload image archive")
+		stagedImage, err = stageBundleImage(resolved.Host, bundlePath, manifest)
+		if err != nil {
+			fail("upload image archive", err)
+		}
+		ui.Done(manifest.Image)
+		env = append(env, "VIBERUN_IMAGE_ARCHIVE="+stagedImage)
+	}
+	ui.Step("Check sudo")
+	mode, err := remoteSudoMode(resolved.Host)
+	if err != nil {
+		fail("check sudo", err)
+	}
+	password := ""
+	if mode == "password" {
+		if !tty {
+			fail("check sudo", fmt.Errorf("sudo needs a password; run bootstrap from a terminal"))
+		}
+		ui.Suspend()
+		password, err = promptSudoPassword(resolved.Host)
+		ui.Resume()
+		if err != nil {
+			fail("check sudo", err)
+		}
+	}
+	ui.Done(mode)
+
+	bootstrapArgs := []string{serverPath, "bootstrap"}
+	if flags.Check {
+		bootstrapArgs = append(bootstrapArgs, "--check")
+	}
+	remoteArgs := bootstrapRemoteArgs(mode, env, bootstrapArgs)
+	sshArgs := sshcmd.BuildArgs(resolved.Host, remoteArgs, false)
+	sshArgs = append([]string{"-o", "LogLevel=ERROR"}, sshArgs...)
+	cmd := exec.Command("ssh", sshArgs...)
+	cmd.Env = normalizedSshEnv()
+	if password != "" {
+		cmd.Stdin = strings.NewReader(password + "\n")
+	}
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		fail("run bootstrap", err)
+	}
+	if err := cmd.Start(); err != nil {
+		fail("run bootstrap", err)
+	}
+	summary := renderBootstrapEvents(stdout, ui)
+	runErr := cmd.Wait()
+
+	if flags.Check {
+		if summary.Drift > 0 {
+			fmt.Fprintf(os.Stdout, "%d step(s) would change; run `viberun bootstrap` to apply.\n", summary.Drift)
+			exit(1)
+		}
+		if runErr != nil {
+			exit(1)
+		}
+		fmt.Fprintln(os.Stdout, "Host is up to date.")
+		exit(0)
+	}
+	if runErr != nil || summary.Failed {
+		exit(1)
+	}
+
+	if localImage {
+		ui.Step("Build container image")
+		ui.Suspend()
+		if err := stageLocalImage(resolved.Host, fallbackRuntime(runtimeName)); err != nil {
+			ui.Resume()
+			fail("stage local image", err)
+		}
+		ui.Resume()
+		ui.Done("")
+	}
+	for _, path := range []string{staged, stagedImage} {
+		if path != "" {
+			_, _ = sshOutput(resolved.Host, []string{"rm", "-f", shellQuote(path)})
+		}
+	}
+	forgetServerVersion(resolved.Host)
+	if len(summary.Changes) == 0 {
+		fmt.Fprintln(os.Stdout, "No changes; host was already bootstrapped.")
+	}
+	if strings.TrimSpace(cfg.DefaultHost) == "" && strings.TrimSpace(hostArg) != "" {
+		cfg.DefaultHost = hostArg
+		if err := config.Save(path, cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Bootstrap complete, but failed to save default host: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Run `viberun config --host %s` to set it manually.\n", hostArg)
+		} else {
+			fmt.Fprintf(os.Stdout, "default host set to %s\n", hostArg)
+		}
+	}
+	fmt.Fprintln(os.Stdout, "Bootstrap complete.")
+}
+
+type bootstrapSummary struct {
+	Changes []string
+	Drift   int
+	Failed  bool
+}
+
+// renderBootstrapEvents turns the server's JSON step events into progress lines. Any
+// other output is passed through as info.
+func renderBootstrapEvents(r io.Reader, ui *tui.Progress) bootstrapSummary {
+	summary := bootstrapSummary{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var event bootstrap.Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil || event.Status == "" {
+			ui.Info(line)
+			continue
+		}
+		switch event.Status {
+		case bootstrap.StatusStart:
+			ui.Step(event.Title)
+		case bootstrap.StatusOK:
+			ui.Done(event.Detail)
+		case bootstrap.StatusChanged:
+			ui.Done("changed: " + event.Detail)
+		case bootstrap.StatusDrift:
+			summary.Drift++
+			ui.Fail("would change: " + event.Detail)
+		case bootstrap.StatusFailed:
+			summary.Failed = true
+			ui.Fail(event.Detail)
+		case bootstrap.StatusDone:
+			summary.Changes = event.Changes
+		}
+	}
+	return summary
+}
+
+// fallbackRuntime is the runtime to drive directly over ssh when none was chosen.
+func fallbackRuntime(runtimeName string) string {
+	if runtimeName == "" {
+		return engine.Docker
+	}
+	return runtimeName
+}
+
+// bootstrapImage is the release image for a server version.
+func bootstrapImage(repo string, serverVersion string) string {
+	if value := strings.TrimSpace(os.Getenv("VIBERUN_IMAGE")); value != "" {
+		return value
+	}
+	tag := strings.TrimSpace(serverVersion)
+	if tag == "" {
+		tag = "latest"
+	}
+	return fmt.Sprintf("ghcr.io/%s/viberun:%s", repo, tag)
+}
+
+// bootstrapRemoteArgs runs the staged server as root, reading the sudo password from
+// stdin when one is needed so it never appears in argv.
+func bootstrapRemoteArgs(sudoMode string, env []string, command []string) []string {
+	args := []string{}
+	switch sudoMode {
+	case "nopasswd":
+		args = append(args, "sudo", "-n")
+	case "password":
+		args = append(args, "sudo", "-S", "-p", "''")
+	}
+	if len(env) > 0 {
+		args = append(args, "env")
+		for _, entry := range env {
+			args = append(args, shellQuote(entry))
+		}
+	}
+	for _, part := range command {
+		args = append(args, shellQuote(part))
+	}
+	return args
+}
+
+// remoteSudoMode reports how the host runs privileged commands: root, nopasswd or password.
+func remoteSudoMode(host string) (string, error) {
+	probe := `if [ "$(id -u)" -eq 0 ]; then echo root; elif ! command -v sudo >/dev/null 2>&1; then echo none; elif sudo -n true 2>/dev/null; then echo nopasswd; else echo password; fi`
+	mode, err := sshOutput(host, []string{probe})
+	if err != nil {
+		return "", err
+	}
+	mode = strings.TrimSpace(mode)
+	switch mode {
+	case "root", "nopasswd", "password":
+		return mode, nil
+	case "none":
+		return "", fmt.Errorf("sudo is required to bootstrap as a non-root user")
+	default:
+		return "", fmt.Errorf("unexpected sudo probe response: %q", mode)
+	}
+}
+
+func promptSudoPassword(host string) (string, error) {
+	fmt.Fprintf(os.Stdout, "sudo password for %s: ", host)
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stdout)
+	if err != nil {
+		return "", err
+	}
+	return string(password), nil
+}
+
+// fetchReleaseImage returns the release image pinned by digest, read from a signed asset.
+func fetchReleaseImage(source release.Source, key ed25519.PublicKey) (string, error) {
+	assets, err := fetchRelease(source, key, release.ImageAsset)
+	if err != nil {
+		return "", err
+	}
+	return release.ParseImageRef(assets[0].Data)
+}
+
+// pinnedReleaseKey returns the release signing key built into this binary. With
+// insecure it warns and returns nil, and downloads are checked against the unsigned
+// checksums only.
+func pinnedReleaseKey(insecure bool) (ed25519.PublicKey, error) {
+	if insecure {
+		fmt.Fprintln(os.Stderr, "WARNING: --insecure-skip-signature: release signatures are NOT checked. SHA256SUMS comes from the same server as the downloads, so a tampered release would be installed.")
+		return nil, nil
+	}
+	key, err := release.PinnedKey()
+	if err != nil {
+		return nil, fmt.Errorf("this build has no usable release signing key: %w", err)
+	}
+	return key, nil
+}
+
+// fetchRelease downloads release assets and checks them against the signed checksums,
+// or only against the unsigned checksums when key is nil (--insecure-skip-signature).
+func fetchRelease(source release.Source, key ed25519.PublicKey, assets ...string) ([]release.Verified, error) {
+	if key == nil {
+		return source.FetchUnsigned(assets...)
+	}
+	return source.Fetch(key, assets...)
+}
+
+// stageReleaseServerBinary downloads the release server for the host's architecture,
+// verifies it against the signed checksums, and uploads it to the host.
+func stageReleaseServerBinary(host string, source release.Source, key ed25519.PublicKey) (string, error) {
+	osName, arch, err := detectRemotePlatform(host)
+	if err != nil {
+		return "", err
+	}
+	if osName != "linux" {
+		return "", fmt.Errorf("unsupported remote OS: %s", osName)
+	}
+	assets, err := fetchRelease(source, key, fmt.Sprintf("viberun-server-%s-%s", osName, arch))
+	if err != nil {
+		return "", err
+	}
+	tmpFile, err := os.CreateTemp("", "viberun-server-")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+	if _, err := tmpFile.Write(assets[0].Data); err != nil {
+		_ = tmpFile.Close()
+		return "", err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return "", err
+	}
+	return uploadServerBinary(host, tmpPath)
+}
+
+// stageBundleServerBinary uploads the bundle's server for the host's architecture, after
+// checking that the bundled image was built for the same architecture.
+func stageBundleServerBinary(host string, path string, manifest bundle.Manifest) (string, error) {
+	osName, arch, err := detectRemotePlatform(host)
+	if err != nil {
+		return "", err
+	}
+	if osName != "linux" {
+		return "", fmt.Errorf("unsupported remote OS: %s", osName)
+	}
+	if manifest.ImageArch != arch {
+		return "", fmt.Errorf("bundle image is for %s but %s is %s; create one with `viberun bundle create --arch %s`", manifest.ImageArch, host, arch, arch)
+	}
+	tmpDir, err := os.MkdirTemp("", "viberun-bundle-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	local := filepath.Join(tmpDir, bundle.ServerBinary(arch))
+	if err := bundle.Extract(path, manifest, bundle.ServerBinary(arch), local); err != nil {
+		return "", err
+	}
+	return uploadServerBinary(host, local)
+}
+
+// stageBundleImage uploads the bundle's image archive to a temp path on the host.
+func stageBundleImage(host string, path string, manifest bundle.Manifest) (string, error) {
+	tmpDir, err := os.MkdirTemp("", "viberun-bundle-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	local := filepath.Join(tmpDir, bundle.ImageArchive)
+	if err := bundle.Extract(path, manifest, bundle.ImageArchive, local); err != nil {
+		return "", err
+	}
+	remotePath := fmt.Sprintf("/tmp/viberun-image-%d.tar", time.Now().UnixNano())
+	if err := uploadFileOverSSH(host, local, remotePath); err != nil {
+		_, _ = sshOutput(host, []string{"rm", "-f", shellQuote(remotePath)})
+		return "", err
+	}
+	return remotePath, nil
+}
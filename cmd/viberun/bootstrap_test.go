@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shayne/viberun/internal/tui"
+)
+
+func TestRenderBootstrapEvents(t *testing.T) {
+	stream := strings.Join([]string{
+		`{"step":"os","title":"Check OS","status":"start"}`,
+		`{"step":"os","status":"ok","detail":"Ubuntu 24.04 LTS"}`,
+		`{"step":"docker","title":"Install docker","status":"start"}`,
+		`{"step":"docker","status":"changed","detail":"installed docker"}`,
+		`{"step":"image","title":"Pull image","status":"start"}`,
+		`{"step":"image","status":"drift","detail":"viberun:latest is missing"}`,
+		`a stray line`,
+		`{"status":"done","changes":["docker: installed docker"]}`,
+	}, "\n")
+	var out bytes.Buffer
+	ui := tui.NewProgress(&out, false, "bootstrap", "myhost")
+	summary := renderBootstrapEvents(strings.NewReader(stream), ui)
+
+	if summary.Drift != 1 || summary.Failed {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if !reflect.DeepEqual(summary.Changes, []string{"docker: installed docker"}) {
+		t.Fatalf("unexpected changes: %v", summary.Changes)
+	}
+	text := out.String()
+	for _, want := range []string{
+		`status=ok step="Check OS" detail="Ubuntu 24.04 LTS"`,
+		`status=ok step="Install docker" detail="changed: installed docker"`,
+		`status=err step="Pull image" detail="would change: viberun:latest is missing"`,
+		`a stray line`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("output missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestBootstrapRemoteArgs(t *testing.T) {
+	env := []string{"VIBERUN_IMAGE=ghcr.io/shayne/viberun/viberun:v1.0.0"}
+	got := bootstrapRemoteArgs("password", env, []string{"/tmp/viberun-server-abc", "bootstrap"})
+	want := []string{"sudo", "-S", "-p", "''", "env", "'VIBERUN_IMAGE=ghcr.io/shayne/viberun/viberun:v1.0.0'", "'/tmp/viberun-server-abc'", "'bootstrap'"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected args:\n got %v\nwant %v", got, want)
+	}
+	got = bootstrapRemoteArgs("root", nil, []string{"viberun-server", "bootstrap", "--check"})
+	want = []string{"'viberun-server'", "'bootstrap'", "'--check'"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected root args: %v", got)
+	}
+}
+
+func TestBootstrapImage(t *testing.T) {
+	t.Setenv("VIBERUN_IMAGE", "")
+	if got := bootstrapImage("shayne/viberun", "v1.2.0"); got != "ghcr.io/shayne/viberun/viberun:v1.2.0" {
+		t.Fatalf("unexpected image: %s", got)
+	}
+	if got := bootstrapImage("shayne/viberun", "latest"); got != "ghcr.io/shayne/viberun/viberun:latest" {
+		t.Fatalf("unexpected latest image: %s", got)
+	}
+	t.Setenv("VIBERUN_IMAGE", "registry.local/viberun:test")
+	if got := bootstrapImage("shayne/viberun", "v1.2.0"); got != "registry.local/viberun:test" {
+		t.Fatalf("expected VIBERUN_IMAGE override, got %s", got)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/shayne/viberun/internal/bundle"
+	"github.com/shayne/viberun/internal/release"
+	"github.com/shayne/viberun/internal/tui"
+	"github.com/shayne/viberun/internal/version"
+	"github.com/shayne/yargs"
+)
+
+type bundleFlags struct {
+	Output string `flag:"output" short:"o" help:"bundle file to write (default viberun-bundle-<version>-<arch>.tar.gz)"`
+	Arch   string `flag:"arch" help:"host architecture for the container image (amd64 or arm64)"`
+	Local  bool   `flag:"local" help:"build the server and image from this checkout instead of the release"`
+	// InsecureSkipSignature is the only way past a missing or bad release signature.
+	InsecureSkipSignature bool `flag:"insecure-skip-signature" help:"INSECURE: bundle a release whose SHA256SUMS signature is missing or does not verify"`
+}
+
+type bundleArgs struct {
+	Action string `pos:"0" help:"create"`
+}
+
+func handleBundleCommand(_ context.Context, args []string) error {
+	result, err := yargs.ParseAndHandleHelp[struct{}, bundleFlags, bundleArgs](args, helpConfig)
+	if errors.Is(err, yargs.ErrShown) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if result.Args.Action != "create" {
+		return fmt.Errorf("unknown bundle action %q (expected create)", result.Args.Action)
+	}
+	return createBundle(result.SubCommandFlags)
+}
+
+// createBundle writes an offline bootstrap bundle: the server for every arch, the image
+// for one arch as a `docker save` tarball, and a manifest with their checksums.
+func createBundle(flags bundleFlags) error {
+	arch := "amd64"
+	if strings.TrimSpace(flags.Arch) != "" {
+		var err error
+		arch, err = normalizeArch(flags.Arch)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		return fmt.Errorf("docker is required to create a bundle")
+	}
+	local := flags.Local || isDevRun()
+	bundleVersion := bootstrapTargetVersion()
+	if local {
+		bundleVersion = version.String()
+	}
+	output := strings.TrimSpace(flags.Output)
+	if output == "" {
+		output = bundleFileName(bundleVersion, arch)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "viberun-bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tty := term.IsTerminal(int(os.Stdout.Fd()))
+	ui := tui.NewProgress(os.Stdout, tty, "bundle create", "local")
+	ui.Start()
+	defer ui.Stop()
+
+	files := []bundle.File{}
+	for _, serverArch := range bundle.Arches {
+		files = append(files, bundle.File{
+			Name: bundle.ServerBinary(serverArch),
+			Path: filepath.Join(tmpDir, bundle.ServerBinary(serverArch)),
+		})
+	}
+	sourceImage := ""
+	fetched := strings.Join(bundle.Arches, ", ")
+	ui.Step("Fetch server binaries")
+	if local {
+		for i, serverArch := range bundle.Arches {
+			if err := buildServerBinary(serverArch, files[i].Path); err != nil {
+				ui.Fail(err.Error())
+				return err
+			}
+		}
+	} else {
+		sourceImage, err = fetchReleaseBundleFiles(bundleVersion, files, flags.InsecureSkipSignature)
+		if err != nil {
+			ui.Fail(err.Error())
+			return err
+		}
+		if flags.InsecureSkipSignature {
+			fetched += " (signature NOT verified: --insecure-skip-signature)"
+		}
+	}
+	ui.Done(fetched)
+
+	imageTag := bundleImageTag(bundleVersion)
+	imagePath := filepath.Join(tmpDir, bundle.ImageArchive)
+	ui.Step("Save container image")
+	ui.Suspend()
+	err = saveBundleImage(sourceImage, imageTag, arch, imagePath)
+	ui.Resume()
+	if err != nil {
+		ui.Fail(err.Error())
+		return err
+	}
+	ui.Done(imageTag + " (linux/" + arch + ")")
+	files = append(files, bundle.File{Name: bundle.ImageArchive, Path: imagePath})
+
+	ui.Step("Write bundle")
+	manifest := bundle.Manifest{
+		Version:   bundleVersion,
+		Image:     imageTag,
+		ImageArch: arch,
+		Created:   time.Now().UTC(),
+	}
+	if err := bundle.Write(output, manifest, files); err != nil {
+		ui.Fail(err.Error())
+		return err
+	}
+	ui.Done(output)
+	return nil
+}
+
+// fetchReleaseBundleFiles downloads and verifies the release servers into files and
+// returns the release image pinned by digest.
+func fetchReleaseBundleFiles(releaseVersion string, files []bundle.File, insecure bool) (string, error) {
+	key, err := pinnedReleaseKey(insecure)
+	if err != nil {
+		return "", fmt.Errorf("%w; use --local to bundle a local build", err)
+	}
+	repo := strings.TrimSpace(os.Getenv("VIBERUN_SERVER_REPO"))
+	if repo == "" {
+		repo = defaultServerRepo
+	}
+	source := release.Source{
+		BaseURL: strings.TrimSpace(os.Getenv("VIBERUN_RELEASE_BASE_URL")),
+		Repo:    repo,
+		Version: releaseVersion,
+	}
+	names := []string{release.ImageAsset}
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	assets, err := fetchRelease(source, key, names...)
+	if err != nil {
+		return "", err
+	}
+	for i, file := range files {
+		if err := os.WriteFile(file.Path, assets[i+1].Data, 0o755); err != nil {
+			return "", err
+		}
+	}
+	if image := strings.TrimSpace(os.Getenv("VIBERUN_IMAGE")); image != "" {
+		return image, nil
+	}
+	return release.ParseImageRef(assets[0].Data)
+}
+
+func buildServerBinary(arch string, output string) error {
+	buildCmd := exec.Command("go", "build", "-o", output, "./cmd/viberun-server")
+	buildCmd.Env = append(os.Environ(),
+		"CGO_ENABLED=0",
+		"GOOS=linux",
+		"GOARCH="+arch,
+	)
+	buildCmd.Stdout = os.Stdout
+	buildCmd.Stderr = os.Stderr
+	if err := buildCmd.Run(); err != nil {
+		return fmt.Errorf("build failed: %w", err)
+	}
+	return nil
+}
+
+// saveBundleImage pulls sourceImage (or builds the local Dockerfile when it is empty) for
+// linux/arch, tags it as tag and saves it to output.
+func saveBundleImage(sourceImage string, tag string, arch string, output string) error {
+	var commands [][]string
+	if sourceImage == "" {
+		commands = append(commands, []string{"build", "--platform", "linux/" + arch, "-t", tag, "."})
+	} else {
+		commands = append(commands,
+			[]string{"pull", "--platform", "linux/" + arch, sourceImage},
+			[]string{"tag", sourceImage, tag},
+		)
+	}
+	commands = append(commands, []string{"save", "-o", output, tag})
+	for _, args := range commands {
+		cmd := exec.Command("docker", args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("docker %s failed: %w", args[0], err)
+		}
+	}
+	return nil
+}
+
+func bundleFileName(bundleVersion string, arch string) string {
+	return fmt.Sprintf("viberun-bundle-%s-%s.tar.gz", bundleVersion, arch)
+}
+
+// bundleImageTag is the tag a bundle's image loads as. It never equals viberun:latest, so
+// bootstrap can tell whether the host already runs the bundled image.
+func bundleImageTag(bundleVersion string) string {
+	return "viberun:bundle-" + strings.TrimPrefix(bundleVersion, "v")
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnsureRunSubcommandBundle(t *testing.T) {
+	args := []string{"bundle", "create", "--arch", "arm64"}
+	got := ensureRunSubcommand(args)
+	if !reflect.DeepEqual(got, args) {
+		t.Fatalf("expected %v, got %v", args, got)
+	}
+}
+
+func TestBundleNames(t *testing.T) {
+	if got := bundleFileName("v1.2.3", "arm64"); got != "viberun-bundle-v1.2.3-arm64.tar.gz" {
+		t.Fatalf("unexpected bundle file name: %q", got)
+	}
+	if got := bundleImageTag("v1.2.3"); got != "viberun:bundle-1.2.3" {
+		t.Fatalf("unexpected image tag: %q", got)
+	}
+	if got := bundleImageTag("latest"); got == "viberun:latest" {
+		t.Fatalf("bundle tag must not collide with viberun:latest")
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/shayne/viberun/internal/config"
+)
+
+// errCredentialNotFound means a source is configured but holds no value.
+var errCredentialNotFound = errors.New("credential not found")
+
+// credentialSource reads a single credential value on the local machine.
+type credentialSource interface {
+	Lookup() (string, error)
+	// Describe names the source without revealing its value.
+	Describe() string
+}
+
+type envSource struct {
+	name string
+}
+
+func (s envSource) Lookup() (string, error) {
+	value := strings.TrimSpace(os.Getenv(s.name))
+	if value == "" {
+		return "", errCredentialNotFound
+	}
+	return value, nil
+}
+
+func (s envSource) Describe() string {
+	return "env"
+}
+
+// commandSource runs a password-manager command such as `op read ...` or `pass show ...`
+// and uses the first line of its output.
+type commandSource struct {
+	argv []string
+}
+
+func (s commandSource) Lookup() (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(s.argv[0], s.argv[1:]...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		trimmed := strings.TrimSpace(stderr.String())
+		if trimmed == "" {
+			trimmed = err.Error()
+		}
+		return "", fmt.Errorf("%s: %s", s.argv[0], trimmed)
+	}
+	value, _, _ := strings.Cut(string(output), "\n")
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", errCredentialNotFound
+	}
+	return value, nil
+}
+
+func (s commandSource) Describe() string {
+	return "command " + s.argv[0]
+}
+
+type keyringSource struct {
+	keyring keyring
+	service string
+	account string
+}
+
+func (s keyringSource) Lookup() (string, error) {
+	value, err := s.keyring.Get(s.service, s.account)
+	if err != nil {
+		return "", err
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", errCredentialNotFound
+	}
+	return value, nil
+}
+
+func (s keyringSource) Describe() string {
+	return fmt.Sprintf("keyring %s/%s", s.service, s.account)
+}
+
+// keyring reads generic secrets from the OS credential store.
+type keyring interface {
+	Get(service string, account string) (string, error)
+}
+
+// secretServiceKeyring uses the Secret Service over D-Bus through secret-tool.
+type secretServiceKeyring struct{}
+
+func (secretServiceKeyring) Get(service string, account string) (string, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return "", fmt.Errorf("secret-tool is required for keyring credentials")
+	}
+	output, err := exec.Command("secret-tool", "lookup", "service", service, "account", account).Output()
+	if err != nil {
+		return "", errCredentialNotFound
+	}
+	return string(output), nil
+}
+
+// macKeychain uses the login keychain through the security tool.
+type macKeychain struct{}
+
+func (macKeychain) Get(service string, account string) (string, error) {
+	output, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		return "", errCredentialNotFound
+	}
+	return string(output), nil
+}
+
+// fileKeyring is a stand-in keyring backed by a JSON file of service -> account -> value.
+type fileKeyring struct {
+	path string
+}
+
+func (k fileKeyring) Get(service string, account string) (string, error) {
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return "", err
+	}
+	entries := map[string]map[string]string{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return "", fmt.Errorf("invalid keyring file %s: %w", k.path, err)
+	}
+	value, ok := entries[service][account]
+	if !ok {
+		return "", errCredentialNotFound
+	}
+	return value, nil
+}
+
+// defaultKeyring picks the platform keyring. VIBERUN_KEYRING_FILE swaps in a file-backed
+// keyring, which is handy on headless machines and in tests.
+func defaultKeyring() keyring {
+	if path := strings.TrimSpace(os.Getenv("VIBERUN_KEYRING_FILE")); path != "" {
+		return fileKeyring{path: path}
+	}
+	if runtime.GOOS == "darwin" {
+		return macKeychain{}
+	}
+	return secretServiceKeyring{}
+}
+
+// newCredentialSource builds the source described by a config entry.
+func newCredentialSource(entry config.CredentialSource) (credentialSource, error) {
+	switch strings.TrimSpace(entry.Type) {
+	case "", config.CredentialEnv:
+		name := strings.TrimSpace(entry.Env)
+		if name == "" {
+			name = entry.Key
+		}
+		return envSource{name: name}, nil
+	case config.CredentialCommand:
+		if len(entry.Command) == 0 || strings.TrimSpace(entry.Command[0]) == "" {
+			return nil, fmt.Errorf("credential source for %s has no command", entry.Key)
+		}
+		return commandSource{argv: entry.Command}, nil
+	case config.CredentialKeyring:
+		service := strings.TrimSpace(entry.Service)
+		if service == "" {
+			service = "viberun"
+		}
+		account := strings.TrimSpace(entry.Account)
+		if account == "" {
+			account = entry.Key
+		}
+		return keyringSource{keyring: defaultKeyring(), service: service, account: account}, nil
+	default:
+		return nil, fmt.Errorf("unknown credential source type %q for %s", entry.Type, entry.Key)
+	}
+}
+
+// credentialSources returns the sources to try for each key, in order. Keys without
+// configured sources fall back to the process environment.
+func credentialSources(keys []string, entries []config.CredentialSource) (map[string][]credentialSource, []string, error) {
+	sources := map[string][]credentialSource{}
+	order := []string{}
+	add := func(key string, source credentialSource) {
+		if _, ok := sources[key]; !ok {
+			order = append(order, key)
+		}
+		sources[key] = append(sources[key], source)
+	}
+	for _, entry := range entries {
+		entry.Key = strings.TrimSpace(entry.Key)
+		if entry.Key == "" {
+			return nil, nil, fmt.Errorf("credential source is missing a key")
+		}
+		source, err := newCredentialSource(entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		add(entry.Key, source)
+	}
+	for _, key := range keys {
+		if _, ok := sources[key]; !ok {
+			add(key, envSource{name: key})
+		}
+	}
+	return sources, order, nil
+}
+
+// resolveCredentials looks up every key and returns the values found plus a description
+// of where each came from. A failing source is reported and the next one is tried.
+func resolveCredentials(keys []string, entries []config.CredentialSource) (map[string]string, []string, error) {
+	sources, order, err := credentialSources(keys, entries)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := map[string]string{}
+	details := []string{}
+	for _, key := range order {
+		for _, source := range sources[key] {
+			value, err := source.Lookup()
+			if err != nil {
+				if !errors.Is(err, errCredentialNotFound) {
+					fmt.Fprintf(os.Stderr, "warning: %s (%s): %v\n", key, source.Describe(), err)
+				}
+				continue
+			}
+			values[key] = value
+			details = append(details, fmt.Sprintf("%s (%s)", key, source.Describe()))
+			break
+		}
+	}
+	return values, details, nil
+}
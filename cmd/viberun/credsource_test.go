@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shayne/viberun/internal/config"
+)
+
+func TestResolveCredentialsFromCommand(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "from-env")
+	values, details, err := resolveCredentials([]string{"ANTHROPIC_API_KEY"}, []config.CredentialSource{
+		{Key: "ANTHROPIC_API_KEY", Type: config.CredentialCommand, Command: []string{"sh", "-c", "printf 'from-command\\nsecond line\\n'"}},
+	})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if values["ANTHROPIC_API_KEY"] != "from-command" {
+		t.Fatalf("unexpected value: %q", values["ANTHROPIC_API_KEY"])
+	}
+	if !reflect.DeepEqual(details, []string{"ANTHROPIC_API_KEY (command sh)"}) {
+		t.Fatalf("unexpected details: %v", details)
+	}
+}
+
+func TestResolveCredentialsFallsThroughSources(t *testing.T) {
+	dir := t.TempDir()
+	keyringPath := filepath.Join(dir, "keyring.json")
+	if err := os.WriteFile(keyringPath, []byte(`{"viberun":{"GEMINI_API_KEY":"from-keyring"}}`), 0o600); err != nil {
+		t.Fatalf("write keyring: %v", err)
+	}
+	t.Setenv("VIBERUN_KEYRING_FILE", keyringPath)
+	t.Setenv("GEMINI_API_KEY", "")
+	t.Setenv("GOOGLE_API_KEY", "from-env")
+
+	values, details, err := resolveCredentials([]string{"GEMINI_API_KEY", "GOOGLE_API_KEY"}, []config.CredentialSource{
+		{Key: "GEMINI_API_KEY", Type: config.CredentialCommand, Command: []string{"false"}},
+		{Key: "GEMINI_API_KEY", Type: config.CredentialKeyring},
+	})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	want := map[string]string{"GEMINI_API_KEY": "from-keyring", "GOOGLE_API_KEY": "from-env"}
+	if !reflect.DeepEqual(values, want) {
+		t.Fatalf("unexpected values: %v", values)
+	}
+	wantDetails := []string{"GEMINI_API_KEY (keyring viberun/GEMINI_API_KEY)", "GOOGLE_API_KEY (env)"}
+	if !reflect.DeepEqual(details, wantDetails) {
+		t.Fatalf("unexpected details: %v", details)
+	}
+}
+
+func TestResolveCredentialsRejectsUnknownType(t *testing.T) {
+	if _, _, err := resolveCredentials(nil, []config.CredentialSource{{Key: "X", Type: "vault"}}); err == nil {
+		t.Fatalf("expected error for unknown source type")
+	}
+	if _, _, err := resolveCredentials(nil, []config.CredentialSource{{Key: "X", Type: config.CredentialCommand}}); err == nil {
+		t.Fatalf("expected error for command source without a command")
+	}
+}
+
+func TestDiscoverLocalAuthUsesConfiguredSources(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("CLAUDE_CONFIG_DIR", "")
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	t.Setenv("ANTHROPIC_AUTH_TOKEN", "")
+	keyringPath := filepath.Join(home, "keyring.json")
+	if err := os.WriteFile(keyringPath, []byte(`{"anthropic":{"me":"from-keyring"}}`), 0o600); err != nil {
+		t.Fatalf("write keyring: %v", err)
+	}
+	t.Setenv("VIBERUN_KEYRING_FILE", keyringPath)
+	cfg := config.Config{Credentials: map[string][]config.CredentialSource{
+		"claude-code": {{Key: "ANTHROPIC_API_KEY", Type: config.CredentialKeyring, Service: "anthropic", Account: "me"}},
+	}}
+	if err := config.Save(filepath.Join(home, ".config", "viberun", "config.json"), cfg); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+
+	auth, details, err := discoverLocalAuth("claude")
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if auth == nil || auth.Env["ANTHROPIC_API_KEY"] != "from-keyring" {
+		t.Fatalf("expected keyring value in bundle, got %+v", auth)
+	}
+	if !reflect.DeepEqual(details, []string{"ANTHROPIC_API_KEY (keyring anthropic/me)"}) {
+		t.Fatalf("unexpected details: %v", details)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/shayne/viberun/internal/config"
+	"github.com/shayne/viberun/internal/doctor"
+	"github.com/shayne/viberun/internal/sshcmd"
+	"github.com/shayne/viberun/internal/target"
+	"github.com/shayne/viberun/internal/tui"
+	"github.com/shayne/viberun/internal/version"
+	"github.com/shayne/yargs"
+	"golang.org/x/term"
+)
+
+type doctorArgs struct {
+	Host string `pos:"0?" help:"host to check (host or @host)"`
+}
+
+func handleDoctorCommand(_ context.Context, args []string) error {
+	result, err := yargs.ParseAndHandleHelp[struct{}, struct{}, doctorArgs](args, helpConfig)
+	if errors.Is(err, yargs.ErrShown) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cfg, _, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	hostArg := strings.TrimPrefix(strings.TrimSpace(result.Args.Host), "@")
+	resolved, err := target.ResolveHost(hostArg, cfg)
+	if err != nil {
+		return fmt.Errorf("invalid host: %w", err)
+	}
+
+	checks := runDoctorChecks(resolved.Host)
+	color := tui.NewColorizer(term.IsTerminal(int(os.Stdout.Fd())))
+	fmt.Fprintf(os.Stdout, "viberun doctor (host=%s)\n", resolved.Host)
+	renderDoctorChecks(os.Stdout, color, checks)
+	failed := 0
+	for _, check := range checks {
+		if check.Status == doctor.Fail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("doctor found %d problem(s)", failed)
+	}
+	return nil
+}
+
+// runDoctorChecks runs the local and ssh checks, then the host checks reported by the server.
+func runDoctorChecks(host string) []doctor.Check {
+	checks := []doctor.Check{}
+	if _, err := exec.LookPath("ssh"); err != nil {
+		return append(checks, doctor.Check{
+			Name:   "ssh",
+			Status: doctor.Fail,
+			Detail: "ssh was not found in PATH",
+			Hint:   "install an OpenSSH client",
+		})
+	}
+	configCheck := checkSSHConfig(host)
+	checks = append(checks, configCheck)
+	if configCheck.Status == doctor.Fail {
+		return checks
+	}
+	authCheck := checkSSHAuth(host)
+	checks = append(checks, authCheck)
+	if authCheck.Status == doctor.Fail {
+		return checks
+	}
+	installed, supportsDoctor := checkServerInstalled(host)
+	checks = append(checks, installed)
+	if installed.Status == doctor.Fail {
+		return checks
+	}
+	if !supportsDoctor {
+		return append(checks, doctor.Check{
+			Name:   "server version",
+			Status: doctor.Fail,
+			Detail: "viberun-server is too old to run host checks",
+			Hint:   "run `viberun bootstrap` to upgrade the server",
+		})
+	}
+	report, err := fetchDoctorReport(host)
+	if err != nil {
+		return append(checks, doctor.Check{
+			Name:   "host checks",
+			Status: doctor.Fail,
+			Detail: err.Error(),
+		})
+	}
+	checks = append(checks, serverVersionCheck(version.String(), report.ServerVersion))
+	return append(checks, report.Checks...)
+}
+
+func checkSSHConfig(host string) doctor.Check {
+	check := doctor.Check{Name: "ssh config"}
+	cmd := exec.Command("ssh", "-G", host)
+	cmd.Env = normalizedSshEnv()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		check.Status = doctor.Fail
+		check.Detail = strings.TrimSpace(string(out))
+		if check.Detail == "" {
+			check.Detail = err.Error()
+		}
+		check.Hint = "fix the entry for this host in ~/.ssh/config"
+		return check
+	}
+	values := parseSSHConfig(string(out))
+	check.Status = doctor.Pass
+	check.Detail = fmt.Sprintf("%s@%s:%s", values["user"], values["hostname"], values["port"])
+	return check
+}
+
+// parseSSHConfig reads the first value of each option printed by `ssh -G`.
+func parseSSHConfig(output string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(key)
+		if _, exists := values[key]; !exists {
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+func checkSSHAuth(host string) doctor.Check {
+	check := doctor.Check{Name: "ssh auth"}
+	sshArgs := append([]string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=10"}, sshcmd.BuildArgs(host, []string{"true"}, false)...)
+	cmd := exec.Command("ssh", sshArgs...)
+	cmd.Env = normalizedSshEnv()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		output := strings.TrimSpace(string(out))
+		check.Status = doctor.Fail
+		check.Detail = output
+		if check.Detail == "" {
+			check.Detail = err.Error()
+		}
+		if strings.Contains(output, "Permission denied") {
+			check.Hint = fmt.Sprintf("set up key auth with `ssh-copy-id %s` or load your key into ssh-agent", host)
+		} else {
+			check.Hint = fmt.Sprintf("check that %s is reachable with `ssh %s`", host, host)
+		}
+		return check
+	}
+	check.Status = doctor.Pass
+	check.Detail = "key auth works"
+	return check
+}
+
+// checkServerInstalled reports whether viberun-server is on the host's PATH and whether it
+// knows the doctor command.
+func checkServerInstalled(host string) (doctor.Check, bool) {
+	check := doctor.Check{Name: "server"}
+	path, err := sshOutput(host, []string{"command -v viberun-server"})
+	if err != nil || strings.TrimSpace(path) == "" {
+		check.Status = doctor.Fail
+		check.Detail = "viberun-server is not installed"
+		check.Hint = "run `viberun bootstrap`"
+		return check, false
+	}
+	check.Status = doctor.Pass
+	check.Detail = path
+	info, err := serverInfo(host, true)
+	if err != nil {
+		return check, false
+	}
+	return check, info.Has(version.CapabilityDoctor)
+}
+
+func fetchDoctorReport(host string) (doctor.Report, error) {
+	output, err := sshOutput(host, []string{"viberun-server", "doctor"})
+	if err != nil {
+		return doctor.Report{}, err
+	}
+	return parseDoctorReport(output)
+}
+
+func parseDoctorReport(output string) (doctor.Report, error) {
+	var report doctor.Report
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &report); err != nil {
+		return doctor.Report{}, fmt.Errorf("unexpected doctor response: %w", err)
+	}
+	return report, nil
+}
+
+func serverVersionCheck(clientVersion string, serverVersion string) doctor.Check {
+	check := doctor.Check{Name: "server version"}
+	serverVersion = strings.TrimSpace(serverVersion)
+	if serverVersion == "" {
+		serverVersion = "unknown"
+	}
+	check.Detail = fmt.Sprintf("server %s, client %s", serverVersion, clientVersion)
+	switch {
+	case serverVersion == clientVersion:
+		check.Status = doctor.Pass
+	case serverVersion == "dev" || clientVersion == "dev":
+		check.Status = doctor.Pass
+		check.Detail += " (development build)"
+	default:
+		check.Status = doctor.Warn
+		check.Hint = "run `viberun bootstrap` to install the matching server"
+	}
+	return check
+}
+
+func renderDoctorChecks(out io.Writer, color tui.Colorizer, checks []doctor.Check) {
+	for _, check := range checks {
+		label := "ok"
+		code := tui.ColorGreen
+		switch check.Status {
+		case doctor.Warn:
+			label = "warn"
+			code = tui.ColorYellow
+		case doctor.Fail:
+			label = "fail"
+			code = tui.ColorRed
+		}
+		line := fmt.Sprintf("%s %s", color.Wrap(code, fmt.Sprintf("%-4s", label)), check.Name)
+		if check.Detail != "" {
+			line = fmt.Sprintf("%s: %s", line, check.Detail)
+		}
+		fmt.Fprintln(out, line)
+		if check.Hint != "" {
+			fmt.Fprintf(out, "     %s\n", color.Wrap(tui.ColorDim, "hint: "+check.Hint))
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shayne/viberun/internal/doctor"
+	"github.com/shayne/viberun/internal/tui"
+)
+
+func TestEnsureRunSubcommandDoctor(t *testing.T) {
+	args := []string{"doctor", "@myhost"}
+	got := ensureRunSubcommand(args)
+	if !reflect.DeepEqual(got, args) {
+		t.Fatalf("expected %v, got %v", args, got)
+	}
+}
+
+func TestParseSSHConfig(t *testing.T) {
+	values := parseSSHConfig("user root\nhostname 10.0.0.5\nport 22\nidentityfile ~/.ssh/id_ed25519\nidentityfile ~/.ssh/id_rsa\n")
+	if values["user"] != "root" || values["hostname"] != "10.0.0.5" || values["port"] != "22" {
+		t.Fatalf("unexpected values: %v", values)
+	}
+	if values["identityfile"] != "~/.ssh/id_ed25519" {
+		t.Fatalf("expected first identityfile, got %q", values["identityfile"])
+	}
+}
+
+func TestServerVersionCheck(t *testing.T) {
+	if check := serverVersionCheck("v1.2.0", "v1.2.0"); check.Status != doctor.Pass {
+		t.Fatalf("expected pass for matching versions: %+v", check)
+	}
+	if check := serverVersionCheck("v1.3.0", "v1.2.0"); check.Status != doctor.Warn || check.Hint == "" {
+		t.Fatalf("expected warn with hint for mismatch: %+v", check)
+	}
+	if check := serverVersionCheck("dev", "v1.2.0"); check.Status != doctor.Pass {
+		t.Fatalf("expected pass for dev client: %+v", check)
+	}
+}
+
+func TestParseDoctorReport(t *testing.T) {
+	report, err := parseDoctorReport(`{"server_version":"v1.0.0","checks":[{"name":"docker","status":"fail","detail":"not installed","hint":"run bootstrap"}]}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if report.ServerVersion != "v1.0.0" || len(report.Checks) != 1 || report.Checks[0].Status != doctor.Fail {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if _, err := parseDoctorReport("Usage: viberun-server"); err == nil {
+		t.Fatalf("expected error for non-JSON output")
+	}
+}
+
+func TestRenderDoctorChecks(t *testing.T) {
+	var out bytes.Buffer
+	renderDoctorChecks(&out, tui.Colorizer{}, []doctor.Check{
+		{Name: "ssh auth", Status: doctor.Pass, Detail: "key auth works"},
+		{Name: "image", Status: doctor.Fail, Detail: "viberun:latest not found", Hint: "run `viberun bootstrap` to pull the image"},
+	})
+	text := out.String()
+	for _, want := range []string{
+		"ok   ssh auth: key auth works",
+		"fail image: viberun:latest not found",
+		"hint: run `viberun bootstrap` to pull the image",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("output missing %q:\n%s", want, text)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/shayne/viberun/internal/config"
+	"github.com/shayne/viberun/internal/sshcmd"
+	"github.com/shayne/viberun/internal/target"
+	"github.com/shayne/yargs"
+)
+
+// forwardStartupGrace is how long a background forward must stay up before it is
+// reported as started; ssh exits within it when a port cannot be bound.
+const forwardStartupGrace = 2 * time.Second
+
+// forwardRecord is the pidfile of a running `viberun <app> forward`.
+type forwardRecord struct {
+	App        string        `json:"app"`
+	Host       string        `json:"host"`
+	PID        int           `json:"pid"`
+	Background bool          `json:"background"`
+	Ports      []forwardPort `json:"ports"`
+	Started    time.Time     `json:"started"`
+}
+
+type forwardPort struct {
+	Local      int    `json:"local"`
+	RemoteHost string `json:"remote_host"`
+	RemotePort int    `json:"remote_port"`
+}
+
+type forwardsFlags struct {
+	All bool `flag:"all" help:"with stop, stop every forward"`
+}
+
+type forwardsArgs struct {
+	Action string `pos:"0?" help:"ls|stop"`
+	Target string `pos:"1?" help:"app or app@host to stop"`
+}
+
+func handleForwardsCommand(_ context.Context, args []string) error {
+	result, err := yargs.ParseAndHandleHelp[struct{}, forwardsFlags, forwardsArgs](args, helpConfig)
+	if errors.Is(err, yargs.ErrShown) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch result.Args.Action {
+	case "", "ls":
+		return listForwardsCommand()
+	case "stop":
+		return stopForwardsCommand(strings.TrimSpace(result.Args.Target), result.SubCommandFlags.All)
+	default:
+		return fmt.Errorf("unknown forwards action %q (expected ls or stop)", result.Args.Action)
+	}
+}
+
+func listForwardsCommand() error {
+	records, err := listForwards()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Fprintln(os.Stdout, "No forwards running")
+		return nil
+	}
+	for _, record := range records {
+		mode := "foreground"
+		if record.Background {
+			mode = "background"
+		}
+		fmt.Fprintf(os.Stdout, "%s@%s pid %d (%s, since %s)\n", record.App, record.Host, record.PID, mode, record.Started.Local().Format(time.DateTime))
+		for _, port := range record.Ports {
+			fmt.Fprintf(os.Stdout, "  http://localhost:%d -> %s:%d\n", port.Local, port.RemoteHost, port.RemotePort)
+		}
+	}
+	return nil
+}
+
+func stopForwardsCommand(targetArg string, all bool) error {
+	if all == (targetArg != "") {
+		return fmt.Errorf("Usage: viberun forwards stop <app> | viberun forwards stop --all")
+	}
+	records, err := listForwards()
+	if err != nil {
+		return err
+	}
+	var resolved target.Resolved
+	if !all {
+		cfg, _, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		resolved, err = target.Resolve(targetArg, cfg)
+		if err != nil {
+			return fmt.Errorf("invalid target: %w", err)
+		}
+	}
+	stopped := 0
+	for _, record := range records {
+		if !all && (record.App != resolved.App || record.Host != resolved.Host) {
+			continue
+		}
+		if err := stopProcess(record.PID); err != nil {
+			return fmt.Errorf("failed to stop forward for %s@%s: %w", record.App, record.Host, err)
+		}
+		if path, err := forwardRecordPath(record.Host, record.App); err == nil {
+			_ = os.Remove(path)
+		}
+		fmt.Fprintf(os.Stdout, "Stopped forward for %s@%s\n", record.App, record.Host)
+		stopped++
+	}
+	if stopped == 0 && !all {
+		return fmt.Errorf("no forward running for %s@%s", resolved.App, resolved.Host)
+	}
+	return nil
+}
+
+// runForward holds the app's port forward (plus any extra container ports) open over ssh
+// without starting tmux or the agent.
+func runForward(resolved target.Resolved, agentProvider string, flags runFlags, cfg config.Config) error {
+	if isLocalHost(resolved.Host) {
+		return fmt.Errorf("%s runs on this machine; its port needs no forward", resolved.App)
+	}
+	if existing, ok := findForward(resolved.Host, resolved.App); ok {
+		fmt.Fprintf(os.Stdout, "Already forwarding %s@%s (pid %d)\n", resolved.App, resolved.Host, existing.PID)
+		printForwardPorts(existing.Ports)
+		return nil
+	}
+	extraPorts, err := parseForwardPorts(flags.Ports)
+	if err != nil {
+		return err
+	}
+	hostPort, err := resolveHostPort(resolved, agentProvider)
+	if err != nil {
+		return err
+	}
+	localPort, err := localForwardPort(hostPort, cfg.Apps[resolved.App].LocalPort)
+	if err != nil {
+		return err
+	}
+	ports := []forwardPort{{Local: localPort, RemoteHost: "localhost", RemotePort: hostPort}}
+	for _, port := range extraPorts {
+		remoteHost, remotePort, err := forwardTarget(resolved, agentProvider, port)
+		if err != nil {
+			return err
+		}
+		local, err := localForwardPort(port, 0)
+		if err != nil {
+			return err
+		}
+		ports = append(ports, forwardPort{Local: local, RemoteHost: remoteHost, RemotePort: remotePort})
+	}
+	forwards := make([]sshcmd.LocalForward, 0, len(ports))
+	for _, port := range ports {
+		forwards = append(forwards, sshcmd.LocalForward{LocalPort: port.Local, RemoteHost: port.RemoteHost, RemotePort: port.RemotePort})
+	}
+	record := forwardRecord{
+		App:        resolved.App,
+		Host:       resolved.Host,
+		Background: flags.Background,
+		Ports:      ports,
+	}
+	path, err := forwardRecordPath(resolved.Host, resolved.App)
+	if err != nil {
+		return err
+	}
+	sshArgs := sshcmd.BuildForwardArgs(resolved.Host, forwards)
+	if flags.Background {
+		return startBackgroundForward(record, path, sshArgs)
+	}
+	return runForegroundForward(record, path, sshArgs)
+}
+
+// forwardTarget asks the server where the host reaches a container port: the published
+// port on 127.0.0.1, or the container's address where the engine routes to it.
+func forwardTarget(resolved target.Resolved, agentProvider string, port int) (string, int, error) {
+	remoteArgs := sshcmd.RemoteArgs(resolved.App, agentProvider, []string{"address", strconv.Itoa(port)}, nil)
+	output, err := sshOutput(resolved.Host, remoteArgs)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to resolve container port %d: %w", port, err)
+	}
+	return parseForwardTarget(output)
+}
+
+func parseForwardTarget(output string) (string, int, error) {
+	host, portText, err := net.SplitHostPort(strings.TrimSpace(output))
+	if err != nil {
+		return "", 0, fmt.Errorf("unexpected address %q: %w", strings.TrimSpace(output), err)
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("unexpected address %q", strings.TrimSpace(output))
+	}
+	return host, port, nil
+}
+
+func runForegroundForward(record forwardRecord, path string, sshArgs []string) error {
+	cmd := exec.Command("ssh", sshArgs...)
+	cmd.Env = normalizedSshEnv()
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ssh: %w", err)
+	}
+	record.PID = cmd.Process.Pid
+	record.Started = time.Now().UTC()
+	if err := writeForwardRecord(path, record); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to record forward: %v\n", err)
+	}
+	defer os.Remove(path)
+
+	// Ctrl-C reaches ssh through the terminal; keep running until it exits so the
+	// pidfile is removed, and pass other stop signals on to ssh.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	var stopped atomic.Bool
+	go func() {
+		for sig := range signals {
+			stopped.Store(true)
+			_ = cmd.Process.Signal(sig)
+		}
+	}()
+
+	fmt.Fprintf(os.Stdout, "Forwarding %s@%s (Ctrl-C to stop)\n", record.App, record.Host)
+	printForwardPorts(record.Ports)
+	if err := cmd.Wait(); err != nil && !stopped.Load() {
+		return fmt.Errorf("forward exited: %w", err)
+	}
+	return nil
+}
+
+func startBackgroundForward(record forwardRecord, path string, sshArgs []string) error {
+	logPath := strings.TrimSuffix(path, ".json") + ".log"
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	// There is no terminal to prompt on once detached.
+	cmd := exec.Command("ssh", append([]string{"-o", "BatchMode=yes"}, sshArgs...)...)
+	cmd.Env = normalizedSshEnv()
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detachedProcAttr()
+	err = cmd.Start()
+	_ = logFile.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start ssh: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	select {
+	case err := <-exited:
+		detail := strings.TrimSpace(readLastLine(logPath))
+		if detail == "" && err != nil {
+			detail = err.Error()
+		}
+		return fmt.Errorf("forward exited: %s", detail)
+	case <-time.After(forwardStartupGrace):
+	}
+	record.PID = cmd.Process.Pid
+	record.Started = time.Now().UTC()
+	if err := writeForwardRecord(path, record); err != nil {
+		_ = stopProcess(record.PID)
+		return fmt.Errorf("failed to record forward: %w", err)
+	}
+	fmt.Fprintf(os.Stdout, "Forwarding %s@%s in the background (pid %d)\n", record.App, record.Host, record.PID)
+	printForwardPorts(record.Ports)
+	fmt.Fprintf(os.Stdout, "Stop it with: viberun forwards stop %s@%s\n", record.App, record.Host)
+	return nil
+}
+
+func printForwardPorts(ports []forwardPort) {
+	for _, port := range ports {
+		fmt.Fprintf(os.Stdout, "  http://localhost:%d\n", port.Local)
+	}
+}
+
+// parseForwardPorts parses --port values; each may be a comma-separated list.
+func parseForwardPorts(values []string) ([]int, error) {
+	ports := []int{}
+	seen := map[int]bool{}
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			port, err := strconv.Atoi(part)
+			if err != nil || port <= 0 || port > 65535 {
+				return nil, fmt.Errorf("invalid port %q", part)
+			}
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+	return ports, nil
+}
+
+// forwardsDir holds forward pidfiles, under XDG_RUNTIME_DIR so they vanish on logout
+// or reboot along with the forwards themselves.
+func forwardsDir() string {
+	if runtimeDir := strings.TrimSpace(os.Getenv("XDG_RUNTIME_DIR")); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "viberun", "forwards")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("viberun-%d", os.Getuid()), "forwards")
+}
+
+func forwardRecordPath(host string, app string) (string, error) {
+	dir := forwardsDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, safeFileName(app+"@"+host)+".json"), nil
+}
+
+func writeForwardRecord(path string, record forwardRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// listForwards returns the running forwards, removing pidfiles whose process has exited.
+func listForwards() ([]forwardRecord, error) {
+	return readForwardRecords(forwardsDir())
+}
+
+func readForwardRecords(dir string) ([]forwardRecord, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	records := []forwardRecord{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var record forwardRecord
+		if err := json.Unmarshal(data, &record); err != nil || !forwardProcess(record) {
+			_ = os.Remove(path)
+			_ = os.Remove(strings.TrimSuffix(path, ".json") + ".log")
+			continue
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].App != records[j].App {
+			return records[i].App < records[j].App
+		}
+		return records[i].Host < records[j].Host
+	})
+	return records, nil
+}
+
+// forwardCommandMatches reports whether command is the ssh process started for record:
+// ssh to the record's host holding its first forward.
+func forwardCommandMatches(command []string, record forwardRecord) bool {
+	if len(command) == 0 || filepath.Base(command[0]) != "ssh" || len(record.Ports) == 0 {
+		return false
+	}
+	port := record.Ports[0]
+	remoteHost := port.RemoteHost
+	if remoteHost == "" {
+		remoteHost = "localhost"
+	}
+	forward := fmt.Sprintf("%d:%s:%d", port.Local, remoteHost, port.RemotePort)
+	return slices.Contains(command, forward) && slices.Contains(command, record.Host)
+}
+
+func findForward(host string, app string) (forwardRecord, bool) {
+	records, err := listForwards()
+	if err != nil {
+		return forwardRecord{}, false
+	}
+	for _, record := range records {
+		if record.App == app && record.Host == host {
+			return record, true
+		}
+	}
+	return forwardRecord{}, false
+}
+
+// sessionsDir holds records of the app forward each interactive session holds, so
+// `open` can reuse it. They live apart from forwardsDir so `forwards stop` never ends
+// a session.
+func sessionsDir() string {
+	return filepath.Join(filepath.Dir(forwardsDir()), "sessions")
+}
+
+// recordSessionForward records the app forward of the session ssh process pid and
+// returns a function that removes the record.
+func recordSessionForward(resolved target.Resolved, pid int, forward sshcmd.LocalForward) (func(), error) {
+	dir := sessionsDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%d.json", safeFileName(resolved.App+"@"+resolved.Host), pid))
+	record := forwardRecord{
+		App:     resolved.App,
+		Host:    resolved.Host,
+		PID:     pid,
+		Ports:   []forwardPort{{Local: forward.LocalPort, RemoteHost: forward.RemoteHost, RemotePort: forward.RemotePort}},
+		Started: time.Now().UTC(),
+	}
+	if err := writeForwardRecord(path, record); err != nil {
+		return nil, err
+	}
+	return func() { _ = os.Remove(path) }, nil
+}
+
+// findSessionForward returns the app forward of a running session for the app.
+func findSessionForward(host string, app string) (forwardRecord, bool) {
+	records, err := readForwardRecords(sessionsDir())
+	if err != nil {
+		return forwardRecord{}, false
+	}
+	for _, record := range records {
+		if record.App == app && record.Host == host {
+			return record, true
+		}
+	}
+	return forwardRecord{}, false
+}
+
+func readLastLine(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	return lines[len(lines)-1]
+}
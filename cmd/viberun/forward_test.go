@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/shayne/viberun/internal/sshcmd"
+	"github.com/shayne/viberun/internal/target"
+)
+
+func TestParseForwardPorts(t *testing.T) {
+	ports, err := parseForwardPorts([]string{"5173", "9229, 5173", ""})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if want := []int{5173, 9229}; !reflect.DeepEqual(ports, want) {
+		t.Fatalf("expected %v, got %v", want, ports)
+	}
+	if _, err := parseForwardPorts([]string{"http"}); err == nil {
+		t.Fatalf("expected error for non-numeric port")
+	}
+	if _, err := parseForwardPorts([]string{"70000"}); err == nil {
+		t.Fatalf("expected error for out-of-range port")
+	}
+}
+
+// startFakeSSH starts a process whose command line looks like `ssh args...`.
+func startFakeSSH(t *testing.T, args ...string) int {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs /bin/sh")
+	}
+	path := filepath.Join(t.TempDir(), "ssh")
+	if err := os.Symlink("/bin/sh", path); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	cmd := exec.Command(path, append([]string{"-c", "sleep 30; :"}, args...)...)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	return cmd.Process.Pid
+}
+
+func TestListForwardsDropsStaleRecords(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	ports := []forwardPort{{Local: 8080, RemoteHost: "localhost", RemotePort: 32768}}
+	pid := startFakeSSH(t, "-N", "-L", "8080:localhost:32768", "root@host-a")
+	live, err := forwardRecordPath("root@host-a", "myapp")
+	if err != nil {
+		t.Fatalf("path: %v", err)
+	}
+	if err := writeForwardRecord(live, forwardRecord{App: "myapp", Host: "root@host-a", PID: pid, Ports: ports}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	stale, err := forwardRecordPath("root@host-a", "old")
+	if err != nil {
+		t.Fatalf("path: %v", err)
+	}
+	if err := writeForwardRecord(stale, forwardRecord{App: "old", Host: "root@host-a", PID: 0, Ports: ports}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// A live pid that now belongs to another process, as after a reboot.
+	reused, err := forwardRecordPath("root@host-a", "reused")
+	if err != nil {
+		t.Fatalf("path: %v", err)
+	}
+	if err := writeForwardRecord(reused, forwardRecord{App: "reused", Host: "root@host-a", PID: os.Getpid(), Ports: ports}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	records, err := listForwards()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(records) != 1 || records[0].App != "myapp" {
+		t.Fatalf("expected only the live forward, got %+v", records)
+	}
+	for _, path := range []string{stale, reused} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("expected %s removed, got %v", path, err)
+		}
+	}
+	if record, ok := findForward("root@host-a", "myapp"); !ok || record.PID != pid {
+		t.Fatalf("expected to find live forward, got %+v %v", record, ok)
+	}
+	if filepath.Dir(live) != filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "viberun", "forwards") {
+		t.Fatalf("unexpected pidfile location %s", live)
+	}
+}
+
+func TestForwardCommandMatches(t *testing.T) {
+	record := forwardRecord{Host: "root@host-a", Ports: []forwardPort{{Local: 8080, RemoteHost: "localhost", RemotePort: 32768}}}
+	command := []string{"ssh", "-o", "BatchMode=yes", "-N", "-T", "-L", "8080:localhost:32768", "root@host-a"}
+	if !forwardCommandMatches(command, record) {
+		t.Fatalf("expected match for %v", command)
+	}
+	for _, other := range [][]string{
+		{"/usr/bin/vim", "8080:localhost:32768", "root@host-a"},
+		{"ssh", "-L", "8081:localhost:32768", "root@host-a"},
+		{"ssh", "-L", "8080:localhost:32768", "root@host-b"},
+		{},
+	} {
+		if forwardCommandMatches(other, record) {
+			t.Fatalf("unexpected match for %v", other)
+		}
+	}
+}
+
+func TestParseForwardTarget(t *testing.T) {
+	host, port, err := parseForwardTarget("127.0.0.1:32770\n")
+	if err != nil || host != "127.0.0.1" || port != 32770 {
+		t.Fatalf("unexpected target %q %d (%v)", host, port, err)
+	}
+	if _, _, err := parseForwardTarget("172.17.0.2"); err == nil {
+		t.Fatalf("expected error for address without port")
+	}
+}
+
+func TestSessionForwardRecords(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	resolved := target.Resolved{App: "myapp", Host: "root@host-a"}
+	forward := sshcmd.LocalForward{LocalPort: 8081, RemoteHost: "localhost", RemotePort: 32768}
+	pid := startFakeSSH(t, "-tt", "-L", "8081:localhost:32768", "root@host-a", "viberun-server", "myapp")
+	remove, err := recordSessionForward(resolved, pid, forward)
+	if err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	record, ok := findSessionForward("root@host-a", "myapp")
+	if !ok || record.Ports[0].Local != 8081 {
+		t.Fatalf("expected the session forward, got %+v %v", record, ok)
+	}
+	if records, _ := listForwards(); len(records) != 0 {
+		t.Fatalf("expected sessions to stay out of forwards, got %+v", records)
+	}
+	remove()
+	if _, ok := findSessionForward("root@host-a", "myapp"); ok {
+		t.Fatalf("expected the removed session to be gone")
+	}
+}
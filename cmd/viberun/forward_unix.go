@@ -0,0 +1,59 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// detachedProcAttr starts a background forward in its own session so it outlives the
+// terminal that started it.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// forwardProcess reports whether the record's pid still runs its ssh forward, so a
+// pidfile left behind by a reboot or a reused pid never leads to signalling another
+// process.
+func forwardProcess(record forwardRecord) bool {
+	if !processAlive(record.PID) {
+		return false
+	}
+	command, ok := processCommand(record.PID)
+	return ok && forwardCommandMatches(command, record)
+}
+
+// processCommand returns the command line of pid, from /proc on Linux and ps elsewhere.
+func processCommand(pid int) ([]string, bool) {
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid)); err == nil {
+		return strings.Split(string(bytes.TrimRight(data, "\x00")), "\x00"), true
+	}
+	out, err := exec.Command("ps", "-o", "command=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return nil, false
+	}
+	return strings.Fields(string(out)), true
+}
+
+func stopProcess(pid int) error {
+	err := syscall.Kill(pid, syscall.SIGTERM)
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+	return err
+}
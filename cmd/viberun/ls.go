@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/shayne/viberun/internal/config"
+	"github.com/shayne/viberun/internal/target"
+	"github.com/shayne/viberun/internal/version"
+	"github.com/shayne/yargs"
+)
+
+type lsArgs struct {
+	Host string `pos:"0?" help:"host to list (host or @host)"`
+}
+
+// handleListCommand prints the host's apps with their port, container state and health.
+func handleListCommand(_ context.Context, args []string) error {
+	result, err := yargs.ParseAndHandleHelp[struct{}, struct{}, lsArgs](args, helpConfig)
+	if errors.Is(err, yargs.ErrShown) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cfg, _, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	hostArg := strings.TrimPrefix(strings.TrimSpace(result.Args.Host), "@")
+	resolved, err := target.ResolveHost(hostArg, cfg)
+	if err != nil {
+		return fmt.Errorf("invalid host: %w", err)
+	}
+	if err := requireServerCapability(resolved.Host, version.CapabilityHealth); err != nil {
+		return err
+	}
+	output, err := sshOutput(resolved.Host, []string{"viberun-server", "ls"})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, output)
+	return nil
+}
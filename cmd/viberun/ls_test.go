@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shayne/viberun/internal/version"
+)
+
+func TestEnsureRunSubcommandList(t *testing.T) {
+	args := []string{"ls", "@myhost"}
+	got := ensureRunSubcommand(args)
+	if !reflect.DeepEqual(got, args) {
+		t.Fatalf("expected %v, got %v", args, got)
+	}
+	if !reservedAppNames["ls"] {
+		t.Fatalf("expected ls to be a reserved app name")
+	}
+}
+
+func TestRequiredCapabilityHealth(t *testing.T) {
+	for _, action := range []string{"status", "health"} {
+		if got := requiredCapability(action, runFlags{}); got != version.CapabilityHealth {
+			t.Fatalf("%s: expected %q, got %q", action, version.CapabilityHealth, got)
+		}
+	}
+}
+
+func TestHealthSetArgs(t *testing.T) {
+	if got := healthSetArgs("/healthz", runFlags{}); !reflect.DeepEqual(got, []string{"health", "set", "/healthz"}) {
+		t.Fatalf("unexpected default args: %v", got)
+	}
+	flags := runFlags{ExpectStatus: 204, Interval: time.Minute, DockerHealth: true}
+	want := []string{"health", "set", "/ready", "204", "1m0s", "docker"}
+	if got := healthSetArgs("/ready", flags); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
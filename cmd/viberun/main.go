@@ -4,19 +4,18 @@ import (
 	"bufio"
 	"context"
 	"crypto/rand"
-	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
-	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"runtime"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -26,7 +25,7 @@ import (
 	"github.com/shayne/viberun/internal/config"
 	"github.com/shayne/viberun/internal/sshcmd"
 	"github.com/shayne/viberun/internal/target"
-	"github.com/shayne/viberun/internal/tui"
+	"github.com/shayne/viberun/internal/version"
 	"github.com/shayne/yargs"
 )
 
@@ -43,6 +42,10 @@ func runCLI() error {
 		"run":       handleRunCommand,
 		"config":    handleConfigCommand,
 		"bootstrap": handleBootstrapCommand,
+		"doctor":    handleDoctorCommand,
+		"bundle":    handleBundleCommand,
+		"forwards":  handleForwardsCommand,
+		"ls":        handleListCommand,
 	}
 	if err := yargs.RunSubcommands(context.Background(), args, helpConfig, struct{}{}, handlers); err != nil {
 		if errors.Is(err, yargs.ErrShown) {
@@ -54,28 +57,54 @@ func runCLI() error {
 }
 
 type runFlags struct {
-	Agent  string `flag:"agent" help:"agent provider to run (codex, claude, gemini)"`
-	Delete bool   `flag:"delete" help:"delete the app and snapshots"`
-	Yes    bool   `flag:"yes" short:"y" help:"skip confirmation prompts"`
+	Agent        string        `flag:"agent" help:"agent provider to run (codex, claude, gemini)"`
+	Provider     string        `flag:"provider" help:"agent provider for auth push/pull/status (defaults to --agent)"`
+	All          bool          `flag:"all" help:"with auth pull, fan the freshest credentials out to every app on the host"`
+	Delete       bool          `flag:"delete" help:"delete the app and snapshots"`
+	Yes          bool          `flag:"yes" short:"y" help:"skip confirmation prompts"`
+	DryRun       bool          `flag:"dry-run" help:"with auth push, show the changes without applying them"`
+	Ports        []string      `flag:"port" help:"with forward, also forward this container port (repeatable)"`
+	Background   bool          `flag:"background" help:"with forward, keep forwarding after this command exits"`
+	TTL          time.Duration `flag:"ttl" help:"with share, how long the link stays valid (default 1h)"`
+	ExpectStatus int           `flag:"expect-status" help:"with health set, the HTTP status the check expects (default 200)"`
+	Interval     time.Duration `flag:"interval" help:"with health set, how long the status line reuses a result and how often a --docker-healthcheck runs (default 30s)"`
+	DockerHealth bool          `flag:"docker-healthcheck" help:"with health set, also install the check as the container HEALTHCHECK on create"`
 }
 
 type runArgs struct {
 	Target string `pos:"0" help:"app or app@host"`
-	Action string `pos:"1?" help:"snapshot|snapshots|restore|shell"`
-	Value  string `pos:"2?" help:"snapshot name for restore"`
+	Action string `pos:"1?" help:"snapshot|snapshots|restore|shell|auth|secrets|forward|open|share|shares|status|health|prompt"`
+	Value  string `pos:"2?" help:"snapshot name for restore, push|pull|status for auth, set|ls|rm for secrets, path for open, rm for shares, set|rm for health, or the prompt text for prompt"`
+	Name   string `pos:"3?" help:"secret name for secrets set/rm, share id for shares rm, or path for health set"`
 }
 
 type configFlags struct {
-	Host        string   `flag:"host" help:"set default host (alias for --default-host)"`
-	DefaultHost string   `flag:"default-host" help:"set default host"`
-	Agent       string   `flag:"agent" help:"set default agent provider"`
-	SetHosts    []string `flag:"set-host" help:"set host alias mapping as alias=host (repeatable)"`
+	Host          string   `flag:"host" help:"set default host (alias for --default-host)"`
+	DefaultHost   string   `flag:"default-host" help:"set default host"`
+	Agent         string   `flag:"agent" help:"set default agent provider"`
+	SetHosts      []string `flag:"set-host" help:"set host alias mapping as alias=host (repeatable)"`
+	LocalPorts    []string `flag:"local-port" help:"pin an app's localhost forward port as app=port; app=0 unpins (repeatable)"`
+	AutoForward   []string `flag:"auto-forward" help:"turn forwarding of ports the container starts listening on on or off as app=on|off (repeatable)"`
+	AgentNotify   []string `flag:"agent-notify" help:"turn an app's agent idle/approval/done notifications on or off as app=on|off (repeatable)"`
+	RPC           []string `flag:"rpc" help:"enable or disable a container RPC endpoint as name=on|off (repeatable)"`
+	EditCommand   string   `flag:"edit-command" help:"local editor command for the edit RPC, which must wait for the file to close"`
+	OpenAllow     []string `flag:"open-allow" help:"let the container open URLs on this domain and its subdomains without asking (repeatable)"`
+	OpenDisallow  []string `flag:"open-disallow" help:"remove a domain from the open allowlist (repeatable)"`
+	OpenUnlisted  string   `flag:"open-unlisted" help:"what to do with other URLs the container opens: confirm (default), allow or deny"`
+	OpenPerMinute int      `flag:"open-per-minute" help:"limit URLs the container may open per minute (default 10)"`
 }
 
 type bootstrapFlags struct {
-	Local      bool   `flag:"local" help:"install server from local build instead of GitHub release"`
-	LocalPath  string `flag:"local-path" help:"install server from a local binary at this path"`
-	LocalImage bool   `flag:"local-image" help:"build and load the container image from the local Docker daemon"`
+	Local          bool   `flag:"local" help:"install server from local build instead of GitHub release"`
+	LocalPath      string `flag:"local-path" help:"install server from a local binary at this path"`
+	LocalImage     bool   `flag:"local-image" help:"build and load the container image from the local Docker daemon"`
+	Force          bool   `flag:"force" help:"reinstall the server even when it is already at the target version"`
+	Check          bool   `flag:"check" help:"report what bootstrap would change without changing anything"`
+	Runtime        string `flag:"runtime" help:"container runtime on the host: docker (default) or podman (rootless)"`
+	ExistingDocker bool   `flag:"existing-docker" help:"use the docker already installed on the host and never change it"`
+	Bundle         string `flag:"bundle" help:"install from a bundle made by viberun bundle create, with no network access on the host"`
+	// InsecureSkipSignature is the only way past a missing or bad release signature.
+	InsecureSkipSignature bool `flag:"insecure-skip-signature" help:"INSECURE: install a release whose SHA256SUMS signature is missing or does not verify"`
 }
 
 type bootstrapArgs struct {
@@ -91,15 +120,32 @@ var helpConfig = yargs.HelpConfig{
 			"viberun myapp snapshot",
 			"viberun myapp restore latest",
 			"viberun myapp shell",
+			"viberun myapp auth push --provider codex",
+			"viberun myapp auth push --dry-run",
+			"viberun myapp secrets set STRIPE_KEY < key.txt",
+			"viberun myapp forward --background --port 5173",
+			"viberun myapp open /admin",
+			"viberun forwards stop myapp",
+			"viberun myapp share --ttl 30m",
+			"viberun myapp health set /healthz --expect-status 200 --interval 30s",
+			"viberun myapp status",
+			"viberun myapp prompt \"fix the failing tests\"",
+			"viberun ls @myhost",
 			"viberun config --host myhost --agent codex",
+			"viberun config --rpc clipboard-copy=on --rpc notify=on",
+			"viberun config --agent-notify myapp=off",
+			"viberun config --open-allow github.com --open-unlisted confirm",
 			"viberun bootstrap root@1.2.3.4",
+			"viberun doctor @myhost",
+			"viberun bundle create --arch arm64",
+			"viberun bootstrap --bundle viberun-bundle-v1.0.0-arm64.tar.gz myhost",
 		},
 	},
 	SubCommands: map[string]yargs.SubCommandInfo{
 		"run": {
 			Name:        "run",
 			Description: "Run or manage an app session",
-			Usage:       "<app> [snapshot|snapshots|restore <snapshot>|shell]",
+			Usage:       "<app> [snapshot|snapshots|restore <snapshot>|shell|auth push|auth pull|auth status|secrets set|ls|rm|forward|share|shares [rm <id>]|status|health [set <path>|rm]|prompt [<prompt>]]",
 			Hidden:      true,
 		},
 		"config": {
@@ -111,6 +157,26 @@ var helpConfig = yargs.HelpConfig{
 			Description: "Install or update the host-side server and image",
 			Usage:       "[<host>]",
 		},
+		"doctor": {
+			Name:        "doctor",
+			Description: "Check ssh, the host, docker and the image for common problems",
+			Usage:       "[@<host>]",
+		},
+		"bundle": {
+			Name:        "bundle",
+			Description: "Create an offline bootstrap bundle",
+			Usage:       "create [--arch amd64|arm64] [--output file]",
+		},
+		"forwards": {
+			Name:        "forwards",
+			Description: "List or stop port forwards started by viberun <app> forward",
+			Usage:       "[ls|stop <app>|stop --all]",
+		},
+		"ls": {
+			Name:        "ls",
+			Description: "List a host's apps with their port, state and health",
+			Usage:       "[@<host>]",
+		},
 	},
 }
 
@@ -129,7 +195,7 @@ func ensureRunSubcommand(args []string) []string {
 		return []string{"--help"}
 	}
 	switch cmd {
-	case "run", "config", "bootstrap":
+	case "run", "config", "bootstrap", "doctor", "bundle", "forwards", "ls":
 		return args
 	default:
 		return append([]string{"run"}, args...)
@@ -235,153 +301,147 @@ func handleConfig(args []string) {
 		}
 		updated = true
 	}
-	if !updated {
-		showConfig(cfg, path)
-		return
-	}
-
-	if err := config.Save(path, cfg); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to save config: %v\n", err)
-		os.Exit(1)
-	}
-	fmt.Fprintf(os.Stdout, "wrote config to %s\n", path)
-}
-
-func showConfig(cfg config.Config, path string) {
-	data, err := json.MarshalIndent(cfg, "", "  ")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to format config: %v\n", err)
-		os.Exit(1)
-	}
-	fmt.Fprintf(os.Stdout, "Config path: %s\n%s\n", path, string(data))
-}
-
-func handleBootstrap(args []string) {
-	result, err := yargs.ParseAndHandleHelp[struct{}, bootstrapFlags, bootstrapArgs](args, helpConfig)
-	if errors.Is(err, yargs.ErrShown) {
-		return
-	}
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(2)
-	}
-	flags := result.SubCommandFlags
-	hostArg := strings.TrimSpace(result.Args.Host)
-
-	cfg, path, err := config.Load()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
-		os.Exit(1)
-	}
-
-	resolved, err := target.ResolveHost(hostArg, cfg)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "invalid host: %v\n", err)
-		os.Exit(2)
+	for _, entry := range flags.LocalPorts {
+		app, portText, _ := strings.Cut(entry, "=")
+		app = strings.TrimSpace(app)
+		port, err := strconv.Atoi(strings.TrimSpace(portText))
+		if app == "" || err != nil || port < 0 || port > 65535 {
+			fmt.Fprintf(os.Stderr, "invalid local port %q (expected app=port)\n", entry)
+			os.Exit(2)
+		}
+		updateAppConfig(&cfg, app, func(appConfig *config.AppConfig) {
+			appConfig.LocalPort = port
+		})
+		updated = true
 	}
-
-	if _, err := exec.LookPath("ssh"); err != nil {
-		fmt.Fprintln(os.Stderr, "ssh is required but was not found in PATH")
-		os.Exit(1)
+	for _, entry := range flags.AutoForward {
+		app, state, _ := strings.Cut(entry, "=")
+		app = strings.TrimSpace(app)
+		if app == "" || (state != "on" && state != "off") {
+			fmt.Fprintf(os.Stderr, "invalid auto forward setting %q (expected app=on|off)\n", entry)
+			os.Exit(2)
+		}
+		updateAppConfig(&cfg, app, func(appConfig *config.AppConfig) {
+			appConfig.NoAutoForward = state == "off"
+		})
+		updated = true
 	}
-
-	tty := term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
-	if !tty {
-		fmt.Fprintln(os.Stderr, "bootstrap may require sudo; run from a terminal if you are prompted for a password")
+	for _, entry := range flags.AgentNotify {
+		app, state, _ := strings.Cut(entry, "=")
+		app = strings.TrimSpace(app)
+		if app == "" || (state != "on" && state != "off") {
+			fmt.Fprintf(os.Stderr, "invalid agent notify setting %q (expected app=on|off)\n", entry)
+			os.Exit(2)
+		}
+		updateAppConfig(&cfg, app, func(appConfig *config.AppConfig) {
+			appConfig.NoAgentNotify = state == "off"
+		})
+		updated = true
 	}
-	ui := tui.NewProgress(os.Stdout, tty, "bootstrap", resolved.Host)
-	ui.Start()
-	defer ui.Stop()
-
-	env := []string{}
-	for _, key := range []string{"VIBERUN_IMAGE", "VIBERUN_SERVER_VERSION", "VIBERUN_SERVER_REPO"} {
-		if value := strings.TrimSpace(os.Getenv(key)); value != "" {
-			env = append(env, key+"="+value)
+	for _, entry := range flags.RPC {
+		name, state, _ := strings.Cut(entry, "=")
+		if state != "on" && state != "off" {
+			fmt.Fprintf(os.Stderr, "invalid rpc setting %q (expected name=on|off)\n", entry)
+			os.Exit(2)
 		}
+		if err := setRPCEndpoint(&cfg.RPC, strings.TrimSpace(name), state == "on"); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(2)
+		}
+		updated = true
 	}
-	localBootstrap := flags.Local
-	localPath := strings.TrimSpace(flags.LocalPath)
-	localImage := flags.LocalImage
-	if strings.TrimSpace(localPath) != "" {
-		localBootstrap = true
+	if strings.TrimSpace(flags.EditCommand) != "" {
+		cfg.RPC.EditCommand = strings.Fields(flags.EditCommand)
+		updated = true
 	}
-	if isDevRun() {
-		if !localBootstrap && strings.TrimSpace(localPath) == "" {
-			localBootstrap = true
+	for _, value := range flags.OpenAllow {
+		domain, err := normalizeOpenDomain(value)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(2)
 		}
-		if !localImage {
-			localImage = true
+		if !slices.Contains(cfg.RPC.OpenAllow, domain) {
+			cfg.RPC.OpenAllow = append(cfg.RPC.OpenAllow, domain)
 		}
+		updated = true
 	}
-	if localBootstrap {
-		ui.Step("Stage server binary")
-		remotePath, err := stageLocalServerBinary(resolved.Host, localPath)
+	for _, value := range flags.OpenDisallow {
+		domain, err := normalizeOpenDomain(value)
 		if err != nil {
-			ui.Fail(err.Error())
-			fmt.Fprintf(os.Stderr, "failed to stage local server binary: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(2)
+		}
+		cfg.RPC.OpenAllow = slices.DeleteFunc(cfg.RPC.OpenAllow, func(existing string) bool { return existing == domain })
+		updated = true
+	}
+	if unlisted := strings.TrimSpace(flags.OpenUnlisted); unlisted != "" {
+		switch unlisted {
+		case config.OpenUnlistedConfirm, config.OpenUnlistedAllow, config.OpenUnlistedDeny:
+		default:
+			fmt.Fprintf(os.Stderr, "invalid --open-unlisted %q (expected confirm, allow or deny)\n", unlisted)
+			os.Exit(2)
 		}
-		ui.Done("")
-		env = append(env, "VIBERUN_SERVER_LOCAL_PATH="+remotePath)
-	}
-	if localImage {
-		ui.Step("Build container image")
-		ui.Suspend()
-		if err := stageLocalImage(resolved.Host); err != nil {
-			ui.Resume()
-			ui.Fail(err.Error())
-			fmt.Fprintf(os.Stderr, "failed to stage local image: %v\n", err)
-			os.Exit(1)
+		cfg.RPC.OpenUnlisted = unlisted
+		updated = true
+	}
+	if flags.OpenPerMinute != 0 {
+		if flags.OpenPerMinute < 0 {
+			fmt.Fprintln(os.Stderr, "--open-per-minute must be positive")
+			os.Exit(2)
 		}
-		ui.Resume()
-		ui.Done("")
-		env = append(env, "VIBERUN_SKIP_IMAGE_PULL=1")
+		cfg.RPC.OpenPerMinute = flags.OpenPerMinute
+		updated = true
+	}
+	if !updated {
+		showConfig(cfg, path)
+		return
 	}
 
-	command := bootstrapCommand(bootstrapScript())
-	remoteArgs := []string{"bash", "-lc", shellQuote(command)}
-	if len(env) > 0 {
-		remoteArgs = append([]string{"env"}, append(env, remoteArgs...)...)
+	if err := config.Save(path, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to save config: %v\n", err)
+		os.Exit(1)
 	}
-	sshArgs := sshcmd.BuildArgs(resolved.Host, remoteArgs, tty)
-	sshArgs = append([]string{"-o", "LogLevel=ERROR"}, sshArgs...)
+	fmt.Fprintf(os.Stdout, "wrote config to %s\n", path)
+}
 
-	cmd := exec.Command("ssh", sshArgs...)
-	cmd.Env = normalizedSshEnv()
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// updateAppConfig applies update to an app's settings, dropping the entry once it is
+// back to the defaults.
+func updateAppConfig(cfg *config.Config, app string, update func(*config.AppConfig)) {
+	appConfig := cfg.Apps[app]
+	update(&appConfig)
+	if appConfig == (config.AppConfig{}) {
+		delete(cfg.Apps, app)
+		return
+	}
+	if cfg.Apps == nil {
+		cfg.Apps = map[string]config.AppConfig{}
+	}
+	cfg.Apps[app] = appConfig
+}
 
-	ui.Step("Run bootstrap")
-	ui.Suspend()
-	if err := cmd.Run(); err != nil {
-		ui.Resume()
-		ui.Fail(err.Error())
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			os.Exit(exitErr.ExitCode())
-		}
-		fmt.Fprintf(os.Stderr, "failed to start ssh: %v\n", err)
+func showConfig(cfg config.Config, path string) {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to format config: %v\n", err)
 		os.Exit(1)
 	}
-	ui.Resume()
-	ui.Done("")
-	if strings.TrimSpace(cfg.DefaultHost) == "" && strings.TrimSpace(hostArg) != "" {
-		cfg.DefaultHost = hostArg
-		if err := config.Save(path, cfg); err != nil {
-			fmt.Fprintf(os.Stderr, "Bootstrap complete, but failed to save default host: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Run `viberun config --host %s` to set it manually.\n", hostArg)
-		} else {
-			fmt.Fprintf(os.Stdout, "default host set to %s\n", hostArg)
-		}
-	}
-	fmt.Fprintln(os.Stdout, "Bootstrap complete.")
+	fmt.Fprintf(os.Stdout, "Config path: %s\n%s\n", path, string(data))
 }
 
 func configFlagsEmpty(flags configFlags) bool {
 	return strings.TrimSpace(flags.Host) == "" &&
 		strings.TrimSpace(flags.DefaultHost) == "" &&
 		strings.TrimSpace(flags.Agent) == "" &&
-		len(flags.SetHosts) == 0
+		len(flags.SetHosts) == 0 &&
+		len(flags.LocalPorts) == 0 &&
+		len(flags.AutoForward) == 0 &&
+		len(flags.AgentNotify) == 0 &&
+		len(flags.RPC) == 0 &&
+		strings.TrimSpace(flags.EditCommand) == "" &&
+		len(flags.OpenAllow) == 0 &&
+		len(flags.OpenDisallow) == 0 &&
+		strings.TrimSpace(flags.OpenUnlisted) == "" &&
+		flags.OpenPerMinute == 0
 }
 
 func runApp(flags runFlags, args runArgs) error {
@@ -415,6 +475,67 @@ func runApp(flags runFlags, args runArgs) error {
 				exitUsage("Usage: viberun [--agent provider] <app> restore <snapshot>")
 			}
 			actionArgs = []string{"restore", value}
+		case "auth":
+			if value != "push" && value != "pull" && value != "status" {
+				exitUsage("Usage: viberun <app> auth push [--provider X] [-y] [--dry-run] | viberun <app> auth pull [--provider X] [--all] | viberun <app> auth status [--provider X]")
+			}
+			actionArgs = []string{"auth", value}
+		case "secrets":
+			name := strings.TrimSpace(args.Name)
+			switch {
+			case value == "ls" && name == "":
+			case (value == "set" || value == "rm") && name != "":
+			default:
+				exitUsage("Usage: viberun <app> secrets set <NAME> | viberun <app> secrets ls | viberun <app> secrets rm <NAME>")
+			}
+			actionArgs = []string{"secrets", value}
+		case "forward":
+			if value != "" {
+				exitUsage("Usage: viberun <app> forward [--port N] [--background]")
+			}
+			actionArgs = []string{"forward"}
+		case "open":
+			actionArgs = []string{"open"}
+		case "share":
+			if value != "" {
+				exitUsage("Usage: viberun <app> share [--ttl 1h]")
+			}
+			actionArgs = []string{"share"}
+			if flags.TTL != 0 {
+				actionArgs = append(actionArgs, flags.TTL.String())
+			}
+		case "shares":
+			name := strings.TrimSpace(args.Name)
+			switch {
+			case value == "" && name == "":
+				actionArgs = []string{"shares"}
+			case value == "rm" && name != "":
+				actionArgs = []string{"shares", "rm", name}
+			default:
+				exitUsage("Usage: viberun <app> shares | viberun <app> shares rm <id>")
+			}
+		case "prompt":
+			if strings.TrimSpace(args.Name) != "" {
+				exitUsage("Usage: viberun <app> prompt \"<prompt>\" | viberun <app> prompt < prompt.txt")
+			}
+			actionArgs = []string{"prompt"}
+		case "status":
+			if value != "" {
+				exitUsage("Usage: viberun <app> status")
+			}
+			actionArgs = []string{"status"}
+		case "health":
+			name := strings.TrimSpace(args.Name)
+			switch {
+			case value == "" && name == "":
+				actionArgs = []string{"health"}
+			case value == "rm" && name == "":
+				actionArgs = []string{"health", "rm"}
+			case value == "set" && name != "":
+				actionArgs = healthSetArgs(name, flags)
+			default:
+				exitUsage("Usage: viberun <app> health | viberun <app> health set <path> [--expect-status 200] [--interval 30s] [--docker-healthcheck] | viberun <app> health rm")
+			}
 		default:
 			exitUsage("Usage: viberun [--agent provider] <app> snapshot | viberun [--agent provider] <app> snapshots | viberun [--agent provider] <app> restore <snapshot> | viberun <app> shell")
 		}
@@ -441,6 +562,9 @@ func runApp(flags runFlags, args runArgs) error {
 	if err != nil {
 		exitUsage(fmt.Sprintf("invalid target: %v", err))
 	}
+	if reservedAppNames[resolved.App] {
+		exitUsage(fmt.Sprintf("%q is a reserved name and cannot be used as an app name", resolved.App))
+	}
 
 	if _, err := exec.LookPath("ssh"); err != nil {
 		return fmt.Errorf("ssh is required but was not found in PATH")
@@ -453,12 +577,37 @@ func runApp(flags runFlags, args runArgs) error {
 	if strings.TrimSpace(flags.Agent) != "" {
 		agentProvider = strings.TrimSpace(flags.Agent)
 	}
+	if capability := requiredCapability(action, flags); capability != "" {
+		if err := requireServerCapability(resolved.Host, capability); err != nil {
+			return err
+		}
+	}
+	if action == "auth" {
+		return runAuthCommand(resolved, agentProvider, value, flags)
+	}
+	if action == "forward" {
+		return runForward(resolved, agentProvider, flags, cfg)
+	}
+	if action == "open" {
+		return runOpen(resolved, agentProvider, value, cfg)
+	}
+	if action == "prompt" {
+		return runPrompt(resolved, agentProvider, value)
+	}
+	if action == "secrets" {
+		return runSecretsCommand(resolved, agentProvider, value, strings.TrimSpace(args.Name))
+	}
 	interactive := len(actionArgs) == 0 || (len(actionArgs) == 1 && actionArgs[0] == "shell")
 	tty := interactive && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
 	if interactive && !tty {
 		return fmt.Errorf("interactive sessions require a TTY; run from a terminal or use snapshot/restore commands")
 	}
 	extraEnv := map[string]string{}
+	if action == "share" {
+		if shareURL := strings.TrimSpace(os.Getenv("VIBERUN_SHARE_URL")); shareURL != "" {
+			extraEnv["VIBERUN_SHARE_URL"] = shareURL
+		}
+	}
 	if tty {
 		if colorTerm := strings.TrimSpace(os.Getenv("COLORTERM")); colorTerm != "" {
 			extraEnv["COLORTERM"] = colorTerm
@@ -479,65 +628,98 @@ func runApp(flags runFlags, args runArgs) error {
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "auth discovery failed: %v\n", err)
 			} else if localAuth != nil && promptCopyAuth(resolved.App, agentProvider, details) {
-				bundle, err := stageAuthBundle(resolved.Host, localAuth)
+				var tooOld serverTooOldError
+				bundle, err := buildAuthBundle(localAuth)
 				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to read auth: %v\n", err)
+				} else if err := requireServerCapability(resolved.Host, version.CapabilityAuthStage); errors.As(err, &tooOld) {
+					fmt.Fprintf(os.Stderr, "server %s is too old for auth staging; upgrade with viberun bootstrap\n", tooOld.Server)
+				} else if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to check server version: %v\n", err)
+				} else if token, err := stageRemoteAuthBundle(resolved, agentProvider, bundle); err != nil {
 					fmt.Fprintf(os.Stderr, "failed to stage auth: %v\n", err)
-				} else if encoded, err := encodeAuthBundle(bundle); err != nil {
-					fmt.Fprintf(os.Stderr, "failed to encode auth: %v\n", err)
-				} else if encoded != "" {
-					extraEnv["VIBERUN_AUTH_BUNDLE"] = encoded
+				} else {
+					extraEnv["VIBERUN_AUTH_TOKEN"] = token
 				}
 			}
 		}
 	}
-	var openServer *http.Server
+	var openServer *rpcServer
 	var remoteSocket *sshcmd.RemoteSocketForward
+	opens := newOpenPolicy(cfg.RPC, resolved.App)
+	var controlPath string
+	var ports *autoForwarder
+	if interactive && !isLocalHost(resolved.Host) && !cfg.Apps[resolved.App].NoAutoForward {
+		controlPath = newControlPath()
+		ports = newAutoForwarder(resolved, agentProvider, controlPath, opens)
+	}
 	if interactive {
-		server, port, err := startOpenListener()
+		server, err := startRPCListener(cfg, resolved.App, opens, ports)
 		if err != nil {
-			return fmt.Errorf("failed to start xdg-open listener: %w", err)
+			return fmt.Errorf("failed to start rpc listener: %w", err)
 		}
 		openServer = server
 		socketPath := newXdgOpenSocketPath()
 		extraEnv["VIBERUN_XDG_OPEN_SOCKET"] = socketPath
 		remoteSocket = &sshcmd.RemoteSocketForward{
 			RemotePath: socketPath,
-			LocalHost:  "localhost",
-			LocalPort:  port,
+			LocalPath:  server.Path,
 		}
 	}
-	remoteArgs := sshcmd.RemoteArgs(resolved.App, agentProvider, actionArgs, extraEnv)
 	var forward *sshcmd.LocalForward
 	if interactive && !isLocalHost(resolved.Host) {
 		hostPort, err := resolveHostPort(resolved, agentProvider)
 		if err != nil {
 			return err
 		}
-		if err := ensureLocalPortAvailable(hostPort); err != nil {
+		localPort, err := localForwardPort(hostPort, cfg.Apps[resolved.App].LocalPort)
+		if err != nil {
 			return err
 		}
 		forward = &sshcmd.LocalForward{
-			LocalPort:  hostPort,
+			LocalPort:  localPort,
 			RemoteHost: "localhost",
 			RemotePort: hostPort,
 		}
+		extraEnv["VIBERUN_LOCAL_PORT"] = strconv.Itoa(localPort)
+		opens.allowLocalPort(localPort)
 	}
+	remoteArgs := sshcmd.RemoteArgs(resolved.App, agentProvider, actionArgs, extraEnv)
 
 	sshArgs := sshcmd.BuildArgsWithForwards(resolved.Host, remoteArgs, tty, forward, remoteSocket)
+	if controlPath != "" {
+		sshArgs = append(sshcmd.ControlMasterArgs(controlPath), sshArgs...)
+	}
 	cmd := exec.Command("ssh", sshArgs...)
 	cmd.Env = normalizedSshEnv()
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	if err := cmd.Run(); err != nil {
+	if err := cmd.Start(); err != nil {
+		if openServer != nil {
+			_ = openServer.Close()
+		}
+		return fmt.Errorf("failed to start ssh: %w", err)
+	}
+	removeSession := func() {}
+	if forward != nil {
+		if remove, err := recordSessionForward(resolved, cmd.Process.Pid, *forward); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to record session forward: %v\n", err)
+		} else {
+			removeSession = remove
+		}
+	}
+	err = cmd.Wait()
+	removeSession()
+	if err != nil {
 		if openServer != nil {
 			_ = openServer.Close()
 		}
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			os.Exit(exitErr.ExitCode())
 		}
-		return fmt.Errorf("failed to start ssh: %w", err)
+		return fmt.Errorf("ssh failed: %w", err)
 	}
 	if openServer != nil {
 		_ = openServer.Close()
@@ -545,161 +727,59 @@ func runApp(flags runFlags, args runArgs) error {
 	return nil
 }
 
-func exitUsage(message string) {
-	fmt.Fprintln(os.Stderr, message)
-	os.Exit(2)
+// reservedAppNames are host-level viberun-server commands.
+var reservedAppNames = map[string]bool{
+	"bootstrap": true,
+	"doctor":    true,
+	"version":   true,
+	"proxy":     true,
+	"ls":        true,
 }
 
-func bootstrapScript() string {
-	return `set -euo pipefail
-
-if [ ! -f /etc/os-release ]; then
-  echo "missing /etc/os-release; cannot verify OS" >&2
-  exit 1
-fi
-
-. /etc/os-release
-if [ "${ID:-}" != "ubuntu" ]; then
-  echo "unsupported OS: ${ID:-unknown}; expected ubuntu" >&2
-  exit 1
-fi
-
-need_cmd() {
-  command -v "$1" >/dev/null 2>&1
-}
-
-SUDO=""
-if [ "$(id -u)" -ne 0 ]; then
-  if ! need_cmd sudo; then
-    echo "sudo is required to bootstrap as a non-root user" >&2
-    exit 1
-  fi
-  SUDO="sudo"
-  if ! sudo -n true 2>/dev/null; then
-    echo "sudo password may be required during bootstrap" >&2
-  fi
-fi
-
-if ! need_cmd curl && ! need_cmd wget; then
-  $SUDO apt-get update -y
-  $SUDO apt-get install -y curl ca-certificates
-fi
-
-if ! need_cmd docker; then
-  if need_cmd curl; then
-    curl -fsSL https://get.docker.com | $SUDO sh
-  else
-    wget -qO- https://get.docker.com | $SUDO sh
-  fi
-fi
-
-if need_cmd systemctl; then
-  $SUDO systemctl enable --now docker
-fi
-
-pull_image() {
-  if [ -n "${VIBERUN_SKIP_IMAGE_PULL:-}" ]; then
-    return 0
-  fi
-  image="$1"
-  if [ -z "$image" ]; then
-    return 0
-  fi
-  if ! $SUDO docker pull "$image"; then
-    echo "warning: failed to pull image $image" >&2
-    return 0
-  fi
-  $SUDO docker tag "$image" "viberun:latest" || true
+// requiredCapability returns the server capability an action depends on, if any.
+func requiredCapability(action string, flags runFlags) string {
+	switch action {
+	case "auth":
+		if flags.DryRun {
+			return version.CapabilityAuthDry
+		}
+		return version.CapabilityAuth
+	case "secrets":
+		return version.CapabilitySecrets
+	case "share", "shares":
+		return version.CapabilityShare
+	case "status", "health":
+		return version.CapabilityHealth
+	case "prompt":
+		return version.CapabilityPrompt
+	case "forward":
+		if len(flags.Ports) > 0 {
+			return version.CapabilityForwardTarget
+		}
+		return ""
+	default:
+		return ""
+	}
 }
 
-if [ "$(id -u)" -ne 0 ]; then
-  if ! getent group docker >/dev/null 2>&1; then
-    $SUDO groupadd docker
-  fi
-  if ! id -nG "$USER" | tr ' ' '\n' | grep -qx docker; then
-    $SUDO usermod -aG docker "$USER"
-    echo "added $USER to docker group; run 'newgrp docker' or reconnect to apply" >&2
-  fi
-fi
-
-VIBERUN_SERVER_REPO="${VIBERUN_SERVER_REPO:-shayne/viberun}"
-VIBERUN_SERVER_VERSION="${VIBERUN_SERVER_VERSION:-latest}"
-VIBERUN_SERVER_INSTALL_DIR="${VIBERUN_SERVER_INSTALL_DIR:-/usr/local/bin}"
-VIBERUN_SERVER_BIN="${VIBERUN_SERVER_BIN:-viberun-server}"
-VIBERUN_IMAGE="${VIBERUN_IMAGE:-}"
-
-os="$(uname -s | tr '[:upper:]' '[:lower:]')"
-arch_raw="$(uname -m)"
-case "$arch_raw" in
-  x86_64|amd64)
-    arch="amd64"
-    ;;
-  arm64|aarch64)
-    arch="arm64"
-    ;;
-  *)
-    echo "unsupported architecture: $arch_raw" >&2
-    exit 1
-    ;;
-esac
-
-if [ "$os" != "linux" ]; then
-  echo "unsupported OS: $os; expected linux" >&2
-  exit 1
-fi
-
-if [ -z "$VIBERUN_IMAGE" ]; then
-  if [ "$VIBERUN_SERVER_VERSION" = "latest" ]; then
-    VIBERUN_IMAGE="ghcr.io/${VIBERUN_SERVER_REPO}/viberun:latest"
-  else
-    VIBERUN_IMAGE="ghcr.io/${VIBERUN_SERVER_REPO}/viberun:${VIBERUN_SERVER_VERSION}"
-  fi
-fi
-
-if need_cmd docker; then
-  pull_image "$VIBERUN_IMAGE"
-fi
-
-asset="viberun-server-${os}-${arch}"
-local_path="${VIBERUN_SERVER_LOCAL_PATH:-}"
-tmp_file=""
-if [ -n "$local_path" ]; then
-  if [ ! -f "$local_path" ]; then
-    echo "missing local server binary at $local_path" >&2
-    exit 1
-  fi
-  tmp_file="$local_path"
-else
-  if [ "$VIBERUN_SERVER_VERSION" = "latest" ]; then
-    download_url="https://github.com/${VIBERUN_SERVER_REPO}/releases/latest/download/${asset}"
-  else
-    version="$VIBERUN_SERVER_VERSION"
-    case "$version" in
-      v*)
-        ;;
-      *)
-        version="v$version"
-        ;;
-    esac
-    download_url="https://github.com/${VIBERUN_SERVER_REPO}/releases/download/${version}/${asset}"
-  fi
-  tmp_file="$(mktemp)"
-  if need_cmd curl; then
-    curl -fsSL "$download_url" >"$tmp_file"
-  else
-    wget -qO- "$download_url" >"$tmp_file"
-  fi
-fi
-
-trap 'rm -f "$tmp_file"' EXIT
-
-$SUDO install -m 0755 "$tmp_file" "$VIBERUN_SERVER_INSTALL_DIR/$VIBERUN_SERVER_BIN"
-`
+// healthSetArgs builds the server's "health set <path> [status] [interval] [docker]".
+func healthSetArgs(path string, flags runFlags) []string {
+	args := []string{"health", "set", path}
+	if flags.ExpectStatus != 0 {
+		args = append(args, strconv.Itoa(flags.ExpectStatus))
+	}
+	if flags.Interval != 0 {
+		args = append(args, flags.Interval.String())
+	}
+	if flags.DockerHealth {
+		args = append(args, "docker")
+	}
+	return args
 }
 
-func bootstrapCommand(script string) string {
-	encoded := base64.StdEncoding.EncodeToString([]byte(script))
-	return "echo " + shellQuote(encoded) + " | base64 -d | bash"
+func exitUsage(message string) {
+	fmt.Fprintln(os.Stderr, message)
+	os.Exit(2)
 }
 
 func shellQuote(value string) string {
@@ -759,6 +839,40 @@ func ensureLocalPortAvailable(port int) error {
 	return nil
 }
 
+// localPortSearchRange is how many ports above the host port are tried for the local
+// end of a forward.
+const localPortSearchRange = 100
+
+// localForwardPort picks the localhost end of a forward to hostPort: the pinned port if
+// configured, else hostPort itself, else the next free port above it.
+func localForwardPort(hostPort int, pinned int) (int, error) {
+	if pinned > 0 {
+		if err := ensureLocalPortAvailable(pinned); err != nil {
+			return 0, fmt.Errorf("%w (pinned with viberun config --local-port)", err)
+		}
+		return pinned, nil
+	}
+	port, err := freeLocalPort(hostPort)
+	if err == nil && port != hostPort {
+		fmt.Fprintf(os.Stderr, "localhost:%d is in use; forwarding localhost:%d instead\n", hostPort, port)
+	}
+	return port, err
+}
+
+// freeLocalPort returns port if it is free on localhost, else the next free port above it.
+func freeLocalPort(port int) (int, error) {
+	if port <= 0 {
+		return 0, fmt.Errorf("invalid host port %d", port)
+	}
+	last := min(port+localPortSearchRange, 65535)
+	for candidate := port; candidate <= last; candidate++ {
+		if ensureLocalPortAvailable(candidate) == nil {
+			return candidate, nil
+		}
+	}
+	return 0, fmt.Errorf("no free localhost port in %d-%d", port, last)
+}
+
 func isLocalHost(host string) bool {
 	normalized := strings.TrimSpace(host)
 	if normalized == "" {
@@ -794,42 +908,6 @@ func newXdgOpenSocketPath() string {
 	return fmt.Sprintf("%s%d-%d%s", prefix, os.Getpid(), time.Now().UnixNano(), suffix)
 }
 
-func startOpenListener() (*http.Server, int, error) {
-	listener, err := net.Listen("tcp", "127.0.0.1:0")
-	if err != nil {
-		return nil, 0, err
-	}
-	port := listener.Addr().(*net.TCPAddr).Port
-	server := &http.Server{
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.Method != http.MethodPost || r.URL.Path != "/open" {
-				http.Error(w, "not found", http.StatusNotFound)
-				return
-			}
-			r.Body = http.MaxBytesReader(w, r.Body, 4096)
-			if err := r.ParseForm(); err != nil {
-				http.Error(w, "invalid request", http.StatusBadRequest)
-				return
-			}
-			raw := strings.TrimSpace(r.Form.Get("url"))
-			cleaned, err := validateOpenURL(raw)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-			if err := openURL(cleaned); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			w.WriteHeader(http.StatusNoContent)
-		}),
-	}
-	go func() {
-		_ = server.Serve(listener)
-	}()
-	return server, port, nil
-}
-
 func validateOpenURL(raw string) (string, error) {
 	cleaned := strings.TrimSpace(raw)
 	if cleaned == "" {
@@ -905,7 +983,7 @@ func isDevRun() bool {
 	return strings.Contains(os.Args[0], "go-build")
 }
 
-func stageLocalImage(host string) error {
+func stageLocalImage(host string, runtimeName string) error {
 	if _, err := exec.LookPath("docker"); err != nil {
 		return fmt.Errorf("docker is required to build the image locally")
 	}
@@ -920,7 +998,7 @@ func stageLocalImage(host string) error {
 	if err := buildCmd.Run(); err != nil {
 		return err
 	}
-	sshArgs := sshcmd.BuildArgs(host, []string{"docker", "load"}, false)
+	sshArgs := sshcmd.BuildArgs(host, []string{runtimeName, "load"}, false)
 	loadCmd := exec.Command("ssh", sshArgs...)
 	loadCmd.Env = normalizedSshEnv()
 	loadCmd.Stdout = os.Stdout
@@ -945,7 +1023,7 @@ func stageLocalImage(host string) error {
 	if err := loadCmd.Wait(); err != nil {
 		return err
 	}
-	tagArgs := sshcmd.BuildArgs(host, []string{"docker", "tag", tag, "viberun:latest"}, false)
+	tagArgs := sshcmd.BuildArgs(host, []string{runtimeName, "tag", tag, "viberun:latest"}, false)
 	tagCmd := exec.Command("ssh", tagArgs...)
 	tagCmd.Env = normalizedSshEnv()
 	tagCmd.Stdout = os.Stdout
@@ -985,10 +1063,18 @@ func stageLocalServerBinary(host string, localPath string) (string, error) {
 	if _, err := os.Stat(path); err != nil {
 		return "", fmt.Errorf("local binary not found: %w", err)
 	}
+	return uploadServerBinary(host, path)
+}
+
+// uploadServerBinary copies a server binary to a temp path on the host and makes it executable.
+func uploadServerBinary(host string, path string) (string, error) {
 	remotePath := fmt.Sprintf("/tmp/viberun-server-%d", time.Now().UnixNano())
 	if err := uploadFileOverSSH(host, path, remotePath); err != nil {
 		return "", err
 	}
+	if _, err := sshOutput(host, []string{"chmod", "0755", remotePath}); err != nil {
+		return "", err
+	}
 	return remotePath, nil
 }
 
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"net"
 	"reflect"
 	"testing"
+
+	"github.com/shayne/viberun/internal/config"
 )
 
 func TestEnsureRunSubcommandBootstrap(t *testing.T) {
@@ -39,3 +42,35 @@ func TestEnsureRunSubcommandWithAgentFlag(t *testing.T) {
 		t.Fatalf("expected %v, got %v", want, got)
 	}
 }
+
+func TestLocalForwardPortSkipsBusyPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	busy := listener.Addr().(*net.TCPAddr).Port
+
+	port, err := localForwardPort(busy, 0)
+	if err != nil {
+		t.Fatalf("localForwardPort: %v", err)
+	}
+	if port <= busy {
+		t.Fatalf("expected a port above busy port %d, got %d", busy, port)
+	}
+	if _, err := localForwardPort(busy+1, busy); err == nil {
+		t.Fatalf("expected an error when the pinned port is busy")
+	}
+}
+
+func TestUpdateAppConfigDropsDefaults(t *testing.T) {
+	cfg := config.Config{}
+	updateAppConfig(&cfg, "myapp", func(app *config.AppConfig) { app.NoAgentNotify = true })
+	if !cfg.Apps["myapp"].NoAgentNotify {
+		t.Fatalf("expected myapp to opt out, got %+v", cfg.Apps)
+	}
+	updateAppConfig(&cfg, "myapp", func(app *config.AppConfig) { app.NoAgentNotify = false })
+	if _, ok := cfg.Apps["myapp"]; ok {
+		t.Fatalf("expected default entry to be dropped, got %+v", cfg.Apps)
+	}
+}
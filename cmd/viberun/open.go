@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shayne/viberun/internal/config"
+	"github.com/shayne/viberun/internal/sshcmd"
+	"github.com/shayne/viberun/internal/target"
+	"github.com/shayne/viberun/internal/version"
+)
+
+// appWaitTimeout is how long `viberun <app> open` waits for the app to answer.
+const appWaitTimeout = 15 * time.Second
+
+// runOpen opens the app in the local browser through the forward of a running session
+// or `viberun forward`, starting a background forward only when there is neither.
+func runOpen(resolved target.Resolved, agentProvider string, path string, cfg config.Config) error {
+	if err := probeApp(resolved, agentProvider); err != nil {
+		return err
+	}
+	var localPort int
+	if isLocalHost(resolved.Host) {
+		hostPort, err := resolveHostPort(resolved, agentProvider)
+		if err != nil {
+			return err
+		}
+		localPort = hostPort
+	} else {
+		record, ok := findSessionForward(resolved.Host, resolved.App)
+		if !ok {
+			record, ok = findForward(resolved.Host, resolved.App)
+		}
+		if !ok {
+			fmt.Fprintf(os.Stdout, "No session or forward is running for %s; starting a background forward that keeps running after the browser opens\n", resolved.App)
+			if err := runForward(resolved, agentProvider, runFlags{Background: true}, cfg); err != nil {
+				return err
+			}
+			if record, ok = findForward(resolved.Host, resolved.App); !ok {
+				return fmt.Errorf("forward for %s started but is not running", resolved.App)
+			}
+		}
+		localPort = record.Ports[0].Local
+	}
+	rawURL := appURL(localPort, path)
+	if err := waitForApp(rawURL, appWaitTimeout); err != nil {
+		return fmt.Errorf("nothing is answering on %s's app port (8080 in the container) after %s; start the app and try again", resolved.App, appWaitTimeout)
+	}
+	fmt.Fprintf(os.Stdout, "Opening %s\n", rawURL)
+	return openURL(rawURL)
+}
+
+// probeApp asks the server once whether the app answers, so open fails at once instead
+// of after appWaitTimeout. Servers too old to probe are left to waitForApp.
+func probeApp(resolved target.Resolved, agentProvider string) error {
+	var tooOld serverTooOldError
+	if err := requireServerCapability(resolved.Host, version.CapabilityProbe); errors.As(err, &tooOld) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	remoteArgs := sshcmd.RemoteArgs(resolved.App, agentProvider, []string{"probe"}, nil)
+	if _, err := sshOutput(resolved.Host, remoteArgs); err != nil {
+		return fmt.Errorf("cannot open %s: %w", resolved.App, err)
+	}
+	return nil
+}
+
+// appURL joins the forwarded localhost port and an optional path such as "/admin?x=1".
+func appURL(port int, path string) string {
+	path = strings.TrimSpace(path)
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("http://localhost:%d%s", port, path)
+}
+
+// waitForApp polls rawURL until the app returns any HTTP response. Through an ssh
+// forward the local port always accepts, so only a response shows the app is up.
+func waitForApp(rawURL string, timeout time.Duration) error {
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := client.Get(rawURL)
+		if err == nil {
+			_ = resp.Body.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
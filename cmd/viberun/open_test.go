@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAppURL(t *testing.T) {
+	cases := map[string]string{
+		"":           "http://localhost:8080/",
+		"/admin":     "http://localhost:8080/admin",
+		"docs?q=1":   "http://localhost:8080/docs?q=1",
+		" /a/b#top ": "http://localhost:8080/a/b#top",
+	}
+	for path, want := range cases {
+		if got := appURL(8080, path); got != want {
+			t.Fatalf("%q: expected %s, got %s", path, want, got)
+		}
+	}
+}
+
+func TestWaitForApp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	if err := waitForApp(server.URL, time.Second); err != nil {
+		t.Fatalf("expected any response to count, got %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+	if err := waitForApp("http://"+addr+"/", 100*time.Millisecond); err == nil {
+		t.Fatalf("expected a closed port to time out")
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shayne/viberun/internal/config"
+	"github.com/shayne/viberun/internal/rpc"
+)
+
+// defaultOpensPerMinute caps open requests when the config sets no limit.
+const defaultOpensPerMinute = 10
+
+// confirmTimeout is how long a confirmation dialog waits before it counts as denied.
+const confirmTimeout = time.Minute
+
+// Open decisions, as written to the audit log.
+const (
+	openAllowed = "allowed"
+	openDenied  = "denied"
+	openConfirm = "confirm"
+)
+
+// openPolicy decides which URLs a container may open on this machine: localhost URLs
+// on a viberun forward and allowlisted domains open directly, everything else follows
+// the unlisted setting. Every request is rate limited and written to the audit log.
+type openPolicy struct {
+	app       string
+	allow     []string
+	unlisted  string
+	perMinute int
+	auditPath string
+	now       func() time.Time
+	open      func(rawURL string) error
+	confirm   func(app string, rawURL string) (bool, error)
+	// forwardedPorts returns the local ports of background forwards.
+	forwardedPorts func() []int
+
+	mu      sync.Mutex
+	ports   map[int]bool
+	recent  []time.Time
+	dialogs sync.Mutex
+}
+
+func newOpenPolicy(cfg config.RPCConfig, app string) *openPolicy {
+	perMinute := cfg.OpenPerMinute
+	if perMinute <= 0 {
+		perMinute = defaultOpensPerMinute
+	}
+	unlisted := cfg.OpenUnlisted
+	if unlisted == "" {
+		unlisted = config.OpenUnlistedConfirm
+	}
+	auditPath, _ := openAuditPath()
+	return &openPolicy{
+		app:       app,
+		allow:     cfg.OpenAllow,
+		unlisted:  unlisted,
+		perMinute: perMinute,
+		auditPath: auditPath,
+		now:       time.Now,
+		open:      openURL,
+		confirm:   confirmOpen,
+		forwardedPorts: func() []int {
+			records, _ := listForwards()
+			ports := []int{}
+			for _, record := range records {
+				for _, port := range record.Ports {
+					ports = append(ports, port.Local)
+				}
+			}
+			return ports
+		},
+		ports: map[int]bool{},
+	}
+}
+
+// allowLocalPort lets the container open localhost URLs on port, which this session
+// forwards to the app.
+func (p *openPolicy) allowLocalPort(port int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ports[port] = true
+}
+
+// revokeLocalPort undoes allowLocalPort once the session stops forwarding port.
+func (p *openPolicy) revokeLocalPort(port int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.ports, port)
+}
+
+// Open is the rpc.Handler open endpoint.
+func (p *openPolicy) Open(raw string) error {
+	cleaned, err := validateOpenURL(raw)
+	if err != nil {
+		p.audit(raw, openDenied, err.Error())
+		return rpc.Invalid(err)
+	}
+	if !p.take() {
+		p.audit(cleaned, openDenied, "rate limited")
+		return rpc.Denied(fmt.Errorf("too many open requests (limit %d per minute)", p.perMinute))
+	}
+	decision, reason := p.decide(cleaned)
+	if decision == openConfirm {
+		decision, reason = p.ask(cleaned)
+	}
+	p.audit(cleaned, decision, reason)
+	if decision != openAllowed {
+		host := strings.ToLower(urlHostname(cleaned))
+		return rpc.Denied(fmt.Errorf("opening %s was denied (%s); allow it with: viberun config --open-allow %s", cleaned, reason, host))
+	}
+	return p.open(cleaned)
+}
+
+// decide applies the policy to a validated URL without asking anyone.
+func (p *openPolicy) decide(cleaned string) (string, string) {
+	parsed, err := url.Parse(cleaned)
+	if err != nil {
+		return openDenied, "invalid url"
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if host == "localhost" || host == "127.0.0.1" || host == "::1" {
+		port := parsed.Port()
+		if port == "" {
+			port = map[string]string{"http": "80", "https": "443"}[strings.ToLower(parsed.Scheme)]
+		}
+		if number, err := strconv.Atoi(port); err == nil && p.forwarded(number) {
+			return openAllowed, "forwarded port"
+		}
+	}
+	for _, domain := range p.allow {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return openAllowed, "allowlisted"
+		}
+	}
+	switch p.unlisted {
+	case config.OpenUnlistedAllow:
+		return openAllowed, "unlisted urls allowed"
+	case config.OpenUnlistedDeny:
+		return openDenied, "not allowlisted"
+	default:
+		return openConfirm, ""
+	}
+}
+
+// ask shows one confirmation dialog at a time.
+func (p *openPolicy) ask(cleaned string) (string, string) {
+	p.dialogs.Lock()
+	defer p.dialogs.Unlock()
+	ok, err := p.confirm(p.app, cleaned)
+	switch {
+	case err != nil:
+		return openDenied, "confirmation unavailable: " + err.Error()
+	case ok:
+		return openAllowed, "confirmed"
+	default:
+		return openDenied, "declined"
+	}
+}
+
+func (p *openPolicy) forwarded(port int) bool {
+	p.mu.Lock()
+	allowed := p.ports[port]
+	p.mu.Unlock()
+	if allowed {
+		return true
+	}
+	for _, forwarded := range p.forwardedPorts() {
+		if forwarded == port {
+			return true
+		}
+	}
+	return false
+}
+
+// take records a request and reports whether it is within the per-minute limit.
+func (p *openPolicy) take() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	recent := p.recent[:0]
+	for _, at := range p.recent {
+		if now.Sub(at) < time.Minute {
+			recent = append(recent, at)
+		}
+	}
+	p.recent = recent
+	if len(p.recent) >= p.perMinute {
+		return false
+	}
+	p.recent = append(p.recent, now)
+	return true
+}
+
+type openAuditEntry struct {
+	Time     time.Time `json:"time"`
+	App      string    `json:"app"`
+	URL      string    `json:"url"`
+	Decision string    `json:"decision"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// audit appends one line to the audit log. Failures are ignored: the session owns the
+// terminal, and a missing log must not block opening.
+func (p *openPolicy) audit(rawURL string, decision string, reason string) {
+	if p.auditPath == "" {
+		return
+	}
+	data, err := json.Marshal(openAuditEntry{Time: p.now().UTC(), App: p.app, URL: rawURL, Decision: decision, Reason: reason})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(p.auditPath), 0o700); err != nil {
+		return
+	}
+	file, err := os.OpenFile(p.auditPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	_, _ = file.Write(append(data, '\n'))
+}
+
+// openAuditPath is $XDG_STATE_HOME/viberun/open-audit.log.
+func openAuditPath() (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "viberun", "open-audit.log"), nil
+}
+
+// normalizeOpenDomain accepts "example.com", "*.example.com" or ".example.com".
+func normalizeOpenDomain(value string) (string, error) {
+	domain := strings.ToLower(strings.TrimSpace(value))
+	domain = strings.TrimPrefix(strings.TrimPrefix(domain, "*"), ".")
+	if domain == "" || strings.ContainsAny(domain, "/:@ ") {
+		return "", fmt.Errorf("invalid domain %q (expected e.g. example.com)", value)
+	}
+	return domain, nil
+}
+
+func urlHostname(cleaned string) string {
+	parsed, err := url.Parse(cleaned)
+	if err != nil {
+		return cleaned
+	}
+	return parsed.Hostname()
+}
+
+// confirmOpen asks in a desktop dialog, since the session owns the terminal.
+func confirmOpen(app string, rawURL string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), confirmTimeout+5*time.Second)
+	defer cancel()
+	text := fmt.Sprintf("%s wants to open:\n%s", app, rawURL)
+	seconds := strconv.Itoa(int(confirmTimeout / time.Second))
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf(`display dialog %s with title "viberun" buttons {"Deny", "Open"} default button "Deny" giving up after %s`, appleScriptString(text), seconds)
+		out, err := exec.CommandContext(ctx, "osascript", "-e", script).Output()
+		if err != nil {
+			return false, fmt.Errorf("osascript failed")
+		}
+		return strings.Contains(string(out), "button returned:Open") && !strings.Contains(string(out), "gave up:true"), nil
+	case "windows":
+		return false, fmt.Errorf("no confirmation dialog on windows")
+	}
+	var cmd *exec.Cmd
+	switch {
+	case lookPathOK("zenity"):
+		cmd = exec.CommandContext(ctx, "zenity", "--question", "--title=viberun", "--text="+text, "--ok-label=Open", "--cancel-label=Deny", "--timeout="+seconds)
+	case lookPathOK("kdialog"):
+		cmd = exec.CommandContext(ctx, "kdialog", "--title", "viberun", "--yes-label", "Open", "--no-label", "Deny", "--yesno", text)
+	case lookPathOK("notify-send"):
+		out, err := exec.CommandContext(ctx, "notify-send", "--app-name=viberun", "--wait", "--action=open=Open", "--expire-time="+seconds+"000", "viberun", text).Output()
+		if err != nil {
+			return false, fmt.Errorf("notify-send does not support actions")
+		}
+		return strings.TrimSpace(string(out)) == "open", nil
+	default:
+		return false, fmt.Errorf("install zenity, kdialog or notify-send")
+	}
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func lookPathOK(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shayne/viberun/internal/config"
+)
+
+func testOpenPolicy(t *testing.T, cfg config.RPCConfig) (*openPolicy, *[]string) {
+	t.Helper()
+	opened := []string{}
+	policy := newOpenPolicy(cfg, "myapp")
+	policy.auditPath = filepath.Join(t.TempDir(), "open-audit.log")
+	policy.open = func(raw string) error {
+		opened = append(opened, raw)
+		return nil
+	}
+	policy.confirm = func(string, string) (bool, error) {
+		return false, errors.New("no dialog")
+	}
+	policy.forwardedPorts = func() []int { return []int{9229} }
+	return policy, &opened
+}
+
+func TestOpenPolicyDecide(t *testing.T) {
+	policy, _ := testOpenPolicy(t, config.RPCConfig{OpenAllow: []string{"github.com"}})
+	policy.allowLocalPort(18080)
+	cases := map[string]string{
+		"http://localhost:18080/":       openAllowed,
+		"http://127.0.0.1:9229/json":    openAllowed,
+		"http://localhost:3000/":        openConfirm,
+		"https://github.com/x/y":        openAllowed,
+		"https://gist.github.com/x":     openAllowed,
+		"https://notgithub.com/":        openConfirm,
+		"https://github.com.evil.test/": openConfirm,
+	}
+	for raw, want := range cases {
+		if got, _ := policy.decide(raw); got != want {
+			t.Errorf("%s: expected %s, got %s", raw, want, got)
+		}
+	}
+	policy.unlisted = config.OpenUnlistedDeny
+	if got, _ := policy.decide("https://example.com/"); got != openDenied {
+		t.Fatalf("expected deny policy to deny, got %s", got)
+	}
+	policy.unlisted = config.OpenUnlistedAllow
+	if got, _ := policy.decide("https://example.com/"); got != openAllowed {
+		t.Fatalf("expected allow policy to allow, got %s", got)
+	}
+}
+
+func TestOpenPolicyConfirmsAndAudits(t *testing.T) {
+	policy, opened := testOpenPolicy(t, config.RPCConfig{})
+	if err := policy.Open("https://example.com/"); err == nil || !strings.Contains(err.Error(), "--open-allow example.com") {
+		t.Fatalf("expected denial with a hint, got %v", err)
+	}
+	policy.confirm = func(string, string) (bool, error) { return true, nil }
+	if err := policy.Open("https://example.com/"); err != nil {
+		t.Fatalf("expected confirmed open, got %v", err)
+	}
+	if len(*opened) != 1 {
+		t.Fatalf("expected one open, got %v", *opened)
+	}
+	data, err := os.ReadFile(policy.auditPath)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two audit entries, got %q", data)
+	}
+	var entry openAuditEntry
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("decode audit entry: %v", err)
+	}
+	if entry.App != "myapp" || entry.Decision != openAllowed || entry.Reason != "confirmed" {
+		t.Fatalf("unexpected audit entry %+v", entry)
+	}
+}
+
+func TestOpenPolicyRateLimit(t *testing.T) {
+	policy, opened := testOpenPolicy(t, config.RPCConfig{OpenUnlisted: config.OpenUnlistedAllow, OpenPerMinute: 2})
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	policy.now = func() time.Time { return now }
+	for i := 0; i < 2; i++ {
+		if err := policy.Open("https://example.com/"); err != nil {
+			t.Fatalf("open %d: %v", i, err)
+		}
+	}
+	if err := policy.Open("https://example.com/"); err == nil {
+		t.Fatalf("expected third open to be rate limited")
+	}
+	now = now.Add(time.Minute)
+	if err := policy.Open("https://example.com/"); err != nil {
+		t.Fatalf("expected open after a minute, got %v", err)
+	}
+	if len(*opened) != 3 {
+		t.Fatalf("expected three opens, got %v", *opened)
+	}
+}
+
+func TestNormalizeOpenDomain(t *testing.T) {
+	for input, want := range map[string]string{"GitHub.com": "github.com", "*.example.com": "example.com", ".example.com": "example.com"} {
+		if got, err := normalizeOpenDomain(input); err != nil || got != want {
+			t.Fatalf("%s: expected %s, got %s %v", input, want, got, err)
+		}
+	}
+	for _, input := range []string{"", "https://example.com", "example.com:443"} {
+		if _, err := normalizeOpenDomain(input); err == nil {
+			t.Fatalf("expected %q to be rejected", input)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/shayne/viberun/internal/sshcmd"
+	"github.com/shayne/viberun/internal/target"
+	"golang.org/x/term"
+)
+
+// runPrompt runs the agent non-interactively in the app's container and streams its
+// output. The prompt comes from the command line or, when that is empty, stdin.
+func runPrompt(resolved target.Resolved, agentProvider string, text string) error {
+	prompt, err := promptInput(text, os.Stdin, term.IsTerminal(int(os.Stdin.Fd())))
+	if err != nil {
+		return err
+	}
+	remoteArgs := sshcmd.RemoteArgs(resolved.App, agentProvider, []string{"prompt"}, nil)
+	sshArgs := sshcmd.BuildArgs(resolved.Host, remoteArgs, false)
+	cmd := exec.Command("ssh", sshArgs...)
+	cmd.Env = normalizedSshEnv()
+	// ssh joins the remote argv with spaces, so the prompt travels over stdin.
+	cmd.Stdin = strings.NewReader(prompt)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		return fmt.Errorf("failed to start ssh: %w", err)
+	}
+	return nil
+}
+
+func promptInput(text string, stdin io.Reader, stdinTerminal bool) (string, error) {
+	if strings.TrimSpace(text) == "" && !stdinTerminal {
+		raw, err := io.ReadAll(io.LimitReader(stdin, 1<<20))
+		if err != nil {
+			return "", err
+		}
+		text = string(raw)
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("prompt is empty; pass it as an argument or on stdin")
+	}
+	return text, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shayne/viberun/internal/version"
+)
+
+func TestPromptInput(t *testing.T) {
+	got, err := promptInput(" fix the tests ", strings.NewReader("ignored"), false)
+	if err != nil || got != "fix the tests" {
+		t.Fatalf("expected argument prompt, got %q (%v)", got, err)
+	}
+	got, err = promptInput("", strings.NewReader("from stdin\n"), false)
+	if err != nil || got != "from stdin" {
+		t.Fatalf("expected stdin prompt, got %q (%v)", got, err)
+	}
+	if _, err := promptInput("", strings.NewReader("typed"), true); err == nil {
+		t.Fatalf("expected error without a prompt on a terminal")
+	}
+}
+
+func TestRequiredCapabilityPrompt(t *testing.T) {
+	if got := requiredCapability("prompt", runFlags{}); got != version.CapabilityPrompt {
+		t.Fatalf("expected %q, got %q", version.CapabilityPrompt, got)
+	}
+}
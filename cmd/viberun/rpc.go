@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/shayne/viberun/internal/config"
+	"github.com/shayne/viberun/internal/rpc"
+)
+
+// rpcServer is the session's RPC API, served on a unix socket that only this user can
+// connect to. The session forwards it to a unix socket in the container.
+type rpcServer struct {
+	server *http.Server
+	dir    string
+	// Path is the local socket.
+	Path string
+}
+
+// startRPCListener serves the container RPC API on a unix socket in a private directory,
+// so no other local user or process (or web page) can reach it the way they could a
+// localhost port.
+func startRPCListener(cfg config.Config, app string, opens *openPolicy, ports *autoForwarder) (*rpcServer, error) {
+	dir, err := os.MkdirTemp("", "viberun-rpc-")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "rpc.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = listener.Close()
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	server := &http.Server{Handler: rpcHandler(cfg, app, opens, ports)}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return &rpcServer{server: server, dir: dir, Path: path}, nil
+}
+
+// Close stops serving and removes the socket.
+func (s *rpcServer) Close() error {
+	err := s.server.Close()
+	_ = os.RemoveAll(s.dir)
+	return err
+}
+
+// rpcHandler wires the endpoints enabled in cfg to this machine's desktop. Opening URLs
+// goes through opens; agent notifications are on unless the app opted out, and ports
+// is nil when the session does not auto-forward.
+func rpcHandler(cfg config.Config, app string, opens *openPolicy, ports *autoForwarder) *rpc.Handler {
+	handler := &rpc.Handler{Open: opens.Open}
+	if cfg.RPC.ClipboardCopy {
+		handler.Copy = copyToClipboard
+	}
+	if cfg.RPC.ClipboardPaste {
+		handler.Paste = pasteFromClipboard
+	}
+	if cfg.RPC.Notify {
+		handler.Notify = sendNotification
+	}
+	if cfg.RPC.Download {
+		handler.DownloadDir = downloadsDir()
+	}
+	if cfg.RPC.Edit {
+		handler.Edit = func(path string) error {
+			return runEditCommand(cfg.RPC.EditCommand, path)
+		}
+	}
+	if !cfg.Apps[app].NoAgentNotify {
+		handler.AgentEvent = func(event string, message string) error {
+			title, body := agentNotification(app, event, message)
+			return sendNotification(title, body)
+		}
+	}
+	if ports != nil {
+		handler.Ports = ports.Update
+	}
+	return handler
+}
+
+// agentNotification formats the desktop notification for an agent event.
+func agentNotification(app string, event string, message string) (string, string) {
+	title := "viberun " + app
+	body := "Agent is waiting for input"
+	switch event {
+	case rpc.EventApproval:
+		body = "Agent needs approval"
+	case rpc.EventDone:
+		body = "Agent finished"
+	}
+	if message = strings.Join(strings.Fields(message), " "); message != "" {
+		if runes := []rune(message); len(runes) > maxNotificationMessage {
+			message = strings.TrimSpace(string(runes[:maxNotificationMessage])) + "…"
+		}
+		body += ": " + message
+	}
+	return title, body
+}
+
+// maxNotificationMessage bounds the agent text shown in a notification.
+const maxNotificationMessage = 160
+
+// rpcSettingEndpoints are the endpoints `viberun config --rpc` can switch.
+var rpcSettingEndpoints = []string{rpc.EndpointClipboardCopy, rpc.EndpointClipboardPaste, rpc.EndpointNotify, rpc.EndpointDownload, rpc.EndpointEdit}
+
+// setRPCEndpoint enables or disables one endpoint by its rpc.Endpoint name.
+func setRPCEndpoint(cfg *config.RPCConfig, name string, enabled bool) error {
+	switch name {
+	case rpc.EndpointClipboardCopy:
+		cfg.ClipboardCopy = enabled
+	case rpc.EndpointClipboardPaste:
+		cfg.ClipboardPaste = enabled
+	case rpc.EndpointNotify:
+		cfg.Notify = enabled
+	case rpc.EndpointDownload:
+		cfg.Download = enabled
+	case rpc.EndpointEdit:
+		cfg.Edit = enabled
+	case rpc.EndpointOpen:
+		return fmt.Errorf("%s is always enabled", name)
+	case rpc.EndpointAgentEvent:
+		return fmt.Errorf("%s is set per app with: viberun config --agent-notify <app>=on|off", name)
+	case rpc.EndpointPorts:
+		return fmt.Errorf("%s is set per app with: viberun config --auto-forward <app>=on|off", name)
+	default:
+		return fmt.Errorf("unknown rpc endpoint %q (expected one of %s)", name, strings.Join(rpcSettingEndpoints, ", "))
+	}
+	return nil
+}
+
+func copyToClipboard(text string) error {
+	name, args, err := clipboardCommand(true)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(text)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %s", name, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func pasteFromClipboard() (string, error) {
+	name, args, err := clipboardCommand(false)
+	if err != nil {
+		return "", err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %s", name, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// clipboardCommand returns the platform's clipboard tool for copying or pasting.
+func clipboardCommand(copying bool) (string, []string, error) {
+	var candidates [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = [][]string{{"pbpaste"}}
+		if copying {
+			candidates = [][]string{{"pbcopy"}}
+		}
+	case "windows":
+		candidates = [][]string{{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"}}
+		if copying {
+			candidates = [][]string{{"clip"}}
+		}
+	default:
+		candidates = [][]string{{"wl-paste", "--no-newline"}, {"xclip", "-selection", "clipboard", "-o"}, {"xsel", "--clipboard", "--output"}}
+		if copying {
+			candidates = [][]string{{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}}
+		}
+		if os.Getenv("WAYLAND_DISPLAY") == "" {
+			candidates = candidates[1:]
+		}
+	}
+	for _, candidate := range candidates {
+		if _, err := exec.LookPath(candidate[0]); err == nil {
+			return candidate[0], candidate[1:], nil
+		}
+	}
+	return "", nil, fmt.Errorf("no clipboard tool available")
+}
+
+func sendNotification(title string, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+		cmd = exec.Command("osascript", "-e", script)
+	case "windows":
+		return fmt.Errorf("notifications are not supported on windows")
+	default:
+		if _, err := exec.LookPath("notify-send"); err != nil {
+			return fmt.Errorf("notify-send is required for notifications")
+		}
+		cmd = exec.Command("notify-send", "--app-name=viberun", title, message)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("notification failed: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func appleScriptString(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+// downloadsDir is XDG_DOWNLOAD_DIR or ~/Downloads.
+func downloadsDir() string {
+	if dir := strings.TrimSpace(os.Getenv("XDG_DOWNLOAD_DIR")); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "viberun-downloads")
+	}
+	return filepath.Join(home, "Downloads")
+}
+
+func runEditCommand(command []string, path string) error {
+	if len(command) == 0 {
+		return fmt.Errorf(`no editor configured; set one with: viberun config --edit-command "code --wait"`)
+	}
+	cmd := exec.Command(command[0], append(command[1:], path)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %s", command[0], strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/shayne/viberun/internal/config"
+)
+
+func TestSetRPCEndpoint(t *testing.T) {
+	var cfg config.RPCConfig
+	for _, name := range []string{"clipboard-copy", "clipboard-paste", "notify", "download", "edit"} {
+		if err := setRPCEndpoint(&cfg, name, true); err != nil {
+			t.Fatalf("enable %s: %v", name, err)
+		}
+	}
+	if !cfg.ClipboardCopy || !cfg.ClipboardPaste || !cfg.Notify || !cfg.Download || !cfg.Edit {
+		t.Fatalf("expected every endpoint enabled, got %+v", cfg)
+	}
+	if err := setRPCEndpoint(&cfg, "notify", false); err != nil || cfg.Notify {
+		t.Fatalf("expected notify disabled, got %+v %v", cfg, err)
+	}
+	if err := setRPCEndpoint(&cfg, "open", false); err == nil {
+		t.Fatalf("expected open to stay enabled")
+	}
+	if err := setRPCEndpoint(&cfg, "agent-event", false); err == nil {
+		t.Fatalf("expected agent-event to be set per app")
+	}
+	if err := setRPCEndpoint(&cfg, "shell", true); err == nil {
+		t.Fatalf("expected unknown endpoint to fail")
+	}
+}
+
+func TestRPCHandlerEnablesConfiguredEndpoints(t *testing.T) {
+	cfg := config.Config{RPC: config.RPCConfig{Notify: true, Download: true}}
+	opens := newOpenPolicy(cfg.RPC, "myapp")
+	handler := rpcHandler(cfg, "myapp", opens, nil)
+	if got := strings.Join(handler.Enabled(), ","); got != "open,notify,download,agent-event" {
+		t.Fatalf("unexpected endpoints %q", got)
+	}
+	cfg.Apps = map[string]config.AppConfig{"myapp": {NoAgentNotify: true}}
+	if rpcHandler(cfg, "myapp", opens, nil).AgentEvent != nil {
+		t.Fatalf("expected agent notifications off for myapp")
+	}
+	if rpcHandler(cfg, "other", opens, nil).AgentEvent == nil {
+		t.Fatalf("expected agent notifications on for other apps")
+	}
+}
+
+func TestStartRPCListenerUsesPrivateSocket(t *testing.T) {
+	server, err := startRPCListener(config.Config{}, "myapp", newOpenPolicy(config.RPCConfig{}, "myapp"), nil)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	info, err := os.Stat(server.Path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected a 0600 socket, got %v", info.Mode())
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", server.Path)
+		},
+	}}
+	resp, err := client.Get("http://localhost/v1")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if err := server.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := os.Stat(server.Path); !os.IsNotExist(err) {
+		t.Fatalf("expected the socket to be removed, got %v", err)
+	}
+}
+
+func TestAgentNotification(t *testing.T) {
+	title, body := agentNotification("myapp", "approval", "Claude needs your\npermission to use Bash")
+	if title != "viberun myapp" || body != "Agent needs approval: Claude needs your permission to use Bash" {
+		t.Fatalf("unexpected notification %q %q", title, body)
+	}
+	if _, body := agentNotification("myapp", "done", ""); body != "Agent finished" {
+		t.Fatalf("unexpected notification %q", body)
+	}
+	_, body = agentNotification("myapp", "idle", strings.Repeat("é", 500))
+	if !strings.HasSuffix(body, "…") || len([]rune(body)) > 200 {
+		t.Fatalf("expected truncated message, got %d runes", len([]rune(body)))
+	}
+}
+
+func TestAppleScriptString(t *testing.T) {
+	if got := appleScriptString(`say "hi" \ bye`); got != `"say \"hi\" \\ bye"` {
+		t.Fatalf("unexpected quoting %s", got)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/shayne/viberun/internal/sshcmd"
+	"github.com/shayne/viberun/internal/target"
+)
+
+func runSecretsCommand(resolved target.Resolved, agentProvider string, subcommand string, name string) error {
+	actionArgs := []string{"secrets", subcommand}
+	if name != "" {
+		actionArgs = append(actionArgs, name)
+	}
+	remoteArgs := sshcmd.RemoteArgs(resolved.App, agentProvider, actionArgs, nil)
+	sshArgs := sshcmd.BuildArgs(resolved.Host, remoteArgs, false)
+	cmd := exec.Command("ssh", sshArgs...)
+	cmd.Env = normalizedSshEnv()
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if subcommand == "set" {
+		value, err := readSecretInput(name)
+		if err != nil {
+			return err
+		}
+		// The value travels over stdin so it never appears in argv on either side.
+		cmd.Stdin = bytes.NewReader(value)
+	}
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		return fmt.Errorf("failed to start ssh: %w", err)
+	}
+	return nil
+}
+
+func readSecretInput(name string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprintf(os.Stderr, "Value for %s: ", name)
+		value, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		return secretValue(value)
+	}
+	value, err := io.ReadAll(io.LimitReader(os.Stdin, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return secretValue(value)
+}
+
+func secretValue(raw []byte) ([]byte, error) {
+	value := strings.TrimRight(string(raw), "\r\n")
+	if value == "" {
+		return nil, fmt.Errorf("secret value is empty")
+	}
+	return []byte(value), nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestSecretValueTrimsTrailingNewline(t *testing.T) {
+	value, err := secretValue([]byte("sk_live_123\r\n"))
+	if err != nil {
+		t.Fatalf("secretValue: %v", err)
+	}
+	if string(value) != "sk_live_123" {
+		t.Fatalf("unexpected value %q", value)
+	}
+	if _, err := secretValue([]byte("\n")); err == nil {
+		t.Fatalf("expected empty value error")
+	}
+}
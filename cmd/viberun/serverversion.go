@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shayne/viberun/internal/version"
+)
+
+const serverVersionCacheTTL = 24 * time.Hour
+
+// versionProbe prints `viberun-server version` only when the installed server knows the
+// command, so older servers never see "version" as an app name.
+const versionProbe = `if viberun-server --help 2>&1 | grep -q 'viberun-server version'; then viberun-server version; fi`
+
+type serverVersionCache struct {
+	Info          version.Info `json:"info"`
+	ClientVersion string       `json:"client_version"`
+	CheckedAt     time.Time    `json:"checked_at"`
+}
+
+// serverInfo returns the server build info for host, using a per-host cache. Servers that
+// predate the version command report version "unknown" and no capabilities.
+func serverInfo(host string, refresh bool) (version.Info, error) {
+	path, err := serverVersionCachePath(host)
+	if err != nil {
+		return version.Info{}, err
+	}
+	if !refresh {
+		if cached, ok := readServerVersionCache(path); ok {
+			return cached.Info, nil
+		}
+	}
+	output, err := sshOutput(host, []string{versionProbe})
+	if err != nil {
+		return version.Info{}, err
+	}
+	info, err := parseServerInfo(output)
+	if err != nil {
+		return version.Info{}, err
+	}
+	writeServerVersionCache(path, serverVersionCache{
+		Info:          info,
+		ClientVersion: version.String(),
+		CheckedAt:     time.Now(),
+	})
+	return info, nil
+}
+
+func parseServerInfo(output string) (version.Info, error) {
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return version.Info{Version: "unknown"}, nil
+	}
+	var info version.Info
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		return version.Info{}, fmt.Errorf("unexpected version response: %w", err)
+	}
+	if strings.TrimSpace(info.Version) == "" {
+		info.Version = "unknown"
+	}
+	return info, nil
+}
+
+// requireServerCapability fails with an upgrade hint when the host's server lacks a
+// capability. A cached answer is rechecked once before failing, in case the server was
+// upgraded since.
+func requireServerCapability(host string, capability string) error {
+	info, err := serverInfo(host, false)
+	if err != nil {
+		return err
+	}
+	if info.Has(capability) {
+		return nil
+	}
+	info, err = serverInfo(host, true)
+	if err != nil {
+		return err
+	}
+	if info.Has(capability) {
+		return nil
+	}
+	return serverTooOldError{Server: info.Version, Capability: capability}
+}
+
+// serverTooOldError reports a server that lacks a capability the client needs.
+type serverTooOldError struct {
+	Server     string
+	Capability string
+}
+
+func (e serverTooOldError) Error() string {
+	return fmt.Sprintf("server is %s, client needs %s; run `viberun bootstrap`", e.Server, version.String())
+}
+
+func serverVersionCachePath(host string) (string, error) {
+	cacheHome := os.Getenv("XDG_CACHE_HOME")
+	if cacheHome == "" {
+		var err error
+		cacheHome, err = os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(cacheHome, "viberun", "servers", safeFileName(host)+".json"), nil
+}
+
+// safeFileName replaces characters that are awkward in file names, such as the colon and
+// slash in ssh targets.
+func safeFileName(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		default:
+			return '_'
+		}
+	}, value)
+}
+
+func readServerVersionCache(path string) (serverVersionCache, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return serverVersionCache{}, false
+	}
+	var cached serverVersionCache
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return serverVersionCache{}, false
+	}
+	if cached.ClientVersion != version.String() || time.Since(cached.CheckedAt) > serverVersionCacheTTL {
+		return serverVersionCache{}, false
+	}
+	return cached, true
+}
+
+func writeServerVersionCache(path string, cached serverVersionCache) {
+	data, err := json.MarshalIndent(cached, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, data, 0o644)
+}
+
+// forgetServerVersion drops the cached server info for host, e.g. after bootstrap.
+func forgetServerVersion(host string) {
+	path, err := serverVersionCachePath(host)
+	if err != nil {
+		return
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "warning: failed to clear server version cache: %v\n", err)
+	}
+}
+
+// bootstrapTargetVersion is the server version bootstrap installs: VIBERUN_SERVER_VERSION
+// when set, otherwise the client's own version for release builds and "latest" for dev builds.
+func bootstrapTargetVersion() string {
+	if value := strings.TrimSpace(os.Getenv("VIBERUN_SERVER_VERSION")); value != "" {
+		return value
+	}
+	if version.IsDev() {
+		return "latest"
+	}
+	return version.String()
+}
+
+// serverAtVersion reports whether info already matches target, so bootstrap can skip the
+// download. "latest" never matches because it cannot be compared locally.
+func serverAtVersion(info version.Info, target string) bool {
+	if target == "" || target == "latest" || info.Version == "unknown" || info.Version == "dev" {
+		return false
+	}
+	return strings.TrimPrefix(info.Version, "v") == strings.TrimPrefix(target, "v")
+}
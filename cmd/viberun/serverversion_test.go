@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shayne/viberun/internal/version"
+)
+
+func TestParseServerInfo(t *testing.T) {
+	info, err := parseServerInfo(`{"version":"v0.4.0","capabilities":["version","auth"]}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if info.Version != "v0.4.0" || !info.Has(version.CapabilityAuth) {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	info, err = parseServerInfo("")
+	if err != nil {
+		t.Fatalf("parse legacy: %v", err)
+	}
+	if info.Version != "unknown" || len(info.Capabilities) != 0 {
+		t.Fatalf("expected unknown legacy server, got %+v", info)
+	}
+}
+
+func TestServerVersionCacheRoundTrip(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	path, err := serverVersionCachePath("root@10.0.0.5")
+	if err != nil {
+		t.Fatalf("cache path: %v", err)
+	}
+	if !strings.HasSuffix(path, "root@10.0.0.5.json") {
+		t.Fatalf("unexpected cache path: %s", path)
+	}
+	writeServerVersionCache(path, serverVersionCache{
+		Info:          version.Info{Version: "v0.4.0"},
+		ClientVersion: version.String(),
+		CheckedAt:     time.Now(),
+	})
+	cached, ok := readServerVersionCache(path)
+	if !ok || cached.Info.Version != "v0.4.0" {
+		t.Fatalf("expected cached server info, got %+v %v", cached, ok)
+	}
+
+	writeServerVersionCache(path, serverVersionCache{
+		Info:          version.Info{Version: "v0.4.0"},
+		ClientVersion: version.String(),
+		CheckedAt:     time.Now().Add(-2 * serverVersionCacheTTL),
+	})
+	if _, ok := readServerVersionCache(path); ok {
+		t.Fatalf("expected stale cache to be ignored")
+	}
+
+	writeServerVersionCache(path, serverVersionCache{
+		Info:          version.Info{Version: "v0.4.0"},
+		ClientVersion: "v0.0.1",
+		CheckedAt:     time.Now(),
+	})
+	if _, ok := readServerVersionCache(path); ok {
+		t.Fatalf("expected cache from another client version to be ignored")
+	}
+
+	forgetServerVersion("root@10.0.0.5")
+	if _, ok := readServerVersionCache(path); ok {
+		t.Fatalf("expected cache to be removed")
+	}
+}
+
+func TestServerAtVersion(t *testing.T) {
+	if !serverAtVersion(version.Info{Version: "v0.4.0"}, "0.4.0") {
+		t.Fatalf("expected v0.4.0 to match 0.4.0")
+	}
+	if serverAtVersion(version.Info{Version: "v0.4.0"}, "latest") {
+		t.Fatalf("latest should never match")
+	}
+	if serverAtVersion(version.Info{Version: "unknown"}, "v0.4.0") {
+		t.Fatalf("unknown should never match")
+	}
+}
+
+func TestBootstrapTargetVersion(t *testing.T) {
+	original := version.Version
+	t.Cleanup(func() { version.Version = original })
+
+	t.Setenv("VIBERUN_SERVER_VERSION", "")
+	version.Version = "dev"
+	if got := bootstrapTargetVersion(); got != "latest" {
+		t.Fatalf("expected latest for dev builds, got %q", got)
+	}
+	version.Version = "v0.5.0"
+	if got := bootstrapTargetVersion(); got != "v0.5.0" {
+		t.Fatalf("expected client version, got %q", got)
+	}
+	t.Setenv("VIBERUN_SERVER_VERSION", "v0.3.0")
+	if got := bootstrapTargetVersion(); got != "v0.3.0" {
+		t.Fatalf("expected env override, got %q", got)
+	}
+}
+
+func TestRequiredCapability(t *testing.T) {
+	if got := requiredCapability("auth", runFlags{}); got != version.CapabilityAuth {
+		t.Fatalf("unexpected auth capability: %q", got)
+	}
+	if got := requiredCapability("auth", runFlags{DryRun: true}); got != version.CapabilityAuthDry {
+		t.Fatalf("unexpected dry-run capability: %q", got)
+	}
+	if got := requiredCapability("snapshot", runFlags{}); got != "" {
+		t.Fatalf("unexpected snapshot capability: %q", got)
+	}
+}
+
+func TestServerTooOldError(t *testing.T) {
+	var err error = serverTooOldError{Server: "v1.0.0", Capability: version.CapabilityAuthStage}
+	var tooOld serverTooOldError
+	if !errors.As(err, &tooOld) || tooOld.Capability != version.CapabilityAuthStage {
+		t.Fatalf("expected serverTooOldError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "server is v1.0.0") || !strings.Contains(err.Error(), "viberun bootstrap") {
+		t.Fatalf("unexpected message: %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+package agents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultProvider is used when no provider is configured.
+const DefaultProvider = "codex"
+
+const (
+	// EnvFormatJSON merges env values into the "env" object of a JSON settings file.
+	EnvFormatJSON = "json-env"
+	// EnvFormatDotEnv merges env values into a KEY=VALUE file.
+	EnvFormatDotEnv = "dotenv"
+)
+
+// Provider describes how to run an agent and how its credentials are discovered and applied.
+type Provider struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+	// Command starts an interactive agent session inside the container.
+	Command []string `json:"command"`
+	// Exec runs the agent non-interactively; the prompt is appended as the final argument.
+	Exec []string `json:"exec,omitempty"`
+	Auth Auth     `json:"auth,omitempty"`
+}
+
+// Auth lists the local credentials for a provider and where they go in the container.
+type Auth struct {
+	Files     []AuthFile `json:"files,omitempty"`
+	Env       []string   `json:"env,omitempty"`
+	EnvTarget *EnvTarget `json:"env_target,omitempty"`
+}
+
+// AuthFile is a local credential file that is copied into the container.
+type AuthFile struct {
+	// Path is the default local path; a leading "~/" expands to the home directory.
+	Path string `json:"path,omitempty"`
+	// DirEnv names an env var holding a directory that replaces the directory of Path.
+	DirEnv string `json:"dir_env,omitempty"`
+	// PathEnv names an env var holding the full local path; it takes precedence over Path.
+	PathEnv       string `json:"path_env,omitempty"`
+	ContainerPath string `json:"container_path"`
+	Mode          int    `json:"mode,omitempty"`
+	// SetEnv names an env var that is set to ContainerPath when the file is found.
+	SetEnv string `json:"set_env,omitempty"`
+}
+
+// EnvTarget describes the container file that discovered env values are merged into.
+type EnvTarget struct {
+	Format string `json:"format"`
+	Path   string `json:"path"`
+}
+
+// Registry resolves provider names and aliases to definitions.
+type Registry struct {
+	providers map[string]Provider
+	aliases   map[string]string
+}
+
+// Builtin returns a registry with only the built-in providers.
+func Builtin() *Registry {
+	reg := &Registry{
+		providers: map[string]Provider{},
+		aliases:   map[string]string{},
+	}
+	for _, provider := range builtinProviders() {
+		if err := reg.Add(provider); err != nil {
+			panic(err)
+		}
+	}
+	return reg
+}
+
+// Load returns the built-in providers overlaid with host and user definitions.
+func Load() (*Registry, error) {
+	dirs := []string{"/etc/viberun/agents"}
+	if dir, err := userDir(); err == nil {
+		dirs = append(dirs, dir)
+	}
+	return LoadFrom(dirs...)
+}
+
+// LoadFrom returns the built-in providers overlaid with the *.json definitions in dirs.
+// Later directories override earlier ones.
+func LoadFrom(dirs ...string) (*Registry, error) {
+	reg := Builtin()
+	for _, dir := range dirs {
+		if strings.TrimSpace(dir) == "" {
+			continue
+		}
+		paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			provider, err := readProvider(path)
+			if err != nil {
+				return nil, err
+			}
+			if err := reg.Add(provider); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+	return reg, nil
+}
+
+// Add registers a provider, replacing any existing provider with the same name.
+func (r *Registry) Add(provider Provider) error {
+	name := normalize(provider.Name)
+	if name == "" {
+		return errors.New("provider name is required")
+	}
+	if len(provider.Command) == 0 {
+		return fmt.Errorf("provider %q has no command", provider.Name)
+	}
+	if target := provider.Auth.EnvTarget; target != nil {
+		switch target.Format {
+		case EnvFormatJSON, EnvFormatDotEnv:
+		default:
+			return fmt.Errorf("provider %q has unsupported env_target format %q", provider.Name, target.Format)
+		}
+		if strings.TrimSpace(target.Path) == "" {
+			return fmt.Errorf("provider %q env_target requires a path", provider.Name)
+		}
+	}
+	for _, file := range provider.Auth.Files {
+		if strings.TrimSpace(file.ContainerPath) == "" {
+			return fmt.Errorf("provider %q has an auth file without container_path", provider.Name)
+		}
+		if strings.TrimSpace(file.Path) == "" && strings.TrimSpace(file.PathEnv) == "" {
+			return fmt.Errorf("provider %q has an auth file without path or path_env", provider.Name)
+		}
+	}
+	if existing, ok := r.providers[name]; ok {
+		for _, alias := range existing.Aliases {
+			delete(r.aliases, normalize(alias))
+		}
+	}
+	provider.Name = name
+	r.providers[name] = provider
+	for _, alias := range provider.Aliases {
+		if key := normalize(alias); key != "" && key != name {
+			r.aliases[key] = name
+		}
+	}
+	return nil
+}
+
+// Lookup resolves a provider by name or alias. An empty name resolves to DefaultProvider.
+func (r *Registry) Lookup(name string) (Provider, bool) {
+	key := normalize(name)
+	if key == "" {
+		key = DefaultProvider
+	}
+	if provider, ok := r.providers[key]; ok {
+		return provider, true
+	}
+	if canonical, ok := r.aliases[key]; ok {
+		provider, ok := r.providers[canonical]
+		return provider, ok
+	}
+	return Provider{}, false
+}
+
+// ExecCommand returns the provider's non-interactive command with prompt as its final argument.
+func (p Provider) ExecCommand(prompt string) ([]string, error) {
+	if len(p.Exec) == 0 {
+		return nil, fmt.Errorf("provider %q has no exec command for non-interactive runs", p.Name)
+	}
+	return append(append([]string{}, p.Exec...), prompt), nil
+}
+
+// Names returns the registered provider names in sorted order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func builtinProviders() []Provider {
+	return []Provider{
+		{
+			Name:    "codex",
+			Command: []string{"codex"},
+			Exec:    []string{"codex", "exec"},
+			Auth: Auth{
+				Files: []AuthFile{
+					{
+						Path:          "~/.codex/auth.json",
+						DirEnv:        "CODEX_HOME",
+						ContainerPath: "/root/.codex/auth.json",
+						Mode:          0o600,
+					},
+				},
+			},
+		},
+		{
+			Name:    "claude",
+			Aliases: []string{"claude-code"},
+			Command: []string{"claude"},
+			Exec:    []string{"claude", "-p"},
+			Auth: Auth{
+				Files: []AuthFile{
+					{
+						Path:          "~/.claude/.credentials.json",
+						DirEnv:        "CLAUDE_CONFIG_DIR",
+						ContainerPath: "/root/.claude/.credentials.json",
+						Mode:          0o600,
+					},
+				},
+				Env: []string{"ANTHROPIC_API_KEY", "ANTHROPIC_AUTH_TOKEN"},
+				EnvTarget: &EnvTarget{
+					Format: EnvFormatJSON,
+					Path:   "/root/.claude/settings.json",
+				},
+			},
+		},
+		{
+			Name:    "gemini",
+			Command: []string{"gemini"},
+			Exec:    []string{"gemini", "-p"},
+			Auth: Auth{
+				Files: []AuthFile{
+					{
+						Path:          "~/.gemini/oauth_creds.json",
+						ContainerPath: "/root/.gemini/oauth_creds.json",
+						Mode:          0o600,
+					},
+					{
+						Path:          "~/.gemini/google_accounts.json",
+						ContainerPath: "/root/.gemini/google_accounts.json",
+						Mode:          0o600,
+					},
+					{
+						Path:          "~/.config/gcloud/application_default_credentials.json",
+						DirEnv:        "CLOUDSDK_CONFIG",
+						PathEnv:       "GOOGLE_APPLICATION_CREDENTIALS",
+						ContainerPath: "/root/.config/gcloud/application_default_credentials.json",
+						Mode:          0o600,
+						SetEnv:        "GOOGLE_APPLICATION_CREDENTIALS",
+					},
+				},
+				Env: []string{"GEMINI_API_KEY", "GOOGLE_API_KEY"},
+				EnvTarget: &EnvTarget{
+					Format: EnvFormatDotEnv,
+					Path:   "/root/.env",
+				},
+			},
+		},
+	}
+}
+
+func readProvider(path string) (Provider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Provider{}, err
+	}
+	var provider Provider
+	if err := json.Unmarshal(data, &provider); err != nil {
+		return Provider{}, fmt.Errorf("invalid provider definition %s: %w", path, err)
+	}
+	return provider, nil
+}
+
+func userDir() (string, error) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		var err error
+		configHome, err = os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return filepath.Join(configHome, "viberun", "agents"), nil
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
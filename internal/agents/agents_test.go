@@ -0,0 +1,102 @@
+package agents
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuiltinLookup(t *testing.T) {
+	reg := Builtin()
+	provider, ok := reg.Lookup("")
+	if !ok || provider.Name != DefaultProvider {
+		t.Fatalf("expected default provider %s, got %q (ok=%v)", DefaultProvider, provider.Name, ok)
+	}
+	provider, ok = reg.Lookup("Claude-Code")
+	if !ok || provider.Name != "claude" {
+		t.Fatalf("expected claude alias lookup, got %q (ok=%v)", provider.Name, ok)
+	}
+	if provider.Auth.EnvTarget == nil || provider.Auth.EnvTarget.Format != EnvFormatJSON {
+		t.Fatalf("expected claude json env target")
+	}
+	if _, ok := reg.Lookup("missing"); ok {
+		t.Fatalf("expected missing provider lookup to fail")
+	}
+}
+
+func TestLoadFromAddsAndOverridesProviders(t *testing.T) {
+	dir := t.TempDir()
+	aider := `{
+  "name": "aider",
+  "command": ["viberun-agent", "aider"],
+  "exec": ["aider", "--message"],
+  "auth": {
+    "env": ["OPENAI_API_KEY"],
+    "env_target": {"format": "dotenv", "path": "/root/.aider.env"}
+  }
+}`
+	if err := os.WriteFile(filepath.Join(dir, "aider.json"), []byte(aider), 0o644); err != nil {
+		t.Fatalf("write aider: %v", err)
+	}
+	codex := `{"name": "codex", "aliases": ["oai"], "command": ["codex", "--profile", "work"]}`
+	if err := os.WriteFile(filepath.Join(dir, "codex.json"), []byte(codex), 0o644); err != nil {
+		t.Fatalf("write codex: %v", err)
+	}
+
+	reg, err := LoadFrom(filepath.Join(dir, "missing"), dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	provider, ok := reg.Lookup("aider")
+	if !ok {
+		t.Fatalf("expected aider provider")
+	}
+	if len(provider.Command) != 2 || provider.Command[1] != "aider" {
+		t.Fatalf("unexpected aider command: %v", provider.Command)
+	}
+	if provider.Auth.EnvTarget == nil || provider.Auth.EnvTarget.Path != "/root/.aider.env" {
+		t.Fatalf("unexpected aider env target: %+v", provider.Auth.EnvTarget)
+	}
+	provider, ok = reg.Lookup("oai")
+	if !ok || provider.Name != "codex" || len(provider.Command) != 3 {
+		t.Fatalf("expected overridden codex via alias, got %+v (ok=%v)", provider, ok)
+	}
+	if _, ok := reg.Lookup("claude"); !ok {
+		t.Fatalf("expected builtins to remain")
+	}
+}
+
+func TestLoadFromRejectsInvalidDefinitions(t *testing.T) {
+	cases := map[string]string{
+		"no-command.json": `{"name": "broken"}`,
+		"bad-format.json": `{"name": "broken", "command": ["x"], "auth": {"env_target": {"format": "yaml", "path": "/x"}}}`,
+		"no-path.json":    `{"name": "broken", "command": ["x"], "auth": {"files": [{"container_path": "/x"}]}}`,
+		"bad-json.json":   `{"name": `,
+	}
+	for name, body := range cases {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		if _, err := LoadFrom(dir); err == nil {
+			t.Fatalf("expected error for %s", name)
+		}
+	}
+}
+
+func TestExecCommand(t *testing.T) {
+	provider, _ := Builtin().Lookup("claude")
+	got, err := provider.ExecCommand("fix the tests")
+	if err != nil {
+		t.Fatalf("exec command: %v", err)
+	}
+	if len(got) != 3 || got[0] != "claude" || got[1] != "-p" || got[2] != "fix the tests" {
+		t.Fatalf("unexpected exec command: %v", got)
+	}
+	if len(provider.Exec) != 2 {
+		t.Fatalf("expected ExecCommand to leave the definition untouched: %v", provider.Exec)
+	}
+	if _, err := (Provider{Name: "bare", Command: []string{"bare"}}).ExecCommand("hi"); err == nil {
+		t.Fatalf("expected error for provider without exec")
+	}
+}
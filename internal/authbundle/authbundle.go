@@ -1,15 +1,149 @@
 package authbundle
 
-// Bundle describes auth data staged on the host and ready to be copied into a container.
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StageTTL bounds how long a staged bundle may wait on the host before it is wiped.
+const StageTTL = 10 * time.Minute
+
+// Bundle describes auth data sent from the client and ready to be copied into a container.
 type Bundle struct {
 	Provider string            `json:"provider"`
 	Files    []File            `json:"files,omitempty"`
 	Env      map[string]string `json:"env,omitempty"`
 }
 
-// File is a host file that should be copied into the container.
+// File is a credential file that should be written into the container.
 type File struct {
-	HostPath      string `json:"host_path"`
 	ContainerPath string `json:"container_path"`
 	Mode          int    `json:"mode,omitempty"`
+	Data          []byte `json:"data"`
+}
+
+// Status reports which of a provider's credential targets are present in a container.
+type Status struct {
+	Provider   string         `json:"provider"`
+	Configured bool           `json:"configured"`
+	Files      []TargetStatus `json:"files,omitempty"`
+	Env        []TargetStatus `json:"env,omitempty"`
+}
+
+// TargetStatus is a single credential file or env key inside a container.
+type TargetStatus struct {
+	Path    string `json:"path"`
+	Key     string `json:"key,omitempty"`
+	Present bool   `json:"present"`
+}
+
+// Write encodes a bundle to w. Bundles travel over the ssh session's stdin so that
+// secrets never appear in argv or the environment.
+func Write(w io.Writer, bundle *Bundle) error {
+	if bundle == nil {
+		return errors.New("missing auth bundle")
+	}
+	return json.NewEncoder(w).Encode(bundle)
+}
+
+// Read decodes a bundle from r.
+func Read(r io.Reader) (*Bundle, error) {
+	var bundle Bundle
+	if err := json.NewDecoder(io.LimitReader(r, 8<<20)).Decode(&bundle); err != nil {
+		return nil, fmt.Errorf("invalid auth bundle: %w", err)
+	}
+	if bundle.Provider == "" {
+		return nil, errors.New("invalid auth bundle: missing provider")
+	}
+	return &bundle, nil
+}
+
+// Stage writes a bundle into dir with owner-only permissions and returns a token for Take.
+func Stage(dir string, bundle *Bundle) (string, error) {
+	if err := ensurePrivateDir(dir); err != nil {
+		return "", err
+	}
+	pruneStaged(dir, time.Now().Add(-StageTTL))
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	file, err := os.OpenFile(stagedPath(dir, token), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	if err := Write(file, bundle); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(file.Name())
+		return "", err
+	}
+	return token, nil
+}
+
+// Take reads and removes a staged bundle. The file is wiped even if it cannot be decoded.
+func Take(dir string, token string) (*Bundle, error) {
+	if !validToken(token) {
+		return nil, errors.New("invalid auth token")
+	}
+	path := stagedPath(dir, token)
+	defer func() {
+		_ = os.Remove(path)
+		pruneStaged(dir, time.Now().Add(-StageTTL))
+	}()
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("staged auth bundle not found (expired or already used)")
+		}
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+func ensurePrivateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	return os.Chmod(dir, 0o700)
+}
+
+func pruneStaged(dir string, cutoff time.Time) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Before(cutoff) {
+			_ = os.Remove(path)
+		}
+	}
+}
+
+func stagedPath(dir string, token string) string {
+	return filepath.Join(dir, token+".json")
+}
+
+func validToken(token string) bool {
+	if len(token) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(token)
+	return err == nil
 }
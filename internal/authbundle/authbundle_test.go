@@ -0,0 +1,103 @@
+package authbundle
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteRead(t *testing.T) {
+	bundle := &Bundle{
+		Provider: "codex",
+		Files:    []File{{ContainerPath: "/root/.codex/auth.json", Mode: 0o600, Data: []byte(`{"token":"x"}`)}},
+		Env:      map[string]string{"KEY": "value"},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, bundle); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got.Provider != "codex" || string(got.Files[0].Data) != `{"token":"x"}` || got.Env["KEY"] != "value" {
+		t.Fatalf("unexpected bundle: %+v", got)
+	}
+	if _, err := Read(bytes.NewBufferString(`{"files":[]}`)); err == nil {
+		t.Fatalf("expected error for bundle without provider")
+	}
+}
+
+func TestStageTakeIsPrivateAndSingleUse(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "auth")
+	token, err := Stage(dir, &Bundle{Provider: "claude", Env: map[string]string{"ANTHROPIC_API_KEY": "secret"}})
+	if err != nil {
+		t.Fatalf("stage: %v", err)
+	}
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("stat dir: %v", err)
+	}
+	if dirInfo.Mode().Perm() != 0o700 {
+		t.Fatalf("expected 0700 staging dir, got %v", dirInfo.Mode().Perm())
+	}
+	fileInfo, err := os.Stat(filepath.Join(dir, token+".json"))
+	if err != nil {
+		t.Fatalf("stat staged: %v", err)
+	}
+	if fileInfo.Mode().Perm() != 0o600 {
+		t.Fatalf("expected 0600 staged file, got %v", fileInfo.Mode().Perm())
+	}
+
+	bundle, err := Take(dir, token)
+	if err != nil {
+		t.Fatalf("take: %v", err)
+	}
+	if bundle.Env["ANTHROPIC_API_KEY"] != "secret" {
+		t.Fatalf("unexpected bundle: %+v", bundle)
+	}
+	if _, err := os.Stat(filepath.Join(dir, token+".json")); !os.IsNotExist(err) {
+		t.Fatalf("expected staged bundle to be wiped, got %v", err)
+	}
+	if _, err := Take(dir, token); err == nil {
+		t.Fatalf("expected second take to fail")
+	}
+}
+
+func TestTakeWipesInvalidBundle(t *testing.T) {
+	dir := t.TempDir()
+	token := "0123456789abcdef0123456789abcdef"
+	path := filepath.Join(dir, token+".json")
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Take(dir, token); err == nil {
+		t.Fatalf("expected decode error")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected invalid bundle to be wiped, got %v", err)
+	}
+	if _, err := Take(dir, "../../etc/passwd"); err == nil {
+		t.Fatalf("expected invalid token error")
+	}
+}
+
+func TestStagePrunesExpiredBundles(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "ffffffffffffffffffffffffffffffff.json")
+	if err := os.WriteFile(stale, []byte("{}"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	old := time.Now().Add(-2 * StageTTL)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if _, err := Stage(dir, &Bundle{Provider: "codex"}); err != nil {
+		t.Fatalf("stage: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("expected stale bundle to be pruned, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package authbundle
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// freshnessKeys are the JSON fields agents use to record token expiry or refresh time.
+var freshnessKeys = map[string]bool{
+	"expiresAt":    true,
+	"expires_at":   true,
+	"expiry_date":  true,
+	"expiry":       true,
+	"last_refresh": true,
+	"lastRefresh":  true,
+}
+
+// Freshness returns the latest expiry or refresh timestamp found in a credential file.
+// Numeric values are treated as milliseconds when they are too large to be seconds.
+func Freshness(data []byte) (time.Time, bool) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return time.Time{}, false
+	}
+	var latest time.Time
+	found := false
+	walkFreshness(doc, func(ts time.Time) {
+		if !found || ts.After(latest) {
+			latest = ts
+			found = true
+		}
+	})
+	return latest, found
+}
+
+// Compare reports whether candidate is strictly fresher than current. ok is false when
+// either side has no recognizable timestamp.
+func Compare(current []byte, candidate []byte) (newer bool, ok bool) {
+	currentTime, currentOK := Freshness(current)
+	candidateTime, candidateOK := Freshness(candidate)
+	if !currentOK || !candidateOK {
+		return false, false
+	}
+	return candidateTime.After(currentTime), true
+}
+
+func walkFreshness(value any, visit func(time.Time)) {
+	switch typed := value.(type) {
+	case map[string]any:
+		for key, child := range typed {
+			if freshnessKeys[key] {
+				if ts, ok := parseTimestamp(child); ok {
+					visit(ts)
+					continue
+				}
+			}
+			walkFreshness(child, visit)
+		}
+	case []any:
+		for _, child := range typed {
+			walkFreshness(child, visit)
+		}
+	}
+}
+
+func parseTimestamp(value any) (time.Time, bool) {
+	switch typed := value.(type) {
+	case float64:
+		if typed <= 0 {
+			return time.Time{}, false
+		}
+		if typed > 1e12 {
+			return time.UnixMilli(int64(typed)), true
+		}
+		return time.Unix(int64(typed), 0), true
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, time.RFC3339} {
+			if ts, err := time.Parse(layout, typed); err == nil {
+				return ts, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
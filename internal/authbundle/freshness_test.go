@@ -0,0 +1,47 @@
+package authbundle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFreshnessKnownFormats(t *testing.T) {
+	cases := map[string]time.Time{
+		`{"claudeAiOauth":{"accessToken":"x","expiresAt":1767225600000}}`:         time.UnixMilli(1767225600000),
+		`{"access_token":"x","expiry_date":1767225600000}`:                        time.UnixMilli(1767225600000),
+		`{"tokens":{"id_token":"x"},"last_refresh":"2026-01-01T00:00:00Z"}`:       time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		`{"expires_at":1767225600}`:                                               time.Unix(1767225600, 0),
+		`[{"expiry":"2026-01-01T00:00:00.5Z"},{"expiry":"2025-01-01T00:00:00Z"}]`: time.Date(2026, 1, 1, 0, 0, 0, 500000000, time.UTC),
+	}
+	for input, want := range cases {
+		got, ok := Freshness([]byte(input))
+		if !ok {
+			t.Fatalf("expected timestamp in %s", input)
+		}
+		if !got.Equal(want) {
+			t.Fatalf("Freshness(%s)=%v want %v", input, got, want)
+		}
+	}
+	for _, input := range []string{`{"token":"x"}`, `not json`, `{"expiresAt":"soon"}`} {
+		if _, ok := Freshness([]byte(input)); ok {
+			t.Fatalf("expected no timestamp in %s", input)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	older := []byte(`{"expiresAt":1767225600000}`)
+	newer := []byte(`{"expiresAt":1767229200000}`)
+	if fresher, ok := Compare(older, newer); !ok || !fresher {
+		t.Fatalf("expected newer candidate to win")
+	}
+	if fresher, ok := Compare(newer, older); !ok || fresher {
+		t.Fatalf("expected older candidate to lose")
+	}
+	if fresher, ok := Compare(newer, newer); !ok || fresher {
+		t.Fatalf("expected equal timestamps to not be fresher")
+	}
+	if _, ok := Compare([]byte(`{}`), newer); ok {
+		t.Fatalf("expected comparison without timestamp to be inconclusive")
+	}
+}
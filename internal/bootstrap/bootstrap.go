@@ -0,0 +1,574 @@
+package bootstrap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shayne/viberun/internal/engine"
+)
+
+const (
+	DefaultInstallPath      = "/usr/local/bin/viberun-server"
+	DefaultRecordPath       = "/var/lib/viberun/bootstrap.json"
+	DefaultDockerInstallURL = "https://get.docker.com"
+	LocalImage              = "viberun:latest"
+)
+
+// Status is the state a step reports.
+type Status string
+
+const (
+	StatusStart   Status = "start"
+	StatusOK      Status = "ok"
+	StatusChanged Status = "changed"
+	StatusDrift   Status = "drift"
+	StatusFailed  Status = "failed"
+	StatusDone    Status = "done"
+)
+
+// ErrDrift is returned in check mode when at least one step is out of date.
+var ErrDrift = errors.New("host has drifted from the bootstrap configuration")
+
+// Event is one line of bootstrap progress, printed as JSON for the client to render.
+type Event struct {
+	Step    string   `json:"step,omitempty"`
+	Title   string   `json:"title,omitempty"`
+	Status  Status   `json:"status"`
+	Detail  string   `json:"detail,omitempty"`
+	Changes []string `json:"changes,omitempty"`
+}
+
+// Commander runs host commands and returns their combined output.
+type Commander interface {
+	Run(stdin io.Reader, name string, args ...string) ([]byte, error)
+}
+
+type execCommander struct{}
+
+func (execCommander) Run(stdin io.Reader, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = stdin
+	return cmd.CombinedOutput()
+}
+
+// Options configures a bootstrap run. Zero values fall back to the host defaults.
+type Options struct {
+	// Check reports drift without changing anything.
+	Check bool
+	// Image is pulled and tagged as viberun:latest unless SkipImagePull is set.
+	Image         string
+	SkipImagePull bool
+	// ImageArchive is a `docker save` tarball on the host that provides Image instead of a pull.
+	ImageArchive string
+	// Offline fails steps that would download from the network instead of running them.
+	Offline bool
+	// ExistingDocker requires docker to be installed and running already and never changes
+	// it. Hosts outside the compatibility matrix are accepted in this mode.
+	ExistingDocker bool
+	// Runtime is the container engine to set up: docker (default) or podman, which runs
+	// rootless as User.
+	Runtime          string
+	EngineConfigPath string
+	SubUIDPath       string
+	SubGIDPath       string
+	// SourceBinary is the viberun-server to install; it defaults to the running binary.
+	SourceBinary     string
+	InstallPath      string
+	OSReleasePath    string
+	RecordPath       string
+	DockerInstallURL string
+	// User is added to the docker group; empty or root skips the step.
+	User       string
+	Exec       Commander
+	LookPath   func(string) (string, error)
+	HTTPClient *http.Client
+}
+
+// Record is written after a run that changed the host.
+type Record struct {
+	Time    time.Time `json:"time"`
+	Changes []string  `json:"changes"`
+}
+
+type step struct {
+	name  string
+	title string
+	// check reports whether the host is already in the desired state.
+	check func() (bool, string, error)
+	// apply changes the host; nil means drift cannot be fixed automatically.
+	apply func() (string, error)
+}
+
+// Run executes every step in order, emitting events as it goes. A failing step stops the
+// run, since later steps depend on earlier ones.
+func Run(opts Options, emit func(Event)) error {
+	opts = withDefaults(opts)
+	changes := []string{}
+	drift := 0
+	for _, s := range steps(opts) {
+		emit(Event{Step: s.name, Title: s.title, Status: StatusStart})
+		ok, detail, err := s.check()
+		if err != nil {
+			emit(Event{Step: s.name, Status: StatusFailed, Detail: err.Error()})
+			return fmt.Errorf("%s: %w", s.title, err)
+		}
+		if ok {
+			emit(Event{Step: s.name, Status: StatusOK, Detail: detail})
+			continue
+		}
+		if opts.Check {
+			drift++
+			emit(Event{Step: s.name, Status: StatusDrift, Detail: detail})
+			continue
+		}
+		if s.apply == nil {
+			emit(Event{Step: s.name, Status: StatusFailed, Detail: detail})
+			return fmt.Errorf("%s: %s", s.title, detail)
+		}
+		changed, err := s.apply()
+		if err != nil {
+			emit(Event{Step: s.name, Status: StatusFailed, Detail: err.Error()})
+			return fmt.Errorf("%s: %w", s.title, err)
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s", s.name, changed))
+		emit(Event{Step: s.name, Status: StatusChanged, Detail: changed})
+	}
+	emit(Event{Status: StatusDone, Changes: changes})
+	if opts.Check {
+		if drift > 0 {
+			return ErrDrift
+		}
+		return nil
+	}
+	if len(changes) > 0 {
+		if err := writeRecord(opts.RecordPath, Record{Time: time.Now().UTC(), Changes: changes}); err != nil {
+			return fmt.Errorf("failed to record bootstrap changes: %w", err)
+		}
+	}
+	return nil
+}
+
+func withDefaults(opts Options) Options {
+	if opts.Exec == nil {
+		opts.Exec = execCommander{}
+	}
+	if opts.LookPath == nil {
+		opts.LookPath = exec.LookPath
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 2 * time.Minute}
+	}
+	if opts.InstallPath == "" {
+		opts.InstallPath = DefaultInstallPath
+	}
+	if opts.OSReleasePath == "" {
+		opts.OSReleasePath = "/etc/os-release"
+	}
+	if opts.RecordPath == "" {
+		opts.RecordPath = DefaultRecordPath
+	}
+	if opts.DockerInstallURL == "" {
+		opts.DockerInstallURL = DefaultDockerInstallURL
+	}
+	if opts.Runtime == "" {
+		opts.Runtime = engine.Docker
+	}
+	if opts.EngineConfigPath == "" {
+		opts.EngineConfigPath = engine.ConfigPath
+	}
+	if opts.SubUIDPath == "" {
+		opts.SubUIDPath = "/etc/subuid"
+	}
+	if opts.SubGIDPath == "" {
+		opts.SubGIDPath = "/etc/subgid"
+	}
+	if opts.SourceBinary == "" {
+		if path, err := os.Executable(); err == nil {
+			opts.SourceBinary = path
+		}
+	}
+	return opts
+}
+
+// hostInfo carries what earlier steps learned to later ones.
+type hostInfo struct {
+	distro Distro
+}
+
+func steps(opts Options) []step {
+	host := &hostInfo{}
+	if opts.Runtime == engine.Podman {
+		return []step{
+			osStep(opts, host),
+			podmanStep(opts, host),
+			podmanUserStep(opts),
+			runtimeStep(opts),
+			imageStep(opts),
+			binaryStep(opts),
+		}
+	}
+	return []step{
+		osStep(opts, host),
+		dockerStep(opts, host),
+		dockerServiceStep(opts, host),
+		dockerGroupStep(opts),
+		runtimeStep(opts),
+		imageStep(opts),
+		binaryStep(opts),
+	}
+}
+
+func osStep(opts Options, host *hostInfo) step {
+	return step{
+		name:  "os",
+		title: "Check OS",
+		check: func() (bool, string, error) {
+			data, err := os.ReadFile(opts.OSReleasePath)
+			if err != nil {
+				return false, "", fmt.Errorf("missing %s; cannot verify OS", opts.OSReleasePath)
+			}
+			host.distro = DetectDistro(string(data))
+			if reason := host.distro.Unsupported(); reason != "" {
+				if opts.ExistingDocker {
+					return true, host.distro.Name + " (not in the compatibility matrix; using existing docker)", nil
+				}
+				return false, "", errors.New(reason)
+			}
+			support := host.distro.Support
+			return true, fmt.Sprintf("%s (%s, %s)", host.distro.Name, support.Packages, support.Services), nil
+		},
+	}
+}
+
+func dockerStep(opts Options, host *hostInfo) step {
+	s := step{
+		name:  "docker",
+		title: "Install docker",
+		check: func() (bool, string, error) {
+			if _, err := opts.LookPath("docker"); err != nil {
+				return false, "docker is not installed", nil
+			}
+			out, err := opts.Exec.Run(nil, "docker", "--version")
+			if err != nil {
+				return false, "docker is not working: " + tail(out, err), nil
+			}
+			return true, strings.TrimSpace(string(out)), nil
+		},
+		apply: func() (string, error) {
+			if opts.Offline {
+				return "", errors.New("docker is not installed; install it before bootstrapping offline")
+			}
+			support := host.distro.Support
+			if support.DockerInstall == nil {
+				script, err := fetch(opts.HTTPClient, opts.DockerInstallURL)
+				if err != nil {
+					return "", fmt.Errorf("failed to download docker installer: %w", err)
+				}
+				if out, err := opts.Exec.Run(bytes.NewReader(script), "sh"); err != nil {
+					return "", fmt.Errorf("docker install failed: %s", tail(out, err))
+				}
+				return "installed docker", nil
+			}
+			for _, command := range support.DockerInstall {
+				if out, err := opts.Exec.Run(nil, command[0], command[1:]...); err != nil {
+					return "", fmt.Errorf("docker install failed: %s", tail(out, err))
+				}
+			}
+			return "installed docker with " + support.Packages, nil
+		},
+	}
+	if opts.ExistingDocker {
+		s.apply = nil
+	}
+	return s
+}
+
+func dockerServiceStep(opts Options, host *hostInfo) step {
+	s := step{
+		name:  "docker-service",
+		title: "Start docker",
+		check: func() (bool, string, error) {
+			if opts.ExistingDocker {
+				if out, err := opts.Exec.Run(nil, "docker", "info", "--format", "{{.ServerVersion}}"); err != nil {
+					return false, "docker is not running: " + tail(out, err), nil
+				}
+				return true, "running; left unchanged", nil
+			}
+			if host.distro.Support.Services == ServicesOpenRC {
+				out, _ := opts.Exec.Run(nil, "rc-update", "show", "default")
+				enabled := false
+				for _, line := range strings.Split(string(out), "\n") {
+					name, _, _ := strings.Cut(strings.TrimSpace(line), " ")
+					if name == "docker" {
+						enabled = true
+					}
+				}
+				_, err := opts.Exec.Run(nil, "rc-service", "docker", "status")
+				if enabled && err == nil {
+					return true, "enabled and running", nil
+				}
+				return false, "docker service is not enabled and running", nil
+			}
+			if _, err := opts.LookPath("systemctl"); err != nil {
+				return true, "no systemd; skipped", nil
+			}
+			out, _ := opts.Exec.Run(nil, "systemctl", "is-enabled", "docker")
+			enabled := strings.TrimSpace(string(out)) == "enabled"
+			out, _ = opts.Exec.Run(nil, "systemctl", "is-active", "docker")
+			active := strings.TrimSpace(string(out)) == "active"
+			if enabled && active {
+				return true, "enabled and running", nil
+			}
+			return false, "docker service is not enabled and running", nil
+		},
+		apply: func() (string, error) {
+			if host.distro.Support.Services == ServicesOpenRC {
+				if out, err := opts.Exec.Run(nil, "rc-update", "add", "docker", "default"); err != nil {
+					return "", fmt.Errorf("failed to enable docker: %s", tail(out, err))
+				}
+				if out, err := opts.Exec.Run(nil, "rc-service", "docker", "start"); err != nil {
+					return "", fmt.Errorf("failed to start docker: %s", tail(out, err))
+				}
+				return "enabled and started docker", nil
+			}
+			if out, err := opts.Exec.Run(nil, "systemctl", "enable", "--now", "docker"); err != nil {
+				return "", fmt.Errorf("failed to start docker: %s", tail(out, err))
+			}
+			return "enabled and started docker", nil
+		},
+	}
+	if opts.ExistingDocker {
+		s.apply = nil
+	}
+	return s
+}
+
+func dockerGroupStep(opts Options) step {
+	user := strings.TrimSpace(opts.User)
+	return step{
+		name:  "docker-group",
+		title: "Set up docker group",
+		check: func() (bool, string, error) {
+			if user == "" || user == "root" {
+				return true, "running as root; skipped", nil
+			}
+			if _, err := opts.Exec.Run(nil, "getent", "group", "docker"); err != nil {
+				return false, "docker group is missing", nil
+			}
+			out, err := opts.Exec.Run(nil, "id", "-nG", user)
+			if err != nil {
+				return false, "", fmt.Errorf("failed to read groups for %s: %s", user, tail(out, err))
+			}
+			for _, group := range strings.Fields(string(out)) {
+				if group == "docker" {
+					return true, user + " is in the docker group", nil
+				}
+			}
+			return false, user + " is not in the docker group", nil
+		},
+		apply: func() (string, error) {
+			// busybox systems (Alpine) have addgroup instead of groupadd/usermod.
+			_, lookErr := opts.LookPath("usermod")
+			busybox := lookErr != nil
+			if _, err := opts.Exec.Run(nil, "getent", "group", "docker"); err != nil {
+				create := []string{"groupadd", "docker"}
+				if busybox {
+					create = []string{"addgroup", "-S", "docker"}
+				}
+				if out, err := opts.Exec.Run(nil, create[0], create[1:]...); err != nil {
+					return "", fmt.Errorf("failed to create docker group: %s", tail(out, err))
+				}
+			}
+			add := []string{"usermod", "-aG", "docker", user}
+			if busybox {
+				add = []string{"addgroup", user, "docker"}
+			}
+			if out, err := opts.Exec.Run(nil, add[0], add[1:]...); err != nil {
+				return "", fmt.Errorf("failed to add %s to docker group: %s", user, tail(out, err))
+			}
+			return fmt.Sprintf("added %s to docker group; reconnect to apply", user), nil
+		},
+	}
+}
+
+func imageStep(opts Options) step {
+	title := "Pull image"
+	if opts.ImageArchive != "" {
+		title = "Load image"
+	}
+	return step{
+		name:  "image",
+		title: title,
+		check: func() (bool, string, error) {
+			if opts.SkipImagePull {
+				return true, "skipped", nil
+			}
+			if strings.TrimSpace(opts.Image) == "" {
+				return true, "no image configured; skipped", nil
+			}
+			if _, err := opts.LookPath(opts.Runtime); err != nil {
+				return false, opts.Runtime + " is not installed", nil
+			}
+			localID, err := imageID(opts, LocalImage)
+			if err != nil {
+				return false, LocalImage + " is missing", nil
+			}
+			sourceID, err := imageID(opts, opts.Image)
+			if err != nil || sourceID != localID {
+				return false, fmt.Sprintf("%s is not tagged from %s", LocalImage, opts.Image), nil
+			}
+			return true, opts.Image, nil
+		},
+		apply: func() (string, error) {
+			action := "pulled "
+			if opts.ImageArchive != "" {
+				if out, err := runEngine(opts, "load", "-i", opts.ImageArchive); err != nil {
+					return "", fmt.Errorf("failed to load %s: %s", opts.ImageArchive, tail(out, err))
+				}
+				action = "loaded "
+			} else if opts.Offline {
+				return "", fmt.Errorf("cannot pull %s while offline", opts.Image)
+			} else if out, err := runEngine(opts, "pull", opts.Image); err != nil {
+				return "", fmt.Errorf("failed to pull %s: %s", opts.Image, tail(out, err))
+			}
+			if out, err := runEngine(opts, "tag", opts.Image, LocalImage); err != nil {
+				return "", fmt.Errorf("failed to tag %s: %s", opts.Image, tail(out, err))
+			}
+			return action + opts.Image, nil
+		},
+	}
+}
+
+func binaryStep(opts Options) step {
+	return step{
+		name:  "server",
+		title: "Install viberun-server",
+		check: func() (bool, string, error) {
+			if opts.SourceBinary == "" {
+				return false, "", fmt.Errorf("no server binary to install")
+			}
+			want, err := fileDigest(opts.SourceBinary)
+			if err != nil {
+				return false, "", err
+			}
+			have, err := fileDigest(opts.InstallPath)
+			if err != nil {
+				return false, opts.InstallPath + " is missing", nil
+			}
+			if have != want {
+				return false, opts.InstallPath + " differs from the staged binary", nil
+			}
+			return true, opts.InstallPath, nil
+		},
+		apply: func() (string, error) {
+			if err := installFile(opts.SourceBinary, opts.InstallPath, 0o755); err != nil {
+				return "", err
+			}
+			return "installed " + opts.InstallPath, nil
+		},
+	}
+}
+
+// ParseOSRelease returns the ID and PRETTY_NAME fields of /etc/os-release.
+func ParseOSRelease(content string) (string, string) {
+	values := parseOSReleaseValues(content)
+	return strings.ToLower(values["ID"]), values["PRETTY_NAME"]
+}
+
+func imageID(opts Options, image string) (string, error) {
+	out, err := runEngine(opts, "image", "inspect", "-f", "{{.Id}}", image)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func fetch(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func fileDigest(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// installFile copies src to dst through a temp file so dst is replaced atomically.
+func installFile(src string, dst string, mode os.FileMode) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
+
+func writeRecord(path string, record Record) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// tail returns the last lines of command output for an error message.
+func tail(out []byte, err error) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) > 5 {
+		lines = lines[len(lines)-5:]
+	}
+	text := strings.TrimSpace(strings.Join(lines, "\n"))
+	if text == "" {
+		return err.Error()
+	}
+	return text
+}
+
+func fallback(value string, other string) string {
+	if strings.TrimSpace(value) == "" {
+		return other
+	}
+	return value
+}
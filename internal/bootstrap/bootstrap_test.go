@@ -0,0 +1,441 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shayne/viberun/internal/engine"
+)
+
+// fakeHost records commands and models just enough host state for the steps.
+type fakeHost struct {
+	dockerInstalled bool
+	serviceActive   bool
+	groupMembers    []string
+	images          map[string]string
+	commands        []string
+	// busybox hosts have addgroup but no usermod.
+	busybox bool
+	podman  bool
+	linger  bool
+}
+
+func (h *fakeHost) Run(stdin io.Reader, name string, args ...string) ([]byte, error) {
+	command := strings.TrimSpace(name + " " + strings.Join(args, " "))
+	h.commands = append(h.commands, command)
+	fail := errors.New("exit status 1")
+	if name == "runuser" && len(args) > 3 {
+		// Image commands run as the user behave like their docker equivalents here.
+		name, args = "docker", args[4:]
+		command = strings.TrimSpace(name + " " + strings.Join(args, " "))
+	}
+	switch {
+	case command == "podman --version":
+		return []byte("podman version 5.0.0"), nil
+	case command == "apt-get update":
+		return nil, nil
+	case command == "apt-get install -y podman uidmap":
+		h.podman = true
+		return nil, nil
+	case strings.HasPrefix(command, "loginctl show-user "):
+		if h.linger {
+			return []byte("Linger=yes\n"), nil
+		}
+		return []byte("Linger=no\n"), nil
+	case strings.HasPrefix(command, "loginctl enable-linger "):
+		h.linger = true
+		return nil, nil
+	case command == "docker --version":
+		return []byte("Docker version 27.0.0"), nil
+	case command == "sh":
+		script, _ := io.ReadAll(stdin)
+		if string(script) != "install docker" {
+			return []byte("bad script"), fail
+		}
+		h.dockerInstalled = true
+		return nil, nil
+	case command == "systemctl is-enabled docker" || command == "systemctl is-active docker":
+		if h.serviceActive {
+			if strings.Contains(command, "enabled") {
+				return []byte("enabled\n"), nil
+			}
+			return []byte("active\n"), nil
+		}
+		return []byte("inactive\n"), fail
+	case command == "systemctl enable --now docker":
+		h.serviceActive = true
+		return nil, nil
+	case command == "apk add --no-cache docker":
+		h.dockerInstalled = true
+		return nil, nil
+	case command == "rc-update show default":
+		if h.serviceActive {
+			return []byte("  docker | default\n  sshd | default\n"), nil
+		}
+		return []byte("  sshd | default\n"), nil
+	case command == "rc-service docker status":
+		if h.serviceActive {
+			return []byte("status: started"), nil
+		}
+		return []byte("status: stopped"), fail
+	case command == "rc-update add docker default":
+		return nil, nil
+	case command == "rc-service docker start":
+		h.serviceActive = true
+		return nil, nil
+	case command == "docker info --format {{.ServerVersion}}":
+		if h.dockerInstalled && h.serviceActive {
+			return []byte("27.0.0"), nil
+		}
+		return []byte("Cannot connect to the Docker daemon"), fail
+	case command == "addgroup -S docker":
+		h.groupMembers = []string{}
+		return nil, nil
+	case strings.HasPrefix(command, "addgroup ") && strings.HasSuffix(command, " docker"):
+		h.groupMembers = append(h.groupMembers, "docker")
+		return nil, nil
+	case command == "getent group docker":
+		if h.groupMembers == nil {
+			return nil, fail
+		}
+		return []byte("docker:x:999:"), nil
+	case command == "groupadd docker":
+		h.groupMembers = []string{}
+		return nil, nil
+	case strings.HasPrefix(command, "id -nG "):
+		return []byte(strings.Join(append([]string{"dev"}, h.groupMembers...), " ")), nil
+	case strings.HasPrefix(command, "usermod -aG docker "):
+		h.groupMembers = append(h.groupMembers, "docker")
+		return nil, nil
+	case strings.HasPrefix(command, "docker image inspect -f {{.Id}} "):
+		id, ok := h.images[args[len(args)-1]]
+		if !ok {
+			return []byte("No such image"), fail
+		}
+		return []byte(id + "\n"), nil
+	case strings.HasPrefix(command, "docker pull "):
+		h.images[args[1]] = "sha256:abc"
+		return nil, nil
+	case strings.HasPrefix(command, "docker load -i "):
+		h.images["viberun:v1.0.0"] = "sha256:def"
+		return []byte("Loaded image: viberun:v1.0.0"), nil
+	case strings.HasPrefix(command, "docker tag "):
+		h.images[args[2]] = h.images[args[1]]
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unexpected command %q", command)
+}
+
+func (h *fakeHost) lookPath(name string) (string, error) {
+	if name == "docker" && !h.dockerInstalled {
+		return "", errors.New("not found")
+	}
+	if (name == "usermod" || name == "systemctl") && h.busybox {
+		return "", errors.New("not found")
+	}
+	if name == "podman" && !h.podman {
+		return "", errors.New("not found")
+	}
+	return "/usr/bin/" + name, nil
+}
+
+func testOptions(t *testing.T, host *fakeHost) Options {
+	t.Helper()
+	dir := t.TempDir()
+	osRelease := filepath.Join(dir, "os-release")
+	if err := os.WriteFile(osRelease, []byte("ID=ubuntu\nVERSION_ID=\"24.04\"\nPRETTY_NAME=\"Ubuntu 24.04 LTS\"\n"), 0o644); err != nil {
+		t.Fatalf("write os-release: %v", err)
+	}
+	source := filepath.Join(dir, "viberun-server-staged")
+	if err := os.WriteFile(source, []byte("server v2"), 0o755); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	installer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("install docker"))
+	}))
+	t.Cleanup(installer.Close)
+	return Options{
+		EngineConfigPath: filepath.Join(dir, "host.json"),
+		SubUIDPath:       filepath.Join(dir, "subuid"),
+		SubGIDPath:       filepath.Join(dir, "subgid"),
+		Image:            "ghcr.io/shayne/viberun/viberun:v1.0.0",
+		SourceBinary:     source,
+		InstallPath:      filepath.Join(dir, "bin", "viberun-server"),
+		OSReleasePath:    osRelease,
+		RecordPath:       filepath.Join(dir, "bootstrap.json"),
+		DockerInstallURL: installer.URL,
+		User:             "dev",
+		Exec:             host,
+		LookPath:         host.lookPath,
+		HTTPClient:       installer.Client(),
+	}
+}
+
+func collect(events *[]Event) func(Event) {
+	return func(event Event) {
+		*events = append(*events, event)
+	}
+}
+
+func statuses(events []Event) map[string]Status {
+	result := map[string]Status{}
+	for _, event := range events {
+		if event.Step != "" && event.Status != StatusStart {
+			result[event.Step] = event.Status
+		}
+	}
+	return result
+}
+
+func TestRunCheckReportsDriftWithoutChanges(t *testing.T) {
+	host := &fakeHost{images: map[string]string{}}
+	opts := testOptions(t, host)
+	opts.Check = true
+
+	var events []Event
+	err := Run(opts, collect(&events))
+	if !errors.Is(err, ErrDrift) {
+		t.Fatalf("expected drift error, got %v", err)
+	}
+	got := statuses(events)
+	if got["os"] != StatusOK {
+		t.Fatalf("expected os ok, got %s", got["os"])
+	}
+	for _, name := range []string{"docker", "docker-service", "docker-group", "image", "server"} {
+		if got[name] != StatusDrift {
+			t.Fatalf("expected %s drift, got %s", name, got[name])
+		}
+	}
+	for _, command := range host.commands {
+		for _, mutating := range []string{"sh", "systemctl enable", "groupadd", "usermod", "docker pull", "docker tag"} {
+			if strings.HasPrefix(command, mutating) {
+				t.Fatalf("check mode ran %q", command)
+			}
+		}
+	}
+	if _, err := os.Stat(opts.InstallPath); !os.IsNotExist(err) {
+		t.Fatalf("check mode installed the server binary")
+	}
+}
+
+func TestRunAppliesAndIsIdempotent(t *testing.T) {
+	host := &fakeHost{images: map[string]string{}}
+	opts := testOptions(t, host)
+
+	var events []Event
+	if err := Run(opts, collect(&events)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	got := statuses(events)
+	for _, name := range []string{"docker", "docker-service", "docker-group", "image", "server"} {
+		if got[name] != StatusChanged {
+			t.Fatalf("expected %s changed, got %s", name, got[name])
+		}
+	}
+	installed, err := os.ReadFile(opts.InstallPath)
+	if err != nil || string(installed) != "server v2" {
+		t.Fatalf("server binary not installed: %q %v", installed, err)
+	}
+	data, err := os.ReadFile(opts.RecordPath)
+	if err != nil {
+		t.Fatalf("read record: %v", err)
+	}
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil || len(record.Changes) != 5 {
+		t.Fatalf("unexpected record: %s", data)
+	}
+	last := events[len(events)-1]
+	if last.Status != StatusDone || len(last.Changes) != 5 {
+		t.Fatalf("unexpected done event: %+v", last)
+	}
+
+	events = nil
+	opts.Check = true
+	if err := Run(opts, collect(&events)); err != nil {
+		t.Fatalf("second check: %v", err)
+	}
+	for name, status := range statuses(events) {
+		if status != StatusOK {
+			t.Fatalf("expected %s ok after apply, got %s", name, status)
+		}
+	}
+}
+
+func TestRunRejectsUnsupportedOS(t *testing.T) {
+	host := &fakeHost{images: map[string]string{}}
+	opts := testOptions(t, host)
+	if err := os.WriteFile(opts.OSReleasePath, []byte("ID=arch\n"), 0o644); err != nil {
+		t.Fatalf("write os-release: %v", err)
+	}
+	var events []Event
+	err := Run(opts, collect(&events))
+	if err == nil || !strings.Contains(err.Error(), "unsupported OS: arch") {
+		t.Fatalf("expected unsupported OS error, got %v", err)
+	}
+	if len(host.commands) != 0 {
+		t.Fatalf("expected no commands after OS failure, got %v", host.commands)
+	}
+}
+
+func TestRunOfflineLoadsImageArchive(t *testing.T) {
+	host := &fakeHost{dockerInstalled: true, serviceActive: true, groupMembers: []string{"docker"}, images: map[string]string{}}
+	opts := testOptions(t, host)
+	opts.Offline = true
+	opts.Image = "viberun:v1.0.0"
+	opts.ImageArchive = "/tmp/viberun-image.tar"
+	opts.DockerInstallURL = "http://127.0.0.1:0/unreachable"
+
+	var events []Event
+	if err := Run(opts, collect(&events)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if host.images[LocalImage] != "sha256:def" {
+		t.Fatalf("expected %s tagged from the archive, got %v", LocalImage, host.images)
+	}
+	for _, command := range host.commands {
+		if strings.HasPrefix(command, "docker pull") {
+			t.Fatalf("offline run pulled: %q", command)
+		}
+	}
+}
+
+func TestRunOfflineRequiresDocker(t *testing.T) {
+	host := &fakeHost{images: map[string]string{}}
+	opts := testOptions(t, host)
+	opts.Offline = true
+
+	var events []Event
+	err := Run(opts, collect(&events))
+	if err == nil || !strings.Contains(err.Error(), "install it before bootstrapping offline") {
+		t.Fatalf("expected offline docker error, got %v", err)
+	}
+}
+
+func TestRunAlpineUsesApkAndOpenRC(t *testing.T) {
+	host := &fakeHost{images: map[string]string{}, busybox: true}
+	opts := testOptions(t, host)
+	if err := os.WriteFile(opts.OSReleasePath, []byte("ID=alpine\nVERSION_ID=3.20.1\nPRETTY_NAME=\"Alpine Linux v3.20\"\n"), 0o644); err != nil {
+		t.Fatalf("write os-release: %v", err)
+	}
+	var events []Event
+	if err := Run(opts, collect(&events)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	want := []string{"apk add --no-cache docker", "rc-update add docker default", "rc-service docker start", "addgroup -S docker", "addgroup dev docker"}
+	for _, command := range want {
+		found := false
+		for _, ran := range host.commands {
+			if ran == command {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("expected %q in %v", command, host.commands)
+		}
+	}
+	for _, ran := range host.commands {
+		if ran == "sh" || strings.HasPrefix(ran, "systemctl") || strings.HasPrefix(ran, "usermod") {
+			t.Fatalf("alpine run used %q", ran)
+		}
+	}
+}
+
+func TestRunExistingDockerLeavesDockerAlone(t *testing.T) {
+	host := &fakeHost{images: map[string]string{}}
+	opts := testOptions(t, host)
+	opts.ExistingDocker = true
+	if err := os.WriteFile(opts.OSReleasePath, []byte("ID=arch\nPRETTY_NAME=\"Arch Linux\"\n"), 0o644); err != nil {
+		t.Fatalf("write os-release: %v", err)
+	}
+	var events []Event
+	err := Run(opts, collect(&events))
+	if err == nil || !strings.Contains(err.Error(), "docker is not installed") {
+		t.Fatalf("expected missing docker error, got %v", err)
+	}
+	if len(host.commands) != 0 {
+		t.Fatalf("expected no commands, got %v", host.commands)
+	}
+
+	host.dockerInstalled = true
+	host.serviceActive = true
+	host.commands = nil
+	events = nil
+	if err := Run(opts, collect(&events)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	got := statuses(events)
+	if got["os"] != StatusOK || got["docker"] != StatusOK || got["docker-service"] != StatusOK {
+		t.Fatalf("unexpected statuses: %v", got)
+	}
+	for _, ran := range host.commands {
+		if strings.HasPrefix(ran, "systemctl") || ran == "sh" {
+			t.Fatalf("existing docker mode ran %q", ran)
+		}
+	}
+}
+
+func TestRunPodmanSetsUpRootlessUser(t *testing.T) {
+	host := &fakeHost{images: map[string]string{}}
+	opts := testOptions(t, host)
+	opts.Runtime = engine.Podman
+	if err := os.WriteFile(opts.SubUIDPath, []byte("other:100000:65536\n"), 0o644); err != nil {
+		t.Fatalf("write subuid: %v", err)
+	}
+
+	var events []Event
+	if err := Run(opts, collect(&events)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	got := statuses(events)
+	for _, name := range []string{"podman", "podman-user", "runtime", "image", "server"} {
+		if got[name] != StatusChanged {
+			t.Fatalf("expected %s changed, got %s", name, got[name])
+		}
+	}
+	if _, ok := got["docker"]; ok {
+		t.Fatalf("podman run should not touch docker: %v", got)
+	}
+	if start, ok := subIDStart(opts.SubUIDPath, "dev"); !ok || start != 165536 {
+		t.Fatalf("unexpected subuid range: %d %v", start, ok)
+	}
+	if _, ok := subIDStart(opts.SubGIDPath, "dev"); !ok {
+		t.Fatalf("expected subgid range for dev")
+	}
+	cfg, err := engine.LoadConfig(opts.EngineConfigPath)
+	if err != nil || cfg.Runtime != engine.Podman {
+		t.Fatalf("unexpected engine config: %+v %v", cfg, err)
+	}
+	pulledAsUser := false
+	for _, command := range host.commands {
+		if command == "runuser -u dev -- podman pull "+opts.Image {
+			pulledAsUser = true
+		}
+		if strings.HasPrefix(command, "docker ") {
+			t.Fatalf("podman run used docker: %q", command)
+		}
+	}
+	if !pulledAsUser {
+		t.Fatalf("expected image pulled as the user, got %v", host.commands)
+	}
+
+	events = nil
+	opts.Check = true
+	if err := Run(opts, collect(&events)); err != nil {
+		t.Fatalf("second check: %v", err)
+	}
+}
+
+func TestParseOSRelease(t *testing.T) {
+	id, pretty := ParseOSRelease("NAME=\"Ubuntu\"\nID=ubuntu\nPRETTY_NAME=\"Ubuntu 24.04.1 LTS\"\n")
+	if id != "ubuntu" || pretty != "Ubuntu 24.04.1 LTS" {
+		t.Fatalf("unexpected os-release parse: %q %q", id, pretty)
+	}
+}
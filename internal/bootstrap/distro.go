@@ -0,0 +1,146 @@
+package bootstrap
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ServicesSystemd = "systemd"
+	ServicesOpenRC  = "openrc"
+)
+
+// Support is one row of the host compatibility matrix.
+type Support struct {
+	// IDs are the os-release IDs the row covers.
+	IDs        []string
+	Family     string
+	MinVersion string
+	Packages   string
+	Services   string
+	// DockerInstall is the command sequence that installs docker; nil uses the
+	// get.docker.com convenience script.
+	DockerInstall [][]string
+}
+
+// Matrix lists the distros bootstrap can set up docker on. Other distros are only
+// supported with an existing docker install.
+var Matrix = []Support{
+	{IDs: []string{"ubuntu"}, Family: "debian", MinVersion: "20.04", Packages: "apt", Services: ServicesSystemd},
+	{IDs: []string{"debian"}, Family: "debian", MinVersion: "11", Packages: "apt", Services: ServicesSystemd},
+	{IDs: []string{"fedora"}, Family: "fedora", MinVersion: "39", Packages: "dnf", Services: ServicesSystemd},
+	{
+		IDs:        []string{"rhel", "centos", "rocky", "almalinux"},
+		Family:     "rhel",
+		MinVersion: "8",
+		Packages:   "dnf",
+		Services:   ServicesSystemd,
+		DockerInstall: [][]string{
+			{"dnf", "-y", "install", "dnf-plugins-core"},
+			{"dnf", "config-manager", "--add-repo", "https://download.docker.com/linux/centos/docker-ce.repo"},
+			{"dnf", "-y", "install", "docker-ce", "docker-ce-cli", "containerd.io", "docker-buildx-plugin"},
+		},
+	},
+	{
+		IDs:           []string{"alpine"},
+		Family:        "alpine",
+		MinVersion:    "3.18",
+		Packages:      "apk",
+		Services:      ServicesOpenRC,
+		DockerInstall: [][]string{{"apk", "add", "--no-cache", "docker"}},
+	},
+}
+
+// Distro is the host OS as read from /etc/os-release.
+type Distro struct {
+	ID      string
+	Version string
+	Name    string
+	// Support is nil when the distro is not in the matrix or is too old.
+	Support *Support
+}
+
+// DetectDistro reads os-release content and matches it against the matrix.
+func DetectDistro(content string) Distro {
+	values := parseOSReleaseValues(content)
+	distro := Distro{
+		ID:      strings.ToLower(values["ID"]),
+		Version: values["VERSION_ID"],
+		Name:    fallback(values["PRETTY_NAME"], values["ID"]),
+	}
+	for i := range Matrix {
+		row := &Matrix[i]
+		for _, id := range row.IDs {
+			if id == distro.ID && versionAtLeast(distro.Version, row.MinVersion) {
+				distro.Support = row
+			}
+		}
+	}
+	return distro
+}
+
+// Unsupported explains why the distro is not in the matrix, or returns "".
+func (d Distro) Unsupported() string {
+	if d.Support != nil {
+		return ""
+	}
+	for _, row := range Matrix {
+		for _, id := range row.IDs {
+			if id == d.ID {
+				return fmt.Sprintf("%s %s is older than the supported %s", d.ID, fallback(d.Version, "(unknown version)"), row.MinVersion)
+			}
+		}
+	}
+	return fmt.Sprintf("unsupported OS: %s; supported: %s", fallback(d.ID, "unknown"), SupportedSummary())
+}
+
+// SupportedSummary lists the matrix as "id >= version" entries.
+func SupportedSummary() string {
+	entries := []string{}
+	for _, row := range Matrix {
+		for _, id := range row.IDs {
+			entries = append(entries, fmt.Sprintf("%s >= %s", id, row.MinVersion))
+		}
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ", ")
+}
+
+// versionAtLeast compares dotted numeric versions. Rolling releases (such as Debian sid)
+// have no VERSION_ID and are accepted.
+func versionAtLeast(version string, minimum string) bool {
+	have := strings.Split(strings.TrimSpace(version), ".")
+	want := strings.Split(minimum, ".")
+	if have[0] == "" {
+		return true
+	}
+	for i := range want {
+		w, _ := strconv.Atoi(want[i])
+		h := 0
+		if i < len(have) {
+			var err error
+			h, err = strconv.Atoi(have[i])
+			if err != nil {
+				return false
+			}
+		}
+		if h != w {
+			return h > w
+		}
+	}
+	return true
+}
+
+func parseOSReleaseValues(content string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		values[key] = strings.Trim(value, `"'`)
+	}
+	return values
+}
@@ -0,0 +1,64 @@
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectDistroMatrix(t *testing.T) {
+	tests := []struct {
+		osRelease string
+		family    string
+		services  string
+		reason    string
+	}{
+		{osRelease: "ID=ubuntu\nVERSION_ID=\"24.04\"", family: "debian", services: ServicesSystemd},
+		{osRelease: "ID=ubuntu\nVERSION_ID=\"18.04\"", reason: "older than the supported 20.04"},
+		{osRelease: "ID=debian\nVERSION_ID=\"12\"", family: "debian", services: ServicesSystemd},
+		{osRelease: "ID=debian", family: "debian", services: ServicesSystemd},
+		{osRelease: "ID=fedora\nVERSION_ID=40", family: "fedora", services: ServicesSystemd},
+		{osRelease: "ID=\"rocky\"\nVERSION_ID=\"9.4\"", family: "rhel", services: ServicesSystemd},
+		{osRelease: "ID=centos\nVERSION_ID=\"7\"", reason: "older than the supported 8"},
+		{osRelease: "ID=alpine\nVERSION_ID=3.20.1", family: "alpine", services: ServicesOpenRC},
+		{osRelease: "ID=alpine\nVERSION_ID=3.9.0", reason: "older than the supported 3.18"},
+		{osRelease: "ID=arch", reason: "unsupported OS: arch"},
+		{osRelease: "ID=ubuntu\nVERSION_ID=\"rolling\"", reason: "older than the supported"},
+	}
+	for _, tt := range tests {
+		distro := DetectDistro(tt.osRelease)
+		reason := distro.Unsupported()
+		if tt.reason != "" {
+			if !strings.Contains(reason, tt.reason) {
+				t.Fatalf("%q: expected %q, got %q", tt.osRelease, tt.reason, reason)
+			}
+			continue
+		}
+		if reason != "" {
+			t.Fatalf("%q: unexpected unsupported reason %q", tt.osRelease, reason)
+		}
+		if distro.Support.Family != tt.family || distro.Support.Services != tt.services {
+			t.Fatalf("%q: got %s/%s", tt.osRelease, distro.Support.Family, distro.Support.Services)
+		}
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		have, want string
+		ok         bool
+	}{
+		{"22.04", "20.04", true},
+		{"20.04", "20.04", true},
+		{"20.10", "20.04", true},
+		{"19.10", "20.04", false},
+		{"3.18.4", "3.18", true},
+		{"3.17", "3.18", false},
+		{"12", "11", true},
+		{"9.4", "8", true},
+	}
+	for _, tt := range tests {
+		if got := versionAtLeast(tt.have, tt.want); got != tt.ok {
+			t.Fatalf("versionAtLeast(%q, %q) = %v", tt.have, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/shayne/viberun/internal/engine"
+)
+
+const subIDCount = 65536
+
+// podmanInstall installs podman with each package manager in the matrix.
+var podmanInstall = map[string][][]string{
+	"apt": {{"apt-get", "update"}, {"apt-get", "install", "-y", "podman", "uidmap"}},
+	"dnf": {{"dnf", "-y", "install", "podman"}},
+	"apk": {{"apk", "add", "--no-cache", "podman"}},
+}
+
+// runEngine runs an engine command. Rootless podman keeps images per user, so podman
+// commands run as the target user rather than as root.
+func runEngine(opts Options, args ...string) ([]byte, error) {
+	user := strings.TrimSpace(opts.User)
+	if opts.Runtime == engine.Podman && user != "" && user != "root" {
+		return opts.Exec.Run(nil, "runuser", append([]string{"-u", user, "--", engine.Podman}, args...)...)
+	}
+	return opts.Exec.Run(nil, opts.Runtime, args...)
+}
+
+func podmanStep(opts Options, host *hostInfo) step {
+	s := step{
+		name:  "podman",
+		title: "Install podman",
+		check: func() (bool, string, error) {
+			if _, err := opts.LookPath(engine.Podman); err != nil {
+				return false, "podman is not installed", nil
+			}
+			out, err := opts.Exec.Run(nil, engine.Podman, "--version")
+			if err != nil {
+				return false, "podman is not working: " + tail(out, err), nil
+			}
+			return true, strings.TrimSpace(string(out)), nil
+		},
+		apply: func() (string, error) {
+			if opts.Offline {
+				return "", errors.New("podman is not installed; install it before bootstrapping offline")
+			}
+			commands, ok := podmanInstall[host.distro.Support.Packages]
+			if !ok {
+				return "", fmt.Errorf("no podman install for %s", host.distro.Support.Packages)
+			}
+			for _, command := range commands {
+				if out, err := opts.Exec.Run(nil, command[0], command[1:]...); err != nil {
+					return "", fmt.Errorf("podman install failed: %s", tail(out, err))
+				}
+			}
+			return "installed podman with " + host.distro.Support.Packages, nil
+		},
+	}
+	if opts.ExistingDocker {
+		s.apply = nil
+	}
+	return s
+}
+
+// podmanUserStep gives the user subordinate ids for rootless containers and enables
+// lingering so containers keep running after the ssh session ends.
+func podmanUserStep(opts Options) step {
+	user := strings.TrimSpace(opts.User)
+	lingers := func() (bool, bool) {
+		if _, err := opts.LookPath("loginctl"); err != nil {
+			return true, false
+		}
+		out, _ := opts.Exec.Run(nil, "loginctl", "show-user", user, "--property=Linger")
+		return strings.TrimSpace(string(out)) == "Linger=yes", true
+	}
+	return step{
+		name:  "podman-user",
+		title: "Set up rootless podman",
+		check: func() (bool, string, error) {
+			if user == "" || user == "root" {
+				return true, "running as root; skipped", nil
+			}
+			missing := []string{}
+			for _, path := range []string{opts.SubUIDPath, opts.SubGIDPath} {
+				if _, ok := subIDStart(path, user); !ok {
+					missing = append(missing, path)
+				}
+			}
+			if len(missing) > 0 {
+				return false, fmt.Sprintf("%s has no entry in %s", user, strings.Join(missing, ", ")), nil
+			}
+			if linger, _ := lingers(); !linger {
+				return false, "lingering is off for " + user, nil
+			}
+			return true, user + " can run rootless containers", nil
+		},
+		apply: func() (string, error) {
+			changed := []string{}
+			for _, path := range []string{opts.SubUIDPath, opts.SubGIDPath} {
+				if _, ok := subIDStart(path, user); ok {
+					continue
+				}
+				if err := addSubIDRange(path, user); err != nil {
+					return "", err
+				}
+				changed = append(changed, "added "+path+" range")
+			}
+			if linger, supported := lingers(); supported && !linger {
+				if out, err := opts.Exec.Run(nil, "loginctl", "enable-linger", user); err != nil {
+					return "", fmt.Errorf("failed to enable lingering for %s: %s", user, tail(out, err))
+				}
+				changed = append(changed, "enabled lingering")
+			}
+			return fmt.Sprintf("%s for %s", strings.Join(changed, ", "), user), nil
+		},
+	}
+}
+
+// runtimeStep records the selected engine so viberun-server uses it.
+func runtimeStep(opts Options) step {
+	return step{
+		name:  "runtime",
+		title: "Select container runtime",
+		check: func() (bool, string, error) {
+			cfg, err := engine.LoadConfig(opts.EngineConfigPath)
+			if err != nil {
+				return false, "", err
+			}
+			current := cfg.Runtime
+			if current == "" {
+				current = engine.Docker
+			}
+			if current != opts.Runtime {
+				return false, fmt.Sprintf("runtime is %s, want %s", current, opts.Runtime), nil
+			}
+			return true, opts.Runtime, nil
+		},
+		apply: func() (string, error) {
+			if err := engine.SaveConfig(opts.EngineConfigPath, engine.Config{Runtime: opts.Runtime}); err != nil {
+				return "", fmt.Errorf("failed to write %s: %w", opts.EngineConfigPath, err)
+			}
+			return "set runtime to " + opts.Runtime, nil
+		},
+	}
+}
+
+// subIDStart returns the start of user's range in a subuid/subgid file.
+func subIDStart(path string, user string) (int, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) == 3 && fields[0] == user {
+			start, err := strconv.Atoi(fields[1])
+			return start, err == nil
+		}
+	}
+	return 0, false
+}
+
+// addSubIDRange appends a range for user after the highest existing range.
+func addSubIDRange(path string, user string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	next := 100000
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) != 3 {
+			continue
+		}
+		start, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 == nil && err2 == nil && start+count > next {
+			next = start + count
+		}
+	}
+	content := string(data)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += fmt.Sprintf("%s:%d:%d\n", user, next, subIDCount)
+	return os.WriteFile(path, []byte(content), 0o644)
+}
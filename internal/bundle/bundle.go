@@ -0,0 +1,232 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	ManifestName = "manifest.json"
+	ImageArchive = "image.tar"
+)
+
+// Arches are the server architectures every bundle carries.
+var Arches = []string{"amd64", "arm64"}
+
+// ServerBinary is the bundle entry name of the server for arch.
+func ServerBinary(arch string) string {
+	return "viberun-server-linux-" + arch
+}
+
+// Manifest describes a bundle. It is always the first entry of the archive.
+type Manifest struct {
+	Version string `json:"version"`
+	// Image is the tag the image archive loads as.
+	Image     string    `json:"image"`
+	ImageArch string    `json:"image_arch"`
+	Created   time.Time `json:"created"`
+	// Files maps each entry name to its sha256.
+	Files map[string]string `json:"files"`
+}
+
+// File is a local file to add to a bundle under Name.
+type File struct {
+	Name string
+	Path string
+}
+
+// Write creates a gzipped tar at path with the manifest followed by files. File digests
+// are filled into the manifest.
+func Write(path string, manifest Manifest, files []File) error {
+	manifest.Files = map[string]string{}
+	for _, file := range files {
+		digest, err := fileDigest(file.Path)
+		if err != nil {
+			return err
+		}
+		manifest.Files[file.Name] = digest
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	err = writeEntries(tw, data, files)
+	if closeErr := tw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return nil
+}
+
+func writeEntries(tw *tar.Writer, manifest []byte, files []File) error {
+	header := &tar.Header{Name: ManifestName, Mode: 0o644, Size: int64(len(manifest)), ModTime: time.Now()}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := writeFile(tw, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(tw *tar.Writer, file File) error {
+	in, err := os.Open(file.Path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: file.Name, Mode: int64(info.Mode().Perm()), Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, in)
+	return err
+}
+
+// ReadManifest reads the manifest of the bundle at path.
+func ReadManifest(path string) (Manifest, error) {
+	var manifest Manifest
+	err := walk(path, func(name string, r io.Reader) (bool, error) {
+		if name != ManifestName {
+			return false, errors.New("bundle does not start with a manifest")
+		}
+		if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+			return false, fmt.Errorf("invalid bundle manifest: %w", err)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return Manifest{}, err
+	}
+	if manifest.Version == "" || manifest.Image == "" || len(manifest.Files) == 0 {
+		return Manifest{}, errors.New("invalid bundle manifest: missing fields")
+	}
+	return manifest, nil
+}
+
+// Extract copies entry name out of the bundle to dst, checking it against the manifest
+// digest. dst is removed when the digest does not match.
+func Extract(path string, manifest Manifest, name string, dst string) error {
+	want, ok := manifest.Files[name]
+	if !ok {
+		return fmt.Errorf("%s is not in the bundle manifest", name)
+	}
+	found := false
+	err := walk(path, func(entry string, r io.Reader) (bool, error) {
+		if entry != name {
+			return false, nil
+		}
+		found = true
+		return true, extractTo(r, dst, want)
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s is missing from the bundle", name)
+	}
+	return nil
+}
+
+func extractTo(r io.Reader, dst string, want string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, hash), r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+			err = fmt.Errorf("checksum mismatch for %s: got %s, want %s", filepath.Base(dst), got, want)
+		}
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// walk calls fn for each entry until fn reports it is done.
+func walk(path string, fn func(name string, r io.Reader) (bool, error)) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("invalid bundle: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		done, err := fn(header.Name, tr)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+func fileDigest(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, in); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,99 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestBundle(t *testing.T, dir string) (string, Manifest) {
+	t.Helper()
+	files := []File{}
+	for name, content := range map[string]string{
+		ServerBinary("amd64"): "amd64 server",
+		ServerBinary("arm64"): "arm64 server",
+		ImageArchive:          "image tarball",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		files = append(files, File{Name: name, Path: path})
+	}
+	path := filepath.Join(dir, "bundle.tar.gz")
+	manifest := Manifest{Version: "v1.2.3", Image: "viberun:v1.2.3", ImageArch: "amd64", Created: time.Now().UTC()}
+	if err := Write(path, manifest, files); err != nil {
+		t.Fatalf("write bundle: %v", err)
+	}
+	read, err := ReadManifest(path)
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	return path, read
+}
+
+func TestWriteAndExtract(t *testing.T) {
+	dir := t.TempDir()
+	path, manifest := writeTestBundle(t, dir)
+	if manifest.Version != "v1.2.3" || manifest.ImageArch != "amd64" {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+	if len(manifest.Files) != 3 {
+		t.Fatalf("expected 3 files, got %v", manifest.Files)
+	}
+	dst := filepath.Join(dir, "out", "server")
+	if err := Extract(path, manifest, ServerBinary("arm64"), dst); err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("read extracted: %v", err)
+	}
+	if string(data) != "arm64 server" {
+		t.Fatalf("unexpected content: %q", data)
+	}
+}
+
+func TestExtractRejectsTamperedManifest(t *testing.T) {
+	dir := t.TempDir()
+	path, manifest := writeTestBundle(t, dir)
+	manifest.Files[ImageArchive] = strings.Repeat("0", 64)
+	dst := filepath.Join(dir, "image.tar.out")
+	err := Extract(path, manifest, ImageArchive, dst)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("expected tampered file removed")
+	}
+}
+
+func TestExtractUnknownEntry(t *testing.T) {
+	dir := t.TempDir()
+	path, manifest := writeTestBundle(t, dir)
+	if err := Extract(path, manifest, "viberun-server-linux-riscv64", filepath.Join(dir, "x")); err == nil {
+		t.Fatalf("expected error for unknown entry")
+	}
+}
+
+func TestReadManifestRequiresManifestFirst(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.tar.gz")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	_ = tw.WriteHeader(&tar.Header{Name: ImageArchive, Mode: 0o644, Size: 1})
+	_, _ = tw.Write([]byte("x"))
+	_ = tw.Close()
+	_ = gz.Close()
+	_ = out.Close()
+	if _, err := ReadManifest(path); err == nil {
+		t.Fatalf("expected error for bundle without manifest")
+	}
+}
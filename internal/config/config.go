@@ -8,9 +8,68 @@ import (
 )
 
 type Config struct {
-	DefaultHost   string            `json:"default_host"`
-	AgentProvider string            `json:"agent_provider"`
-	Hosts         map[string]string `json:"hosts"`
+	DefaultHost   string                        `json:"default_host"`
+	AgentProvider string                        `json:"agent_provider"`
+	Hosts         map[string]string             `json:"hosts"`
+	Credentials   map[string][]CredentialSource `json:"credentials,omitempty"`
+	Apps          map[string]AppConfig          `json:"apps,omitempty"`
+	RPC           RPCConfig                     `json:"rpc,omitempty"`
+}
+
+// RPCConfig enables the endpoints a container may call on this machine over the
+// session socket. Opening URLs is always enabled.
+type RPCConfig struct {
+	ClipboardCopy  bool `json:"clipboard_copy,omitempty"`
+	ClipboardPaste bool `json:"clipboard_paste,omitempty"`
+	Notify         bool `json:"notify,omitempty"`
+	Download       bool `json:"download,omitempty"`
+	Edit           bool `json:"edit,omitempty"`
+	// EditCommand opens a file in a local editor and must wait until it is closed,
+	// e.g. ["code", "--wait"]. The file path is appended.
+	EditCommand []string `json:"edit_command,omitempty"`
+	// OpenAllow lists domains, including their subdomains, the container may open
+	// without asking.
+	OpenAllow []string `json:"open_allow,omitempty"`
+	// OpenUnlisted decides other URLs: OpenUnlistedConfirm (the default), OpenUnlistedAllow
+	// or OpenUnlistedDeny. Localhost URLs on a viberun forward are always allowed.
+	OpenUnlisted string `json:"open_unlisted,omitempty"`
+	// OpenPerMinute caps open requests per session; zero uses the default.
+	OpenPerMinute int `json:"open_per_minute,omitempty"`
+}
+
+// Policies for opening URLs that are not allowlisted.
+const (
+	OpenUnlistedConfirm = "confirm"
+	OpenUnlistedAllow   = "allow"
+	OpenUnlistedDeny    = "deny"
+)
+
+// AppConfig holds client-side settings for one app, keyed by app name.
+type AppConfig struct {
+	// LocalPort pins the localhost end of the app's port forward.
+	LocalPort int `json:"local_port,omitempty"`
+	// NoAgentNotify turns off desktop notifications for agent idle/approval/done events.
+	NoAgentNotify bool `json:"no_agent_notify,omitempty"`
+	// NoAutoForward turns off forwarding ports the container starts listening on.
+	NoAutoForward bool `json:"no_auto_forward,omitempty"`
+}
+
+// Credential source types.
+const (
+	CredentialEnv     = "env"
+	CredentialCommand = "command"
+	CredentialKeyring = "keyring"
+)
+
+// CredentialSource tells the client where to read one agent env value (such as
+// ANTHROPIC_API_KEY) from. Sources for the same key are tried in order.
+type CredentialSource struct {
+	Key     string   `json:"key"`
+	Type    string   `json:"type"`
+	Env     string   `json:"env,omitempty"`
+	Command []string `json:"command,omitempty"`
+	Service string   `json:"service,omitempty"`
+	Account string   `json:"account,omitempty"`
 }
 
 func Load() (Config, string, error) {
@@ -46,3 +46,58 @@ func TestSaveAndLoad(t *testing.T) {
 		t.Fatalf("host alias mismatch: %s != %s", loaded.Hosts["dev"], cfg.Hosts["dev"])
 	}
 }
+
+func TestCredentialSourcesRoundTrip(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+
+	path, err := configPath()
+	if err != nil {
+		t.Fatalf("configPath: %v", err)
+	}
+	cfg := Config{
+		Credentials: map[string][]CredentialSource{
+			"claude": {
+				{Key: "ANTHROPIC_API_KEY", Type: CredentialCommand, Command: []string{"op", "read", "op://dev/anthropic/key"}},
+				{Key: "ANTHROPIC_API_KEY", Type: CredentialKeyring, Service: "anthropic", Account: "me"},
+			},
+		},
+	}
+	if err := Save(path, cfg); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, _, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	sources := loaded.Credentials["claude"]
+	if len(sources) != 2 {
+		t.Fatalf("expected 2 claude sources, got %d", len(sources))
+	}
+	if sources[0].Type != CredentialCommand || len(sources[0].Command) != 3 {
+		t.Fatalf("unexpected command source: %+v", sources[0])
+	}
+	if sources[1].Service != "anthropic" || sources[1].Account != "me" {
+		t.Fatalf("unexpected keyring source: %+v", sources[1])
+	}
+}
+
+func TestAppConfigRoundTrip(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+
+	path, err := configPath()
+	if err != nil {
+		t.Fatalf("configPath: %v", err)
+	}
+	if err := Save(path, Config{Apps: map[string]AppConfig{"myapp": {LocalPort: 18080}}}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, _, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded.Apps["myapp"].LocalPort != 18080 {
+		t.Fatalf("unexpected app config: %+v", loaded.Apps)
+	}
+}
@@ -0,0 +1,38 @@
+package doctor
+
+// Status is the outcome of a single check.
+type Status string
+
+const (
+	Pass Status = "pass"
+	Warn Status = "warn"
+	Fail Status = "fail"
+)
+
+// Check is one diagnostic result with an optional hint for fixing it.
+type Check struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// Report is what `viberun-server doctor` prints as JSON.
+type Report struct {
+	ServerVersion string  `json:"server_version"`
+	Checks        []Check `json:"checks"`
+}
+
+// Worst returns the most severe status among checks.
+func Worst(checks []Check) Status {
+	worst := Pass
+	for _, check := range checks {
+		switch check.Status {
+		case Fail:
+			return Fail
+		case Warn:
+			worst = Warn
+		}
+	}
+	return worst
+}
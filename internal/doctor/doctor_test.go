@@ -0,0 +1,17 @@
+package doctor
+
+import "testing"
+
+func TestWorst(t *testing.T) {
+	if got := Worst(nil); got != Pass {
+		t.Fatalf("expected pass for no checks, got %s", got)
+	}
+	checks := []Check{{Status: Pass}, {Status: Warn}, {Status: Pass}}
+	if got := Worst(checks); got != Warn {
+		t.Fatalf("expected warn, got %s", got)
+	}
+	checks = append(checks, Check{Status: Fail})
+	if got := Worst(checks); got != Fail {
+		t.Fatalf("expected fail, got %s", got)
+	}
+}
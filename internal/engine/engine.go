@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	Docker = "docker"
+	Podman = "podman"
+
+	// ConfigPath holds the host's engine selection, written by bootstrap.
+	ConfigPath = "/etc/viberun/host.json"
+)
+
+// Config is the host-level engine selection.
+type Config struct {
+	Runtime string `json:"runtime,omitempty"`
+}
+
+// Engine runs container engine commands (docker or podman) on the host.
+type Engine struct {
+	Name string
+	// Env is added to every command, e.g. DOCKER_HOST for rootless docker.
+	Env []string
+
+	once     sync.Once
+	rootless bool
+	// detect reports whether the engine runs rootless; nil uses `<engine> info`.
+	detect func() bool
+}
+
+// Valid reports whether name is a supported engine.
+func Valid(name string) bool {
+	return name == Docker || name == Podman
+}
+
+// LoadConfig reads the host engine config; a missing file is an empty config.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Config{}, nil
+		}
+		return Config{}, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// SaveConfig writes the host engine config.
+func SaveConfig(path string, cfg Config) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Select picks the engine for this host: VIBERUN_RUNTIME, then the host config at
+// configPath, then docker or podman, whichever is installed.
+func Select(configPath string, lookPath func(string) (string, error)) (*Engine, error) {
+	name := strings.TrimSpace(os.Getenv("VIBERUN_RUNTIME"))
+	if name == "" {
+		cfg, err := LoadConfig(configPath)
+		if err != nil {
+			return nil, err
+		}
+		name = strings.TrimSpace(cfg.Runtime)
+	}
+	if name != "" {
+		if !Valid(name) {
+			return nil, fmt.Errorf("unsupported container runtime %q (expected docker or podman)", name)
+		}
+		if _, err := lookPath(name); err != nil {
+			return nil, fmt.Errorf("%s is configured as the container runtime but was not found in PATH", name)
+		}
+		return New(name), nil
+	}
+	for _, candidate := range []string{Docker, Podman} {
+		if _, err := lookPath(candidate); err == nil {
+			return New(candidate), nil
+		}
+	}
+	return nil, errors.New("docker or podman is required but neither was found in PATH")
+}
+
+// New returns an engine for name. Rootless docker is reached through the user's
+// runtime-dir socket when the system socket is absent and DOCKER_HOST is unset.
+func New(name string) *Engine {
+	e := &Engine{Name: name}
+	if name == Docker && os.Getenv("DOCKER_HOST") == "" {
+		if _, err := os.Stat("/var/run/docker.sock"); err != nil {
+			if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+				socket := filepath.Join(runtimeDir, "docker.sock")
+				if _, err := os.Stat(socket); err == nil {
+					e.Env = append(e.Env, "DOCKER_HOST=unix://"+socket)
+				}
+			}
+		}
+	}
+	return e
+}
+
+// Command builds an engine command.
+func (e *Engine) Command(args ...string) *exec.Cmd {
+	cmd := exec.Command(e.Name, args...)
+	if len(e.Env) > 0 {
+		cmd.Env = append(os.Environ(), e.Env...)
+	}
+	return cmd
+}
+
+// Rootless reports whether the engine runs without root, detected once.
+func (e *Engine) Rootless() bool {
+	e.once.Do(func() {
+		if e.detect != nil {
+			e.rootless = e.detect()
+			return
+		}
+		if e.Name == Podman {
+			out, err := e.Command("info", "--format", "{{.Host.Security.Rootless}}").Output()
+			e.rootless = err == nil && strings.TrimSpace(string(out)) == "true"
+			return
+		}
+		out, err := e.Command("info", "--format", "{{.SecurityOptions}}").Output()
+		e.rootless = err == nil && strings.Contains(string(out), "rootless")
+	})
+	return e.rootless
+}
+
+// CommitArgs snapshots a container. Rootless docker on cgroup v1 cannot pause containers,
+// and podman defaults to OCI images, which drop docker-only config such as HEALTHCHECK.
+func (e *Engine) CommitArgs(container string, ref string) []string {
+	args := []string{"commit"}
+	switch {
+	case e.Name == Podman:
+		args = append(args, "--format", "docker")
+	case e.Rootless():
+		args = append(args, "--pause=false")
+	}
+	return append(args, container, ref)
+}
+
+// VersionArgs prints the engine version; for docker this is the daemon's version.
+func (e *Engine) VersionArgs() []string {
+	if e.Name == Podman {
+		return []string{"version", "--format", "{{.Client.Version}}"}
+	}
+	return []string{"version", "--format", "{{.Server.Version}}"}
+}
+
+// StorageRootArgs prints the directory that holds images and containers.
+func (e *Engine) StorageRootArgs() []string {
+	if e.Name == Podman {
+		return []string{"info", "--format", "{{.Store.GraphRoot}}"}
+	}
+	return []string{"info", "--format", "{{.DockerRootDir}}"}
+}
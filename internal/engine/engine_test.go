@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func lookPathFor(installed ...string) func(string) (string, error) {
+	return func(name string) (string, error) {
+		for _, candidate := range installed {
+			if candidate == name {
+				return "/usr/bin/" + name, nil
+			}
+		}
+		return "", errors.New("not found")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.json")
+	configured := filepath.Join(dir, "host.json")
+	if err := SaveConfig(configured, Config{Runtime: Podman}); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		env       string
+		config    string
+		installed []string
+		want      string
+		err       string
+	}{
+		{name: "docker first", config: missing, installed: []string{Docker, Podman}, want: Docker},
+		{name: "podman fallback", config: missing, installed: []string{Podman}, want: Podman},
+		{name: "none", config: missing, err: "neither was found"},
+		{name: "host config", config: configured, installed: []string{Docker, Podman}, want: Podman},
+		{name: "configured missing", config: configured, installed: []string{Docker}, err: "podman is configured"},
+		{name: "env override", env: Docker, config: configured, installed: []string{Docker, Podman}, want: Docker},
+		{name: "env invalid", env: "lxc", config: missing, installed: []string{Docker}, err: "unsupported container runtime"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("VIBERUN_RUNTIME", tt.env)
+			got, err := Select(tt.config, lookPathFor(tt.installed...))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("select: %v", err)
+			}
+			if got.Name != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got.Name)
+			}
+		})
+	}
+}
+
+func TestCommitArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		rootless bool
+		want     []string
+	}{
+		{name: Docker, want: []string{"commit", "viberun-app", "snap:1"}},
+		{name: Docker, rootless: true, want: []string{"commit", "--pause=false", "viberun-app", "snap:1"}},
+		{name: Podman, rootless: true, want: []string{"commit", "--format", "docker", "viberun-app", "snap:1"}},
+	}
+	for _, tt := range tests {
+		rootless := tt.rootless
+		e := &Engine{Name: tt.name, detect: func() bool { return rootless }}
+		if got := e.CommitArgs("viberun-app", "snap:1"); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s rootless=%v: got %v, want %v", tt.name, tt.rootless, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	cfg, err := LoadConfig(filepath.Join(t.TempDir(), "host.json"))
+	if err != nil || cfg.Runtime != "" {
+		t.Fatalf("expected empty config, got %+v %v", cfg, err)
+	}
+}
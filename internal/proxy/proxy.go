@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shayne/viberun/internal/server"
+)
+
+// SharePrefix starts every share link path: /s/<token>/.
+const SharePrefix = "/s/"
+
+// Routes maps app names to the host port their container publishes.
+type Routes map[string]int
+
+// Share unlocks one app on the share listener until it expires.
+type Share struct {
+	App     string
+	Port    int
+	Expires time.Time
+}
+
+// Shares maps share token hashes (see server.HashShareToken) to their share.
+type Shares map[string]Share
+
+// Proxy routes `<app>.<Domain>` and `/<app>/...` requests to each app's host port.
+type Proxy struct {
+	// Domain enables subdomain routing; requests for other hosts use path routing.
+	Domain string
+	// TargetHost is dialed with the app's port; it defaults to 127.0.0.1.
+	TargetHost string
+
+	mu     sync.RWMutex
+	routes Routes
+	shares Shares
+	// now defaults to time.Now; tests override it to expire shares.
+	now func() time.Time
+}
+
+// New returns a proxy with no routes.
+func New(domain string) *Proxy {
+	return &Proxy{Domain: strings.Trim(strings.ToLower(domain), "."), routes: Routes{}, shares: Shares{}, now: time.Now}
+}
+
+// SetRoutes replaces the route table.
+func (p *Proxy) SetRoutes(routes Routes) {
+	copied := make(Routes, len(routes))
+	for app, port := range routes {
+		copied[app] = port
+	}
+	p.mu.Lock()
+	p.routes = copied
+	p.mu.Unlock()
+}
+
+// Routes returns a copy of the route table.
+func (p *Proxy) Routes() Routes {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	copied := make(Routes, len(p.routes))
+	for app, port := range p.routes {
+		copied[app] = port
+	}
+	return copied
+}
+
+// SetShares replaces the share table.
+func (p *Proxy) SetShares(shares Shares) {
+	copied := make(Shares, len(shares))
+	for hash, share := range shares {
+		copied[hash] = share
+	}
+	p.mu.Lock()
+	p.shares = copied
+	p.mu.Unlock()
+}
+
+// ServeShare serves `/s/<token>/...` for unexpired shares and nothing else, so it is safe
+// to expose on a public interface.
+func (p *Proxy) ServeShare(w http.ResponseWriter, r *http.Request) {
+	token, rest, hasSlash := strings.Cut(strings.TrimPrefix(r.URL.Path, SharePrefix), "/")
+	if !strings.HasPrefix(r.URL.Path, SharePrefix) || token == "" {
+		http.NotFound(w, r)
+		return
+	}
+	p.mu.RLock()
+	share, ok := p.shares[server.HashShareToken(token)]
+	p.mu.RUnlock()
+	if !ok || !p.now().Before(share.Expires) {
+		http.Error(w, "this link has expired or was revoked", http.StatusNotFound)
+		return
+	}
+	prefix := SharePrefix + token
+	if !hasSlash {
+		target := prefix + "/"
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+	out := r.Clone(r.Context())
+	out.URL.Path = "/" + rest
+	out.URL.RawPath = ""
+	p.forward(w, out, share.Port, prefix)
+}
+
+func (p *Proxy) lookup(app string) (int, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	port, ok := p.routes[app]
+	return port, ok
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if app, ok := p.subdomainApp(r.Host); ok {
+		port, found := p.lookup(app)
+		if !found {
+			http.Error(w, fmt.Sprintf("unknown app %q", app), http.StatusNotFound)
+			return
+		}
+		p.forward(w, r, port, "")
+		return
+	}
+
+	app, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if app == "" {
+		p.index(w, r)
+		return
+	}
+	port, found := p.lookup(app)
+	if !found {
+		http.Error(w, fmt.Sprintf("unknown app %q", app), http.StatusNotFound)
+		return
+	}
+	if !strings.Contains(strings.TrimPrefix(r.URL.Path, "/"), "/") {
+		target := "/" + app + "/"
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+	out := r.Clone(r.Context())
+	out.URL.Path = "/" + rest
+	out.URL.RawPath = ""
+	p.forward(w, out, port, "/"+app)
+}
+
+// subdomainApp returns the app for a `<app>.<Domain>` host.
+func (p *Proxy) subdomainApp(hostport string) (string, bool) {
+	if p.Domain == "" {
+		return "", false
+	}
+	host := strings.ToLower(hostport)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	app, ok := strings.CutSuffix(strings.TrimSuffix(host, "."), "."+p.Domain)
+	if !ok || app == "" || strings.Contains(app, ".") {
+		return "", false
+	}
+	return app, true
+}
+
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, port int, prefix string) {
+	targetHost := p.TargetHost
+	if targetHost == "" {
+		targetHost = "127.0.0.1"
+	}
+	target := &url.URL{Scheme: "http", Host: net.JoinHostPort(targetHost, strconv.Itoa(port))}
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			pr.Out.Host = pr.In.Host
+			if prefix != "" {
+				pr.Out.Header.Set("X-Forwarded-Prefix", prefix)
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, fmt.Sprintf("app is not responding on port %d: %v", port, err), http.StatusBadGateway)
+		},
+	}
+	rp.ServeHTTP(w, r)
+}
+
+// index lists the routed apps.
+func (p *Proxy) index(w http.ResponseWriter, r *http.Request) {
+	routes := p.Routes()
+	apps := make([]string, 0, len(routes))
+	for app := range routes {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintln(w, "<!doctype html><title>viberun apps</title><ul>")
+	for _, app := range apps {
+		escaped := html.EscapeString(app)
+		link := "/" + url.PathEscape(app) + "/"
+		if p.Domain != "" {
+			link = "//" + app + "." + p.Domain + portSuffix(r.Host) + "/"
+		}
+		fmt.Fprintf(w, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(link), escaped)
+	}
+	fmt.Fprintln(w, "</ul>")
+}
+
+func portSuffix(hostport string) string {
+	if _, port, err := net.SplitHostPort(hostport); err == nil && port != "80" {
+		return ":" + port
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shayne/viberun/internal/server"
+)
+
+func backend(t *testing.T, name string) int {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, name+" "+r.URL.Path+" "+r.Header.Get("X-Forwarded-Prefix"))
+	}))
+	t.Cleanup(server.Close)
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	value, _ := strconv.Atoi(port)
+	return value
+}
+
+func get(t *testing.T, handler http.Handler, host string, path string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "http://"+host+path, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.String()
+}
+
+func TestSubdomainRouting(t *testing.T) {
+	p := New("apps.example.internal")
+	p.SetRoutes(Routes{"demo": backend(t, "demo"), "blog": backend(t, "blog")})
+
+	code, body := get(t, p, "demo.apps.example.internal:8000", "/hello")
+	if code != http.StatusOK || body != "demo /hello " {
+		t.Fatalf("unexpected response: %d %q", code, body)
+	}
+	code, body = get(t, p, "BLOG.apps.example.internal", "/")
+	if code != http.StatusOK || body != "blog / " {
+		t.Fatalf("unexpected response: %d %q", code, body)
+	}
+	code, _ = get(t, p, "missing.apps.example.internal", "/")
+	if code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown app, got %d", code)
+	}
+}
+
+func TestPathRouting(t *testing.T) {
+	p := New("")
+	p.SetRoutes(Routes{"demo": backend(t, "demo")})
+
+	code, body := get(t, p, "host:8000", "/demo/api/items")
+	if code != http.StatusOK || body != "demo /api/items /demo" {
+		t.Fatalf("unexpected response: %d %q", code, body)
+	}
+	code, _ = get(t, p, "host:8000", "/demo")
+	if code != http.StatusMovedPermanently {
+		t.Fatalf("expected redirect to trailing slash, got %d", code)
+	}
+	code, _ = get(t, p, "host:8000", "/other/")
+	if code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown app, got %d", code)
+	}
+	code, body = get(t, p, "host:8000", "/")
+	if code != http.StatusOK || !strings.Contains(body, `href="/demo/"`) {
+		t.Fatalf("unexpected index: %d %q", code, body)
+	}
+}
+
+func TestSetRoutesReloads(t *testing.T) {
+	p := New("")
+	port := backend(t, "demo")
+	p.SetRoutes(Routes{"demo": port})
+	if code, _ := get(t, p, "host", "/demo/"); code != http.StatusOK {
+		t.Fatalf("expected demo routed, got %d", code)
+	}
+	p.SetRoutes(Routes{})
+	if code, _ := get(t, p, "host", "/demo/"); code != http.StatusNotFound {
+		t.Fatalf("expected demo removed, got %d", code)
+	}
+}
+
+func TestBadGatewayWhenAppIsDown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	p := New("")
+	p.SetRoutes(Routes{"demo": port})
+	if code, _ := get(t, p, "host", "/demo/"); code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", code)
+	}
+}
+
+func TestServeShare(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	p := New("")
+	p.now = func() time.Time { return now }
+	p.SetRoutes(Routes{"demo": backend(t, "demo")})
+	p.SetShares(Shares{server.HashShareToken("secret"): {App: "demo", Port: backend(t, "demo"), Expires: now.Add(time.Hour)}})
+	serve := http.HandlerFunc(p.ServeShare)
+
+	code, body := get(t, serve, "host:8001", "/s/secret/api")
+	if code != http.StatusOK || body != "demo /api /s/secret" {
+		t.Fatalf("unexpected response: %d %q", code, body)
+	}
+	if code, _ := get(t, serve, "host:8001", "/s/secret"); code != http.StatusMovedPermanently {
+		t.Fatalf("expected redirect to trailing slash, got %d", code)
+	}
+	for _, path := range []string{"/s/wrong/", "/demo/", "/", "/s/"} {
+		if code, _ := get(t, serve, "host:8001", path); code != http.StatusNotFound {
+			t.Fatalf("expected 404 for %s, got %d", path, code)
+		}
+	}
+
+	now = now.Add(time.Hour)
+	if code, _ := get(t, serve, "host:8001", "/s/secret/"); code != http.StatusNotFound {
+		t.Fatalf("expected expired share to be rejected, got %d", code)
+	}
+}
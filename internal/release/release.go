@@ -0,0 +1,218 @@
+package release
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBaseURL = "https://github.com"
+	SumsAsset      = "SHA256SUMS"
+	SignatureAsset = "SHA256SUMS.sig"
+	// ImageAsset holds the release image reference pinned by digest.
+	ImageAsset = "viberun-image.txt"
+	maxAsset   = 256 << 20
+)
+
+// signingKeyPEM is the pinned release signing key (an ed25519 public key in PEM form).
+//
+//go:embed signing-key.pub
+var signingKeyPEM []byte
+
+// Source locates the assets for one release.
+type Source struct {
+	BaseURL string
+	Repo    string
+	// Version is a tag such as v1.2.3, or "latest".
+	Version string
+	Client  *http.Client
+}
+
+// Verified is a release asset whose checksum matched a signed SHA256SUMS.
+type Verified struct {
+	Name string
+	Data []byte
+}
+
+// PinnedKey returns the release signing key built into this binary.
+func PinnedKey() (ed25519.PublicKey, error) {
+	return ParsePublicKey(signingKeyPEM)
+}
+
+// ParsePublicKey reads an ed25519 public key in PEM (SPKI) form.
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid signing key: no PEM block")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %w", err)
+	}
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("invalid signing key: not ed25519")
+	}
+	return key, nil
+}
+
+// URL returns the download URL for a release asset.
+func (s Source) URL(asset string) string {
+	base := strings.TrimRight(s.BaseURL, "/")
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	version := strings.TrimSpace(s.Version)
+	if version == "" || version == "latest" {
+		return fmt.Sprintf("%s/%s/releases/latest/download/%s", base, s.Repo, asset)
+	}
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return fmt.Sprintf("%s/%s/releases/download/%s/%s", base, s.Repo, version, asset)
+}
+
+// Fetch downloads SHA256SUMS and its signature, checks the signature against key, then
+// downloads each asset and checks it against the signed checksums.
+func (s Source) Fetch(key ed25519.PublicKey, assets ...string) ([]Verified, error) {
+	sums, err := s.get(SumsAsset)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := s.get(SignatureAsset)
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := VerifySums(key, sums, signature)
+	if err != nil {
+		return nil, err
+	}
+	return s.fetchAssets(checksums, assets)
+}
+
+// FetchUnsigned is Fetch without the signature check, for an explicit opt-out only:
+// SHA256SUMS comes from the same origin as the assets, so it catches corrupt downloads
+// but not a tampered release.
+func (s Source) FetchUnsigned(assets ...string) ([]Verified, error) {
+	sums, err := s.get(SumsAsset)
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := ParseSums(sums)
+	if err != nil {
+		return nil, err
+	}
+	return s.fetchAssets(checksums, assets)
+}
+
+func (s Source) fetchAssets(checksums map[string]string, assets []string) ([]Verified, error) {
+	verified := make([]Verified, 0, len(assets))
+	for _, asset := range assets {
+		data, err := s.get(asset)
+		if err != nil {
+			return nil, err
+		}
+		if err := VerifyAsset(checksums, asset, data); err != nil {
+			return nil, err
+		}
+		verified = append(verified, Verified{Name: asset, Data: data})
+	}
+	return verified, nil
+}
+
+// VerifySums checks the signature over a SHA256SUMS file and returns its checksums by name.
+func VerifySums(key ed25519.PublicKey, sums []byte, signature []byte) (map[string]string, error) {
+	if len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid release signing key")
+	}
+	sig := bytes.TrimSpace(signature)
+	if len(signature) == ed25519.SignatureSize {
+		sig = signature
+	} else if decoded, err := base64.StdEncoding.DecodeString(string(sig)); err == nil {
+		sig = decoded
+	}
+	if len(sig) != ed25519.SignatureSize || !ed25519.Verify(key, sums, sig) {
+		return nil, errors.New("SHA256SUMS signature does not match the pinned release key")
+	}
+	return ParseSums(sums)
+}
+
+// ParseSums parses `sha256sum` output.
+func ParseSums(data []byte) (map[string]string, error) {
+	checksums := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid SHA256SUMS line: %q", line)
+		}
+		checksums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return checksums, nil
+}
+
+// VerifyAsset checks data against the signed checksum for name.
+func VerifyAsset(checksums map[string]string, name string, data []byte) error {
+	want, ok := checksums[name]
+	if !ok {
+		return fmt.Errorf("%s is not listed in SHA256SUMS", name)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", name, got, want)
+	}
+	return nil
+}
+
+// ParseImageRef reads a digest-pinned image reference from the image asset.
+func ParseImageRef(data []byte) (string, error) {
+	ref := strings.TrimSpace(string(data))
+	if !strings.Contains(ref, "@sha256:") || strings.ContainsAny(ref, " \t\n") {
+		return "", fmt.Errorf("release image %q is not pinned by digest", ref)
+	}
+	return ref, nil
+}
+
+func (s Source) get(asset string) ([]byte, error) {
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Minute}
+	}
+	url := s.URL(asset)
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", asset, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAsset+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", asset, err)
+	}
+	if len(data) > maxAsset {
+		return nil, fmt.Errorf("%s is too large", asset)
+	}
+	return data, nil
+}
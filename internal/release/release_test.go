@@ -0,0 +1,227 @@
+package release
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testImageRef = "ghcr.io/shayne/viberun/viberun@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+type fixtureRelease struct {
+	assets map[string][]byte
+}
+
+func newFixtureRelease(t *testing.T, key ed25519.PrivateKey, assets map[string][]byte) *fixtureRelease {
+	t.Helper()
+	var sums strings.Builder
+	for name, data := range assets {
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(&sums, "%s  %s\n", hex.EncodeToString(sum[:]), name)
+	}
+	all := map[string][]byte{SumsAsset: []byte(sums.String())}
+	for name, data := range assets {
+		all[name] = data
+	}
+	all[SignatureAsset] = ed25519.Sign(key, all[SumsAsset])
+	return &fixtureRelease{assets: all}
+}
+
+func (f *fixtureRelease) serve(t *testing.T) Source {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := strings.CutPrefix(r.URL.Path, "/shayne/viberun/releases/download/v1.2.3/")
+		data, found := f.assets[name]
+		if !ok || !found {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return Source{BaseURL: server.URL, Repo: "shayne/viberun", Version: "v1.2.3", Client: server.Client()}
+}
+
+func testKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return public, private
+}
+
+func TestFetchVerifiesAssets(t *testing.T) {
+	public, private := testKey(t)
+	fixture := newFixtureRelease(t, private, map[string][]byte{
+		"viberun-server-linux-amd64": []byte("server binary"),
+		ImageAsset:                   []byte(testImageRef + "\n"),
+	})
+	source := fixture.serve(t)
+
+	assets, err := source.Fetch(public, "viberun-server-linux-amd64", ImageAsset)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if string(assets[0].Data) != "server binary" {
+		t.Fatalf("unexpected server asset: %q", assets[0].Data)
+	}
+	ref, err := ParseImageRef(assets[1].Data)
+	if err != nil {
+		t.Fatalf("parse image ref: %v", err)
+	}
+	if ref != testImageRef {
+		t.Fatalf("unexpected image ref: %q", ref)
+	}
+}
+
+func TestFetchRejectsTamperedAsset(t *testing.T) {
+	public, private := testKey(t)
+	fixture := newFixtureRelease(t, private, map[string][]byte{
+		"viberun-server-linux-amd64": []byte("server binary"),
+	})
+	fixture.assets["viberun-server-linux-amd64"] = []byte("tampered binary")
+	source := fixture.serve(t)
+
+	_, err := source.Fetch(public, "viberun-server-linux-amd64")
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestFetchRejectsWrongSigner(t *testing.T) {
+	public, _ := testKey(t)
+	_, other := testKey(t)
+	fixture := newFixtureRelease(t, other, map[string][]byte{
+		"viberun-server-linux-amd64": []byte("server binary"),
+	})
+	source := fixture.serve(t)
+
+	_, err := source.Fetch(public, "viberun-server-linux-amd64")
+	if err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Fatalf("expected signature error, got %v", err)
+	}
+}
+
+func TestFetchRejectsUnlistedAsset(t *testing.T) {
+	public, private := testKey(t)
+	fixture := newFixtureRelease(t, private, map[string][]byte{
+		"viberun-server-linux-amd64": []byte("server binary"),
+	})
+	fixture.assets["viberun-server-linux-arm64"] = []byte("unsigned binary")
+	source := fixture.serve(t)
+
+	_, err := source.Fetch(public, "viberun-server-linux-arm64")
+	if err == nil || !strings.Contains(err.Error(), "not listed") {
+		t.Fatalf("expected unlisted asset error, got %v", err)
+	}
+}
+
+func TestFetchMissingSignature(t *testing.T) {
+	public, private := testKey(t)
+	fixture := newFixtureRelease(t, private, map[string][]byte{
+		"viberun-server-linux-amd64": []byte("server binary"),
+	})
+	delete(fixture.assets, SignatureAsset)
+	source := fixture.serve(t)
+
+	if _, err := source.Fetch(public, "viberun-server-linux-amd64"); err == nil {
+		t.Fatalf("expected error for missing signature")
+	}
+}
+
+func TestVerifySumsAcceptsBase64Signature(t *testing.T) {
+	public, private := testKey(t)
+	sums := []byte(strings.Repeat("a", 64) + "  viberun-linux-amd64\n")
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(private, sums)) + "\n"
+	checksums, err := VerifySums(public, sums, []byte(signature))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if checksums["viberun-linux-amd64"] != strings.Repeat("a", 64) {
+		t.Fatalf("unexpected checksums: %v", checksums)
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	public, _ := testKey(t)
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	parsed, err := ParsePublicKey(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !parsed.Equal(public) {
+		t.Fatalf("parsed key does not match")
+	}
+	if _, err := ParsePublicKey([]byte("not a key")); err == nil {
+		t.Fatalf("expected error for invalid key")
+	}
+}
+
+func TestPinnedKeyIsProvisioned(t *testing.T) {
+	key, err := PinnedKey()
+	if err != nil {
+		t.Fatalf("signing-key.pub must hold the release key: %v", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		t.Fatalf("unexpected key size %d", len(key))
+	}
+}
+
+func TestSourceURL(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"", "https://github.com/shayne/viberun/releases/latest/download/SHA256SUMS"},
+		{"latest", "https://github.com/shayne/viberun/releases/latest/download/SHA256SUMS"},
+		{"1.2.3", "https://github.com/shayne/viberun/releases/download/v1.2.3/SHA256SUMS"},
+		{"v1.2.3", "https://github.com/shayne/viberun/releases/download/v1.2.3/SHA256SUMS"},
+	}
+	for _, tt := range tests {
+		source := Source{Repo: "shayne/viberun", Version: tt.version}
+		if got := source.URL(SumsAsset); got != tt.want {
+			t.Fatalf("URL(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestParseImageRefRequiresDigest(t *testing.T) {
+	if _, err := ParseImageRef([]byte("ghcr.io/shayne/viberun/viberun:v1.2.3")); err == nil {
+		t.Fatalf("expected error for tag-only ref")
+	}
+}
+
+func TestFetchUnsignedChecksAssets(t *testing.T) {
+	_, private := testKey(t)
+	fixture := newFixtureRelease(t, private, map[string][]byte{
+		"viberun-server-linux-amd64": []byte("server binary"),
+	})
+	delete(fixture.assets, SignatureAsset)
+	source := fixture.serve(t)
+
+	assets, err := source.FetchUnsigned("viberun-server-linux-amd64")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if string(assets[0].Data) != "server binary" {
+		t.Fatalf("unexpected server asset: %q", assets[0].Data)
+	}
+	fixture.assets["viberun-server-linux-amd64"] = []byte("corrupt binary")
+	if _, err := source.FetchUnsigned("viberun-server-linux-amd64"); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
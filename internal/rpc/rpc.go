@@ -0,0 +1,428 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Version is the RPC API version; endpoints live under /v<Version>/.
+const Version = 1
+
+// Endpoint names, as listed by GET /v1 and used by `viberun config --rpc`.
+const (
+	EndpointOpen           = "open"
+	EndpointClipboardCopy  = "clipboard-copy"
+	EndpointClipboardPaste = "clipboard-paste"
+	EndpointNotify         = "notify"
+	EndpointDownload       = "download"
+	EndpointEdit           = "edit"
+	EndpointAgentEvent     = "agent-event"
+	EndpointPorts          = "ports"
+)
+
+// Endpoints lists every endpoint in the order GET /v1 reports them.
+var Endpoints = []string{EndpointOpen, EndpointClipboardCopy, EndpointClipboardPaste, EndpointNotify, EndpointDownload, EndpointEdit, EndpointAgentEvent, EndpointPorts}
+
+// Agent events reported by hooks in the container.
+const (
+	EventIdle     = "idle"
+	EventApproval = "approval"
+	EventDone     = "done"
+)
+
+// ListeningPort is a TCP port a process in the container listens on.
+type ListeningPort struct {
+	Port int `json:"port"`
+	// Loopback is set when the port only listens on 127.0.0.1 or ::1, which a forward
+	// to the container's address cannot reach.
+	Loopback bool `json:"loopback,omitempty"`
+}
+
+// PortsUpdate is the body of POST /v1/ports: every port the container listens on.
+type PortsUpdate struct {
+	Ports []ListeningPort `json:"ports"`
+}
+
+// PortsResult is the response of POST /v1/ports: messages to announce in the session.
+type PortsResult struct {
+	Messages []string `json:"messages"`
+}
+
+const (
+	maxFormBytes      = 64 << 10
+	maxClipboardBytes = 1 << 20
+	maxFileBytes      = 256 << 20
+)
+
+// Handler serves the RPC API a container reaches over the forwarded socket. A nil
+// function disables its endpoint.
+type Handler struct {
+	Open   func(rawURL string) error
+	Copy   func(text string) error
+	Paste  func() (string, error)
+	Notify func(title string, message string) error
+	// DownloadDir receives downloaded files; empty disables downloads.
+	DownloadDir string
+	// Edit opens path in a local editor and returns once editing is done.
+	Edit func(path string) error
+	// AgentEvent reports that the agent is idle, needs approval or is done.
+	AgentEvent func(event string, message string) error
+	// Ports receives the container's listening ports whenever they change and returns
+	// what to announce, such as new forwards.
+	Ports func(ports []ListeningPort) ([]string, error)
+}
+
+// Info is the response of GET /v1.
+type Info struct {
+	Version   int      `json:"version"`
+	Endpoints []string `json:"endpoints"`
+}
+
+// Enabled returns the enabled endpoints.
+func (h *Handler) Enabled() []string {
+	enabled := map[string]bool{
+		EndpointOpen:           h.Open != nil,
+		EndpointClipboardCopy:  h.Copy != nil,
+		EndpointClipboardPaste: h.Paste != nil,
+		EndpointNotify:         h.Notify != nil,
+		EndpointDownload:       h.DownloadDir != "",
+		EndpointEdit:           h.Edit != nil,
+		EndpointAgentEvent:     h.AgentEvent != nil,
+		EndpointPorts:          h.Ports != nil,
+	}
+	names := []string{}
+	for _, name := range Endpoints {
+		if enabled[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Clients in the container address the forwarded socket as localhost; a web page
+	// that rebinds its own name to this machine sends that name and is turned away.
+	if !localHost(r.Host) {
+		http.Error(w, "forbidden host", http.StatusForbidden)
+		return
+	}
+	prefix := fmt.Sprintf("/v%d", Version)
+	path := r.URL.Path
+	// POST /open predates the versioned API; older images still call it.
+	if path == "/open" {
+		path = prefix + "/open"
+	}
+	switch {
+	case path == prefix && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Info{Version: Version, Endpoints: h.Enabled()})
+	case path == prefix+"/open" && r.Method == http.MethodPost:
+		h.serveOpen(w, r)
+	case path == prefix+"/clipboard/copy" && r.Method == http.MethodPost:
+		h.serveCopy(w, r)
+	case path == prefix+"/clipboard/paste" && r.Method == http.MethodGet:
+		h.servePaste(w, r)
+	case path == prefix+"/notify" && r.Method == http.MethodPost:
+		h.serveNotify(w, r)
+	case path == prefix+"/download" && r.Method == http.MethodPost:
+		h.serveDownload(w, r)
+	case path == prefix+"/edit" && r.Method == http.MethodPost:
+		h.serveEdit(w, r)
+	case path == prefix+"/agent-event" && r.Method == http.MethodPost:
+		h.serveAgentEvent(w, r)
+	case path == prefix+"/ports" && r.Method == http.MethodPost:
+		h.servePorts(w, r)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func (h *Handler) serveOpen(w http.ResponseWriter, r *http.Request) {
+	if h.Open == nil {
+		disabled(w, EndpointOpen)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := h.Open(strings.TrimSpace(r.Form.Get("url"))); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) serveCopy(w http.ResponseWriter, r *http.Request) {
+	if h.Copy == nil {
+		disabled(w, EndpointClipboardCopy)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxClipboardBytes))
+	if err != nil {
+		http.Error(w, "clipboard text is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := h.Copy(string(data)); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) servePaste(w http.ResponseWriter, _ *http.Request) {
+	if h.Paste == nil {
+		disabled(w, EndpointClipboardPaste)
+		return
+	}
+	text, err := h.Paste()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.WriteString(w, text)
+}
+
+func (h *Handler) serveNotify(w http.ResponseWriter, r *http.Request) {
+	if h.Notify == nil {
+		disabled(w, EndpointNotify)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	title := strings.TrimSpace(r.Form.Get("title"))
+	if title == "" {
+		http.Error(w, "missing title", http.StatusBadRequest)
+		return
+	}
+	if err := h.Notify(title, strings.TrimSpace(r.Form.Get("message"))); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) serveAgentEvent(w http.ResponseWriter, r *http.Request) {
+	if h.AgentEvent == nil {
+		http.Error(w, "agent notifications are off for this app", http.StatusForbidden)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	event := strings.TrimSpace(r.Form.Get("event"))
+	switch event {
+	case EventIdle, EventApproval, EventDone:
+	default:
+		http.Error(w, fmt.Sprintf("unknown event %q", event), http.StatusBadRequest)
+		return
+	}
+	if err := h.AgentEvent(event, strings.TrimSpace(r.Form.Get("message"))); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) servePorts(w http.ResponseWriter, r *http.Request) {
+	if h.Ports == nil {
+		http.Error(w, "port auto-forwarding is off for this session", http.StatusForbidden)
+		return
+	}
+	var update PortsUpdate
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFormBytes)).Decode(&update); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	for _, port := range update.Ports {
+		if port.Port <= 0 || port.Port > 65535 {
+			http.Error(w, fmt.Sprintf("invalid port %d", port.Port), http.StatusBadRequest)
+			return
+		}
+	}
+	messages, err := h.Ports(update.Ports)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if messages == nil {
+		messages = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(PortsResult{Messages: messages})
+}
+
+func (h *Handler) serveDownload(w http.ResponseWriter, r *http.Request) {
+	if h.DownloadDir == "" {
+		disabled(w, EndpointDownload)
+		return
+	}
+	name, err := fileName(r)
+	if err == nil && strings.HasPrefix(name, ".") {
+		err = fmt.Errorf("refusing to download hidden file %s", name)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := os.MkdirAll(h.DownloadDir, 0o755); err != nil {
+		writeError(w, err)
+		return
+	}
+	file, err := createUnique(h.DownloadDir, name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	_, copyErr := io.Copy(file, http.MaxBytesReader(w, r.Body, maxFileBytes))
+	closeErr := file.Close()
+	if err := errors.Join(copyErr, closeErr); err != nil {
+		_ = os.Remove(file.Name())
+		http.Error(w, fmt.Sprintf("download failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, file.Name())
+}
+
+// serveEdit saves the uploaded file locally, waits for the editor to close and returns
+// the edited content.
+func (h *Handler) serveEdit(w http.ResponseWriter, r *http.Request) {
+	if h.Edit == nil {
+		disabled(w, EndpointEdit)
+		return
+	}
+	name, err := fileName(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxFileBytes))
+	if err != nil {
+		http.Error(w, "file is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	dir, err := os.MkdirTemp("", "viberun-edit-")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.Edit(path); err != nil {
+		writeError(w, err)
+		return
+	}
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(edited)
+}
+
+// fileName returns the base name from the name query parameter.
+func fileName(r *http.Request) (string, error) {
+	name := filepath.Base(strings.TrimSpace(r.URL.Query().Get("name")))
+	if name == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+		return "", fmt.Errorf("invalid file name")
+	}
+	return name, nil
+}
+
+// createUnique creates name in dir, adding " (n)" before the extension if it exists.
+func createUnique(dir string, name string) (*os.File, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 1; ; i++ {
+		file, err := os.OpenFile(filepath.Join(dir, candidate), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil || !errors.Is(err, os.ErrExist) || i > 999 {
+			return file, err
+		}
+		candidate = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+	}
+}
+
+func disabled(w http.ResponseWriter, endpoint string) {
+	http.Error(w, fmt.Sprintf("%s is disabled; enable it on your machine with: viberun config --rpc %s=on", endpoint, endpoint), http.StatusForbidden)
+}
+
+// Invalid marks err as caused by the request rather than the local machine.
+func Invalid(err error) error {
+	return invalidError{err: err}
+}
+
+type invalidError struct {
+	err error
+}
+
+func (e invalidError) Error() string {
+	return e.err.Error()
+}
+
+func (e invalidError) Unwrap() error {
+	return e.err
+}
+
+// Denied marks err as a refusal by the local machine's policy.
+func Denied(err error) error {
+	return deniedError{err: err}
+}
+
+type deniedError struct {
+	err error
+}
+
+func (e deniedError) Error() string {
+	return e.err.Error()
+}
+
+func (e deniedError) Unwrap() error {
+	return e.err
+}
+
+// writeError reports a failed request; errors marked with Invalid are client errors
+// and errors marked with Denied are refusals.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.As(err, new(invalidError)):
+		status = http.StatusBadRequest
+	case errors.As(err, new(deniedError)):
+		status = http.StatusForbidden
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// localHost reports whether a Host header names this machine's loopback interface.
+func localHost(host string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	switch strings.ToLower(host) {
+	case "localhost", "127.0.0.1", "::1", "[::1]":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,212 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func do(t *testing.T, h http.Handler, method string, target string, body string, contentType string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, "http://localhost"+target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func form(values url.Values) string {
+	return values.Encode()
+}
+
+const formType = "application/x-www-form-urlencoded"
+
+func TestInfoListsEnabledEndpoints(t *testing.T) {
+	h := &Handler{Open: func(string) error { return nil }, DownloadDir: t.TempDir()}
+	rec := do(t, h, http.MethodGet, "/v1", "", "")
+	var info Info
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if info.Version != 1 || strings.Join(info.Endpoints, ",") != "open,download" {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+}
+
+func TestRejectsForeignHost(t *testing.T) {
+	h := &Handler{Open: func(string) error { return nil }}
+	for _, host := range []string{"evil.example", "evil.example:80", "192.168.1.5:51234"} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/v1", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected 403, got %d", host, rec.Code)
+		}
+	}
+	for _, host := range []string{"localhost", "127.0.0.1:51234", "[::1]:51234"} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/v1", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", host, rec.Code)
+		}
+	}
+}
+
+func TestOpenKeepsLegacyPath(t *testing.T) {
+	opened := []string{}
+	h := &Handler{Open: func(raw string) error {
+		if raw == "bad" {
+			return Invalid(errors.New("invalid url"))
+		}
+		if raw == "https://evil.example" {
+			return Denied(errors.New("not allowed"))
+		}
+		opened = append(opened, raw)
+		return nil
+	}}
+	for _, path := range []string{"/open", "/v1/open"} {
+		rec := do(t, h, http.MethodPost, path, form(url.Values{"url": {"https://example.com"}}), formType)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("%s: expected 204, got %d %s", path, rec.Code, rec.Body.String())
+		}
+	}
+	if len(opened) != 2 {
+		t.Fatalf("expected two opens, got %v", opened)
+	}
+	rec := do(t, h, http.MethodPost, "/v1/open", form(url.Values{"url": {"bad"}}), formType)
+	if rec.Code != http.StatusBadRequest || strings.TrimSpace(rec.Body.String()) != "invalid url" {
+		t.Fatalf("expected 400 invalid url, got %d %q", rec.Code, rec.Body.String())
+	}
+	rec = do(t, h, http.MethodPost, "/v1/open", form(url.Values{"url": {"https://evil.example"}}), formType)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for denied open, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDisabledEndpointsAreForbidden(t *testing.T) {
+	h := &Handler{}
+	cases := []struct{ method, path string }{
+		{http.MethodPost, "/v1/open"},
+		{http.MethodPost, "/v1/clipboard/copy"},
+		{http.MethodGet, "/v1/clipboard/paste"},
+		{http.MethodPost, "/v1/notify"},
+		{http.MethodPost, "/v1/download?name=a.txt"},
+		{http.MethodPost, "/v1/edit?name=a.txt"},
+	}
+	for _, tc := range cases {
+		rec := do(t, h, tc.method, tc.path, "", "")
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "viberun config --rpc") {
+			t.Fatalf("%s: expected 403 with hint, got %d %q", tc.path, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := do(t, h, http.MethodGet, "/v2/open", "", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown version, got %d", rec.Code)
+	}
+}
+
+func TestClipboardAndNotify(t *testing.T) {
+	clipboard := ""
+	notified := ""
+	h := &Handler{
+		Copy:   func(text string) error { clipboard = text; return nil },
+		Paste:  func() (string, error) { return clipboard, nil },
+		Notify: func(title string, message string) error { notified = title + ": " + message; return nil },
+	}
+	if rec := do(t, h, http.MethodPost, "/v1/clipboard/copy", "hello\n", "text/plain"); rec.Code != http.StatusNoContent {
+		t.Fatalf("copy: %d", rec.Code)
+	}
+	if rec := do(t, h, http.MethodGet, "/v1/clipboard/paste", "", ""); rec.Body.String() != "hello\n" {
+		t.Fatalf("paste: %q", rec.Body.String())
+	}
+	if rec := do(t, h, http.MethodPost, "/v1/notify", form(url.Values{"message": {"no title"}}), formType); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected missing title to fail, got %d", rec.Code)
+	}
+	rec := do(t, h, http.MethodPost, "/v1/notify", form(url.Values{"title": {"demo"}, "message": {"done"}}), formType)
+	if rec.Code != http.StatusNoContent || notified != "demo: done" {
+		t.Fatalf("notify: %d %q", rec.Code, notified)
+	}
+}
+
+func TestDownloadWritesUniqueFiles(t *testing.T) {
+	dir := t.TempDir()
+	h := &Handler{DownloadDir: dir}
+	for i, want := range []string{"report.txt", "report (1).txt"} {
+		rec := do(t, h, http.MethodPost, "/v1/download?name=../../report.txt", "body", "application/octet-stream")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("download %d: %d %s", i, rec.Code, rec.Body.String())
+		}
+		if got := strings.TrimSpace(rec.Body.String()); got != filepath.Join(dir, want) {
+			t.Fatalf("expected %s, got %s", filepath.Join(dir, want), got)
+		}
+	}
+	if rec := do(t, h, http.MethodPost, "/v1/download?name=.bashrc", "x", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected hidden file to be refused, got %d", rec.Code)
+	}
+}
+
+func TestEditReturnsEditedContent(t *testing.T) {
+	h := &Handler{Edit: func(path string) error {
+		if filepath.Base(path) != "notes.md" {
+			t.Fatalf("unexpected path %s", path)
+		}
+		return os.WriteFile(path, []byte("edited"), 0o600)
+	}}
+	rec := do(t, h, http.MethodPost, "/v1/edit?name=notes.md", "original", "application/octet-stream")
+	if rec.Code != http.StatusOK || rec.Body.String() != "edited" {
+		t.Fatalf("edit: %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAgentEvent(t *testing.T) {
+	events := []string{}
+	h := &Handler{AgentEvent: func(event string, message string) error {
+		events = append(events, event+":"+message)
+		return nil
+	}}
+	rec := do(t, h, http.MethodPost, "/v1/agent-event", form(url.Values{"event": {"approval"}, "message": {"Bash"}}), formType)
+	if rec.Code != http.StatusNoContent || len(events) != 1 || events[0] != "approval:Bash" {
+		t.Fatalf("unexpected result: %d %v", rec.Code, events)
+	}
+	if rec := do(t, h, http.MethodPost, "/v1/agent-event", form(url.Values{"event": {"reboot"}}), formType); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected unknown event to fail, got %d", rec.Code)
+	}
+	if rec := do(t, &Handler{}, http.MethodPost, "/v1/agent-event", form(url.Values{"event": {"done"}}), formType); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected disabled agent events to be forbidden, got %d", rec.Code)
+	}
+}
+
+func TestPorts(t *testing.T) {
+	var got []ListeningPort
+	h := &Handler{Ports: func(ports []ListeningPort) ([]string, error) {
+		got = ports
+		return []string{"Forwarded 5173"}, nil
+	}}
+	rec := do(t, h, http.MethodPost, "/v1/ports", `{"ports":[{"port":5173},{"port":9229,"loopback":true}]}`, "application/json")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	var result PortsResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got) != 2 || !got[1].Loopback || len(result.Messages) != 1 {
+		t.Fatalf("unexpected ports %+v result %+v", got, result)
+	}
+	if rec := do(t, h, http.MethodPost, "/v1/ports", `{"ports":[{"port":70000}]}`, "application/json"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid port to fail, got %d", rec.Code)
+	}
+	if rec := do(t, &Handler{}, http.MethodPost, "/v1/ports", `{"ports":[]}`, "application/json"); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected disabled ports to be forbidden, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// AuthAuditEntry records an auth apply on the host. It lists the files and env keys
+// that were written but never their values.
+type AuthAuditEntry struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user,omitempty"`
+	App      string    `json:"app"`
+	Provider string    `json:"provider"`
+	Action   string    `json:"action"`
+	Files    []string  `json:"files,omitempty"`
+	Keys     []string  `json:"keys,omitempty"`
+	Backups  []string  `json:"backups,omitempty"`
+	Result   string    `json:"result"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// AppendAuthAudit appends an entry to the host auth audit log.
+func AppendAuthAudit(entry AuthAuditEntry) error {
+	path, err := AuthAuditPath()
+	if err != nil {
+		return err
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	if entry.User == "" {
+		entry.User = os.Getenv("USER")
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// AuthAuditPath is the JSON-lines log of auth applies.
+func AuthAuditPath() (string, error) {
+	dir, err := baseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "auth-audit.log"), nil
+}
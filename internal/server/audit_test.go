@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAppendAuthAudit(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("USER", "tester")
+
+	for _, result := range []string{"applied", "rolled_back"} {
+		err := AppendAuthAudit(AuthAuditEntry{
+			App:      "app-a",
+			Provider: "claude",
+			Action:   "push",
+			Files:    []string{"/root/.claude/settings.json"},
+			Keys:     []string{"ANTHROPIC_API_KEY"},
+			Result:   result,
+		})
+		if err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	path, err := AuthAuditPath()
+	if err != nil {
+		t.Fatalf("path: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected 0600 audit log, got %v", info.Mode().Perm())
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	var entries []AuthAuditEntry
+	for scanner.Scan() {
+		var entry AuthAuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("decode %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].User != "tester" || entries[0].Time.IsZero() || entries[1].Result != "rolled_back" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if !strings.Contains(entries[0].Keys[0], "ANTHROPIC_API_KEY") {
+		t.Fatalf("expected key names in audit: %+v", entries[0])
+	}
+}
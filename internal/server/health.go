@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultHealthStatus and DefaultHealthInterval apply when a health check leaves them out.
+const (
+	DefaultHealthStatus   = 200
+	DefaultHealthInterval = 30 * time.Second
+)
+
+// HealthCheck is an app's optional HTTP health check against its port 8080.
+type HealthCheck struct {
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	// Interval is how often the container's HEALTHCHECK runs when Docker is set, and how
+	// long the session status line trusts a result. The server does not probe on it;
+	// status and ls check when they run.
+	Interval time.Duration `json:"interval"`
+	// Docker installs the check as the container's HEALTHCHECK when it is created.
+	Docker bool `json:"docker,omitempty"`
+}
+
+// Validate checks the fields, which end up in a shell command for the HEALTHCHECK.
+func (c HealthCheck) Validate() error {
+	if !strings.HasPrefix(c.Path, "/") {
+		return fmt.Errorf("health path must start with /")
+	}
+	for _, r := range c.Path {
+		if !validHealthPathRune(r) {
+			return fmt.Errorf("health path %q contains %q", c.Path, r)
+		}
+	}
+	if c.Status < 100 || c.Status > 599 {
+		return fmt.Errorf("health status %d is not an HTTP status", c.Status)
+	}
+	if c.Interval < time.Second || c.Interval > time.Hour {
+		return fmt.Errorf("health interval must be between 1s and 1h")
+	}
+	return nil
+}
+
+func validHealthPathRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	default:
+		return strings.ContainsRune("/-._~%?=&+,:@", r)
+	}
+}
+
+// String describes the check, e.g. "GET /healthz -> 200 every 30s".
+func (c HealthCheck) String() string {
+	return fmt.Sprintf("GET %s -> %d every %s", c.Path, c.Status, c.Interval)
+}
+
+// SetHealth stores the health check for app.
+func (s *State) SetHealth(app string, check HealthCheck) {
+	if s.Health == nil {
+		s.Health = map[string]HealthCheck{}
+	}
+	s.Health[app] = check
+}
+
+// HealthForApp returns the app's health check, if it has one.
+func (s *State) HealthForApp(app string) (HealthCheck, bool) {
+	check, ok := s.Health[app]
+	return check, ok
+}
+
+// RemoveHealth drops the app's health check and reports whether it had one.
+func (s *State) RemoveHealth(app string) bool {
+	if _, ok := s.Health[app]; !ok {
+		return false
+	}
+	delete(s.Health, app)
+	return true
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthCheckValidate(t *testing.T) {
+	valid := HealthCheck{Path: "/healthz?full=1", Status: 200, Interval: 30 * time.Second}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid check, got %v", err)
+	}
+	invalid := []HealthCheck{
+		{Path: "healthz", Status: 200, Interval: time.Minute},
+		{Path: "/health'; rm -rf /", Status: 200, Interval: time.Minute},
+		{Path: "/healthz", Status: 99, Interval: time.Minute},
+		{Path: "/healthz", Status: 200, Interval: time.Millisecond},
+	}
+	for _, check := range invalid {
+		if err := check.Validate(); err == nil {
+			t.Fatalf("expected %+v to be rejected", check)
+		}
+	}
+}
+
+func TestStateHealth(t *testing.T) {
+	state := State{}
+	state.SetPort("myapp", 8080)
+	state.SetHealth("myapp", HealthCheck{Path: "/", Status: 200, Interval: time.Minute})
+	if check, ok := state.HealthForApp("myapp"); !ok || check.Path != "/" {
+		t.Fatalf("unexpected health check %+v %v", check, ok)
+	}
+	if !state.RemoveApp("myapp") {
+		t.Fatalf("expected app to be removed")
+	}
+	if _, ok := state.HealthForApp("myapp"); ok {
+		t.Fatalf("expected health check to be removed with the app")
+	}
+	if state.RemoveHealth("myapp") {
+		t.Fatalf("expected nothing left to remove")
+	}
+}
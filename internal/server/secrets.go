@@ -0,0 +1,290 @@
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Secrets holds per-app secret values encrypted at rest with a host-local key.
+type Secrets struct {
+	Apps map[string]map[string]string `json:"apps"`
+
+	path string
+	key  []byte
+}
+
+// rootSecretsKeyPath holds the key when the server runs as root.
+var rootSecretsKeyPath = "/etc/viberun/secrets.key"
+
+// LoadSecrets opens the host secret store, creating its encryption key on first use.
+// The key is kept outside the state directory, so a backup or copy of that directory
+// alone cannot decrypt the store.
+func LoadSecrets() (*Secrets, error) {
+	dir, err := baseDir()
+	if err != nil {
+		return nil, err
+	}
+	keyPath, err := secretsKeyPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := moveLegacyKey(filepath.Join(dir, "secrets.key"), keyPath); err != nil {
+		return nil, fmt.Errorf("failed to move secrets key: %w", err)
+	}
+	return loadSecretsFrom(filepath.Join(dir, "secrets.json"), keyPath)
+}
+
+// secretsKeyPath returns where the key lives: /etc/viberun for root, otherwise
+// $XDG_STATE_HOME/viberun (default ~/.local/state).
+func secretsKeyPath() (string, error) {
+	if os.Geteuid() == 0 {
+		return rootSecretsKeyPath, nil
+	}
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "viberun", "secrets.key"), nil
+}
+
+// moveLegacyKey moves a key that older servers kept next to secrets.json to keyPath.
+func moveLegacyKey(legacy string, keyPath string) error {
+	key, err := os.ReadFile(legacy)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	current, err := os.ReadFile(keyPath)
+	switch {
+	case err == nil && string(current) != string(key):
+		return fmt.Errorf("%s and %s hold different keys", legacy, keyPath)
+	case errors.Is(err, os.ErrNotExist):
+		if err := os.MkdirAll(filepath.Dir(keyPath), 0o700); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(keyPath, key, 0o600); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+	return os.Remove(legacy)
+}
+
+func loadSecretsFrom(path string, keyPath string) (*Secrets, error) {
+	key, err := loadOrCreateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	secrets := &Secrets{Apps: map[string]map[string]string{}, path: path, key: key}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return secrets, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, secrets); err != nil {
+		return nil, err
+	}
+	if secrets.Apps == nil {
+		secrets.Apps = map[string]map[string]string{}
+	}
+	return secrets, nil
+}
+
+// ValidSecretName reports whether name can be used as an environment variable name.
+func ValidSecretName(name string) bool {
+	return secretNamePattern.MatchString(name)
+}
+
+// Set encrypts and stores a secret value for an app.
+func (s *Secrets) Set(app string, name string, value string) error {
+	if !ValidSecretName(name) {
+		return fmt.Errorf("invalid secret name %q", name)
+	}
+	sealed, err := s.seal(app, name, value)
+	if err != nil {
+		return err
+	}
+	if s.Apps[app] == nil {
+		s.Apps[app] = map[string]string{}
+	}
+	s.Apps[app][name] = sealed
+	return nil
+}
+
+// Remove deletes a secret and reports whether it existed.
+func (s *Secrets) Remove(app string, name string) bool {
+	values, ok := s.Apps[app]
+	if !ok {
+		return false
+	}
+	if _, ok := values[name]; !ok {
+		return false
+	}
+	delete(values, name)
+	if len(values) == 0 {
+		delete(s.Apps, app)
+	}
+	return true
+}
+
+// RemoveApp deletes every secret for an app and reports whether any existed.
+func (s *Secrets) RemoveApp(app string) bool {
+	if _, ok := s.Apps[app]; !ok {
+		return false
+	}
+	delete(s.Apps, app)
+	return true
+}
+
+// Names returns the secret names for an app in sorted order.
+func (s *Secrets) Names(app string) []string {
+	names := make([]string, 0, len(s.Apps[app]))
+	for name := range s.Apps[app] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Env decrypts every secret for an app.
+func (s *Secrets) Env(app string) (map[string]string, error) {
+	env := make(map[string]string, len(s.Apps[app]))
+	for name, sealed := range s.Apps[app] {
+		value, err := s.open(app, name, sealed)
+		if err != nil {
+			return nil, err
+		}
+		env[name] = value
+	}
+	return env, nil
+}
+
+// Save writes the encrypted store with owner-only permissions.
+func (s *Secrets) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data, 0o600)
+}
+
+func (s *Secrets) seal(app string, name string, value string) (string, error) {
+	gcm, err := newGCM(s.key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), secretAAD(app, name))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *Secrets) open(app string, name string, sealed string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", fmt.Errorf("invalid secret %s for %s: %w", name, app, err)
+	}
+	gcm, err := newGCM(s.key)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid secret %s for %s", name, app)
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], secretAAD(app, name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %s for %s: %w", name, app, err)
+	}
+	return string(plain), nil
+}
+
+func secretAAD(app string, name string) []byte {
+	return []byte(app + "\x00" + name)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func loadOrCreateKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("invalid secrets key at %s", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return loadOrCreateKey(path)
+		}
+		return nil, err
+	}
+	if _, err := file.Write(key); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return key, file.Close()
+}
+
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
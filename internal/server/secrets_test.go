@@ -0,0 +1,151 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// useTempSecretsKey points the key path at a temp dir, whether or not tests run as root.
+func useTempSecretsKey(t *testing.T) string {
+	t.Helper()
+	keyDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", keyDir)
+	previous := rootSecretsKeyPath
+	rootSecretsKeyPath = filepath.Join(keyDir, "viberun", "secrets.key")
+	t.Cleanup(func() { rootSecretsKeyPath = previous })
+	return rootSecretsKeyPath
+}
+
+func TestSecretsRoundTripEncryptedAtRest(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	keyPath := useTempSecretsKey(t)
+
+	secrets, err := LoadSecrets()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := secrets.Set("app-a", "STRIPE_KEY", "sk_live_123"); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := secrets.Set("app-a", "DATABASE_URL", "postgres://x"); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := secrets.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	path := filepath.Join(tmp, "viberun", "secrets.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read store: %v", err)
+	}
+	if strings.Contains(string(data), "sk_live_123") || strings.Contains(string(data), "postgres://x") {
+		t.Fatalf("expected values to be encrypted at rest: %s", data)
+	}
+	for _, path := range []string{path, keyPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat %s: %v", path, err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Fatalf("expected 0600 for %s, got %v", path, info.Mode().Perm())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "viberun", "secrets.key")); !os.IsNotExist(err) {
+		t.Fatalf("expected no key in the state dir, got %v", err)
+	}
+
+	loaded, err := LoadSecrets()
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if names := loaded.Names("app-a"); !reflect.DeepEqual(names, []string{"DATABASE_URL", "STRIPE_KEY"}) {
+		t.Fatalf("unexpected names: %v", names)
+	}
+	env, err := loaded.Env("app-a")
+	if err != nil {
+		t.Fatalf("env: %v", err)
+	}
+	if env["STRIPE_KEY"] != "sk_live_123" || env["DATABASE_URL"] != "postgres://x" {
+		t.Fatalf("unexpected env: %v", env)
+	}
+}
+
+func TestSecretsBoundToAppAndName(t *testing.T) {
+	tmp := t.TempDir()
+	secrets, err := loadSecretsFrom(filepath.Join(tmp, "secrets.json"), filepath.Join(tmp, "secrets.key"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := secrets.Set("app-a", "TOKEN", "value"); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	secrets.Apps["app-b"] = map[string]string{"TOKEN": secrets.Apps["app-a"]["TOKEN"]}
+	if _, err := secrets.Env("app-b"); err == nil {
+		t.Fatalf("expected ciphertext moved to another app to fail")
+	}
+}
+
+func TestSecretsRemoveAndValidate(t *testing.T) {
+	tmp := t.TempDir()
+	secrets, err := loadSecretsFrom(filepath.Join(tmp, "secrets.json"), filepath.Join(tmp, "secrets.key"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := secrets.Set("app-a", "1BAD", "x"); err == nil {
+		t.Fatalf("expected invalid name error")
+	}
+	if err := secrets.Set("app-a", "GOOD", "x"); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if secrets.Remove("app-a", "MISSING") {
+		t.Fatalf("expected missing secret to return false")
+	}
+	if !secrets.Remove("app-a", "GOOD") {
+		t.Fatalf("expected secret to be removed")
+	}
+	if _, ok := secrets.Apps["app-a"]; ok {
+		t.Fatalf("expected empty app to be dropped")
+	}
+	if err := secrets.Set("app-a", "GOOD", "x"); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if !secrets.RemoveApp("app-a") || secrets.RemoveApp("app-a") {
+		t.Fatalf("unexpected RemoveApp result")
+	}
+}
+
+func TestLoadSecretsMovesLegacyKey(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	keyPath := useTempSecretsKey(t)
+	legacy := filepath.Join(tmp, "viberun", "secrets.key")
+	secrets, err := loadSecretsFrom(filepath.Join(tmp, "viberun", "secrets.json"), legacy)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := secrets.Set("app-a", "TOKEN", "t0k3n"); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := secrets.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	loaded, err := LoadSecrets()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if env, err := loaded.Env("app-a"); err != nil || env["TOKEN"] != "t0k3n" {
+		t.Fatalf("expected the moved key to decrypt, got %v %v", env, err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Fatalf("expected the legacy key to be removed, got %v", err)
+	}
+	if _, err := os.Stat(keyPath); err != nil {
+		t.Fatalf("expected the key at %s: %v", keyPath, err)
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaxShareTTL bounds how long a share link stays valid.
+const MaxShareTTL = 7 * 24 * time.Hour
+
+// Share is a temporary link to an app served by the host proxy. Only a hash of the
+// token is stored; the link itself is shown once, when the share is created.
+type Share struct {
+	ID        string    `json:"id"`
+	App       string    `json:"app"`
+	TokenHash string    `json:"token_hash"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+}
+
+// Expired reports whether the share is no longer valid at now.
+func (s Share) Expired(now time.Time) bool {
+	return !now.Before(s.Expires)
+}
+
+// HashShareToken returns the digest stored for a share token.
+func HashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddShare creates a share for app valid for ttl and returns it with its token.
+func (s *State) AddShare(app string, ttl time.Duration, now time.Time) (Share, string, error) {
+	if ttl <= 0 || ttl > MaxShareTTL {
+		return Share{}, "", fmt.Errorf("share ttl must be between 1s and %s", MaxShareTTL)
+	}
+	id, err := randomHex(4)
+	if err != nil {
+		return Share{}, "", err
+	}
+	token, err := randomHex(24)
+	if err != nil {
+		return Share{}, "", err
+	}
+	share := Share{
+		ID:        id,
+		App:       app,
+		TokenHash: HashShareToken(token),
+		Created:   now.UTC(),
+		Expires:   now.Add(ttl).UTC(),
+	}
+	s.Shares = append(s.Shares, share)
+	return share, token, nil
+}
+
+// SharesForApp returns the app's unexpired shares, soonest to expire first.
+func (s *State) SharesForApp(app string, now time.Time) []Share {
+	shares := []Share{}
+	for _, share := range s.Shares {
+		if share.App == app && !share.Expired(now) {
+			shares = append(shares, share)
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		return shares[i].Expires.Before(shares[j].Expires)
+	})
+	return shares
+}
+
+// RemoveShare revokes one of the app's shares by ID.
+func (s *State) RemoveShare(app string, id string) bool {
+	return s.removeShares(func(share Share) bool {
+		return share.App == app && share.ID == id
+	})
+}
+
+// PruneShares drops expired shares and reports whether any were removed.
+func (s *State) PruneShares(now time.Time) bool {
+	return s.removeShares(func(share Share) bool {
+		return share.Expired(now)
+	})
+}
+
+func (s *State) removeShares(match func(Share) bool) bool {
+	kept := s.Shares[:0]
+	for _, share := range s.Shares {
+		if !match(share) {
+			kept = append(kept, share)
+		}
+	}
+	removed := len(kept) != len(s.Shares)
+	if len(kept) == 0 {
+		kept = nil
+	}
+	s.Shares = kept
+	return removed
+}
+
+func randomHex(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
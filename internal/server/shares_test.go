@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStateShares(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	state := State{Ports: map[string]int{"demo": 8080, "blog": 8081}}
+
+	long, token, err := state.AddShare("demo", 2*time.Hour, now)
+	if err != nil {
+		t.Fatalf("add share: %v", err)
+	}
+	if len(token) != 48 || long.TokenHash != HashShareToken(token) || long.TokenHash == token {
+		t.Fatalf("unexpected token %q for share %+v", token, long)
+	}
+	short, _, err := state.AddShare("demo", time.Hour, now)
+	if err != nil {
+		t.Fatalf("add share: %v", err)
+	}
+	if _, _, err := state.AddShare("blog", time.Minute, now); err != nil {
+		t.Fatalf("add share: %v", err)
+	}
+	if _, _, err := state.AddShare("demo", MaxShareTTL+time.Second, now); err == nil {
+		t.Fatalf("expected ttl above the maximum to fail")
+	}
+
+	shares := state.SharesForApp("demo", now)
+	if len(shares) != 2 || shares[0].ID != short.ID || shares[1].ID != long.ID {
+		t.Fatalf("unexpected demo shares: %+v", shares)
+	}
+	if got := state.SharesForApp("demo", now.Add(90*time.Minute)); len(got) != 1 || got[0].ID != long.ID {
+		t.Fatalf("expected only the long share after 90m, got %+v", got)
+	}
+
+	if !state.PruneShares(now.Add(30*time.Minute)) || len(state.Shares) != 2 {
+		t.Fatalf("expected the blog share pruned, got %+v", state.Shares)
+	}
+	if state.RemoveShare("blog", short.ID) {
+		t.Fatalf("expected share IDs to be scoped to their app")
+	}
+	if !state.RemoveShare("demo", short.ID) || len(state.SharesForApp("demo", now)) != 1 {
+		t.Fatalf("expected share removed, got %+v", state.Shares)
+	}
+	if !state.RemoveApp("demo") || state.Shares != nil {
+		t.Fatalf("expected app removal to drop its shares, got %+v", state.Shares)
+	}
+}
@@ -11,7 +11,11 @@ const basePort = 8080
 
 // State tracks persisted server allocations.
 type State struct {
-	Ports map[string]int `json:"ports"`
+	Ports  map[string]int         `json:"ports"`
+	Shares []Share                `json:"shares,omitempty"`
+	Health map[string]HealthCheck `json:"health,omitempty"`
+	// ShareListen is the address `viberun-server proxy` serves share links on.
+	ShareListen string `json:"share_listen,omitempty"`
 }
 
 func LoadState() (State, string, error) {
@@ -94,17 +98,40 @@ func (s *State) SetPort(app string, port int) {
 }
 
 func (s *State) RemoveApp(app string) bool {
+	removed := s.removeShares(func(share Share) bool {
+		return share.App == app
+	})
+	if s.RemoveHealth(app) {
+		removed = true
+	}
 	if s.Ports == nil {
-		return false
+		return removed
 	}
 	if _, ok := s.Ports[app]; !ok {
-		return false
+		return removed
 	}
 	delete(s.Ports, app)
 	return true
 }
 
+// AuthStagingDir is the private directory where auth bundles wait for an interactive session.
+func AuthStagingDir() (string, error) {
+	dir, err := baseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "auth"), nil
+}
+
 func statePath() (string, error) {
+	dir, err := baseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "server-state.json"), nil
+}
+
+func baseDir() (string, error) {
 	configHome := os.Getenv("XDG_CONFIG_HOME")
 	if configHome == "" {
 		var err error
@@ -114,5 +141,5 @@ func statePath() (string, error) {
 		}
 	}
 
-	return filepath.Join(configHome, "viberun", "server-state.json"), nil
+	return filepath.Join(configHome, "viberun"), nil
 }
@@ -50,10 +50,10 @@ type LocalForward struct {
 	RemotePort int
 }
 
+// RemoteSocketForward forwards a unix socket on the remote host to a local unix socket.
 type RemoteSocketForward struct {
 	RemotePath string
-	LocalHost  string
-	LocalPort  int
+	LocalPath  string
 }
 
 // BuildArgsWithLocalForward builds the ssh argument list for a target host and optional local forward.
@@ -77,13 +77,40 @@ func BuildArgsWithForwards(host string, remoteArgs []string, tty bool, forward *
 		args = append(args, "-L", fmt.Sprintf("%d:%s:%d", forward.LocalPort, remoteHost, forward.RemotePort))
 	}
 	if remoteSocket != nil {
-		localHost := strings.TrimSpace(remoteSocket.LocalHost)
-		if localHost == "" {
-			localHost = "localhost"
-		}
 		args = append(args, "-o", "ExitOnForwardFailure=yes", "-o", "StreamLocalBindUnlink=yes")
-		args = append(args, "-R", fmt.Sprintf("%s:%s:%d", remoteSocket.RemotePath, localHost, remoteSocket.LocalPort))
+		args = append(args, "-R", remoteSocket.RemotePath+":"+remoteSocket.LocalPath)
 	}
 	args = append(args, host)
 	return append(args, remoteArgs...)
 }
+
+// BuildForwardArgs builds an ssh argument list that only holds local forwards open,
+// without running a remote command.
+func BuildForwardArgs(host string, forwards []LocalForward) []string {
+	args := []string{"-N", "-T", "-o", "ExitOnForwardFailure=yes", "-o", "ServerAliveInterval=30"}
+	for _, forward := range forwards {
+		remoteHost := strings.TrimSpace(forward.RemoteHost)
+		if remoteHost == "" {
+			remoteHost = "localhost"
+		}
+		args = append(args, "-L", fmt.Sprintf("%d:%s:%d", forward.LocalPort, remoteHost, forward.RemotePort))
+	}
+	return append(args, host)
+}
+
+// ControlMasterArgs makes an ssh command the master of a control socket at path, so
+// forwards can be added to its connection later with BuildControlForwardArgs.
+func ControlMasterArgs(path string) []string {
+	return []string{"-o", "ControlMaster=yes", "-o", "ControlPath=" + path, "-o", "ControlPersist=no"}
+}
+
+// BuildControlForwardArgs builds an ssh argument list that adds (op "forward") or removes
+// (op "cancel") a local forward on the master connection at controlPath.
+func BuildControlForwardArgs(host string, controlPath string, op string, forward LocalForward) []string {
+	remoteHost := strings.TrimSpace(forward.RemoteHost)
+	if remoteHost == "" {
+		remoteHost = "localhost"
+	}
+	spec := fmt.Sprintf("%d:%s:%d", forward.LocalPort, remoteHost, forward.RemotePort)
+	return []string{"-S", controlPath, "-O", op, "-L", spec, host}
+}
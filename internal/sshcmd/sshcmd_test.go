@@ -1,6 +1,9 @@
 package sshcmd
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestRemoteArgsDefaultsAgent(t *testing.T) {
 	args := RemoteArgs("myapp", "", nil, nil)
@@ -105,8 +108,7 @@ func TestBuildArgsWithRemoteSocketForward(t *testing.T) {
 	remote := []string{"viberun-server", "--agent", "codex", "myapp"}
 	remoteSocket := &RemoteSocketForward{
 		RemotePath: "/tmp/viberun-open.sock",
-		LocalHost:  "localhost",
-		LocalPort:  51234,
+		LocalPath:  "/tmp/viberun-rpc-1/rpc.sock",
 	}
 	args := BuildArgsWithForwards("host-a", remote, true, nil, remoteSocket)
 	if len(args) < 7 {
@@ -124,7 +126,31 @@ func TestBuildArgsWithRemoteSocketForward(t *testing.T) {
 	if args[5] != "-R" {
 		t.Fatalf("expected -R, got %q", args[5])
 	}
-	if args[6] != "/tmp/viberun-open.sock:localhost:51234" {
+	if args[6] != "/tmp/viberun-open.sock:/tmp/viberun-rpc-1/rpc.sock" {
 		t.Fatalf("unexpected remote forward: %v", args[6])
 	}
 }
+
+func TestBuildForwardArgs(t *testing.T) {
+	args := BuildForwardArgs("host-a", []LocalForward{
+		{LocalPort: 8081, RemotePort: 8081},
+		{LocalPort: 5173, RemoteHost: "172.17.0.2", RemotePort: 5173},
+	})
+	want := []string{
+		"-N", "-T", "-o", "ExitOnForwardFailure=yes", "-o", "ServerAliveInterval=30",
+		"-L", "8081:localhost:8081",
+		"-L", "5173:172.17.0.2:5173",
+		"host-a",
+	}
+	if strings.Join(args, " ") != strings.Join(want, " ") {
+		t.Fatalf("expected %v, got %v", want, args)
+	}
+}
+
+func TestBuildControlForwardArgs(t *testing.T) {
+	args := BuildControlForwardArgs("host-a", "/tmp/vr.sock", "forward", LocalForward{LocalPort: 5174, RemoteHost: "172.17.0.2", RemotePort: 5173})
+	want := []string{"-S", "/tmp/vr.sock", "-O", "forward", "-L", "5174:172.17.0.2:5173", "host-a"}
+	if strings.Join(args, " ") != strings.Join(want, " ") {
+		t.Fatalf("expected %v, got %v", want, args)
+	}
+}
@@ -0,0 +1,90 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Version is set at build time with -ldflags "-X github.com/shayne/viberun/internal/version.Version=v1.2.3".
+var Version = "dev"
+
+// Commit may be set at build time; otherwise it is read from the Go build info.
+var Commit = ""
+
+// Server capabilities. A client checks for these before using an action the server
+// may be too old to know.
+const (
+	CapabilityVersion       = "version"
+	CapabilityDoctor        = "doctor"
+	CapabilityBootstrap     = "bootstrap"
+	CapabilityAuth          = "auth"
+	CapabilityAuthStage     = "auth-stage"
+	CapabilityAuthDry       = "auth-dry-run"
+	CapabilitySecrets       = "secrets"
+	CapabilityProxy         = "proxy"
+	CapabilityForward       = "forward"
+	CapabilityShare         = "share"
+	CapabilityHealth        = "health"
+	CapabilityPrompt        = "prompt"
+	CapabilityForwardTarget = "forward-target"
+	CapabilityProbe         = "probe"
+)
+
+// Info is the build information `viberun-server version` reports.
+type Info struct {
+	Version      string   `json:"version"`
+	Commit       string   `json:"commit,omitempty"`
+	GoVersion    string   `json:"go_version,omitempty"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// String returns the build version, or "dev" for local builds.
+func String() string {
+	value := strings.TrimSpace(Version)
+	if value == "" {
+		return "dev"
+	}
+	return value
+}
+
+// IsDev reports whether this is a local development build.
+func IsDev() bool {
+	return String() == "dev"
+}
+
+// Current returns the build info for this binary with the given capabilities.
+func Current(capabilities []string) Info {
+	return Info{
+		Version:      String(),
+		Commit:       commit(),
+		GoVersion:    runtime.Version(),
+		Capabilities: capabilities,
+	}
+}
+
+// Has reports whether the info lists a capability.
+func (i Info) Has(capability string) bool {
+	for _, value := range i.Capabilities {
+		if value == capability {
+			return true
+		}
+	}
+	return false
+}
+
+func commit() string {
+	if value := strings.TrimSpace(Commit); value != "" {
+		return value
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,27 @@
+package version
+
+import "testing"
+
+func TestStringDefaultsToDev(t *testing.T) {
+	original := Version
+	t.Cleanup(func() { Version = original })
+
+	Version = " "
+	if String() != "dev" || !IsDev() {
+		t.Fatalf("expected dev for empty version, got %q", String())
+	}
+	Version = "v1.2.3"
+	if String() != "v1.2.3" || IsDev() {
+		t.Fatalf("expected v1.2.3, got %q", String())
+	}
+}
+
+func TestInfoHas(t *testing.T) {
+	info := Current([]string{CapabilityAuth, CapabilitySecrets})
+	if !info.Has(CapabilityAuth) || info.Has(CapabilityDoctor) {
+		t.Fatalf("unexpected capabilities: %v", info.Capabilities)
+	}
+	if info.GoVersion == "" {
+		t.Fatalf("expected go version")
+	}
+}